@@ -0,0 +1,39 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Token settings, set from AuthConfig by ApplyAuthConfig
+var (
+	JWTSecret       []byte
+	JWTIssuer       string
+	JWTAudience     string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+)
+
+// ApplyAuthConfig - Install the token settings used by the auth helpers
+func ApplyAuthConfig(cfg AuthConfig) error {
+	JWTIssuer = cfg.JWTIssuer
+	JWTAudience = cfg.JWTAudience
+	AccessTokenTTL = cfg.AccessTokenTTL
+	RefreshTokenTTL = cfg.RefreshTokenTTL
+
+	if cfg.JWTSecret == "" {
+		// Development fallback: tokens stop being valid when the server restarts
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate JWT secret: %w", err)
+		}
+		JWTSecret = key
+		log.Println("⚠️  JWT_SECRET is not set, using a random secret for this run")
+		return nil
+	}
+
+	JWTSecret = []byte(cfg.JWTSecret)
+	return nil
+}
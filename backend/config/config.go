@@ -0,0 +1,364 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config - Application settings loaded from environment variables and an
+// optional KEY=VALUE config file. Environment variables win over the file.
+type Config struct {
+	Env      string
+	LogLevel string
+	Storage  string
+	Server   ServerConfig
+	Database DatabaseConfig
+	Auth     AuthConfig
+	CORS     CORSConfig
+	Uploads  UploadConfig
+	Cart     CartConfig
+	Pricing  PricingConfig
+}
+
+type ServerConfig struct {
+	Port              int
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+}
+
+type DatabaseConfig struct {
+	Host            string
+	Port            int
+	User            string
+	Password        string
+	Name            string
+	ConnectTimeout  time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+type AuthConfig struct {
+	JWTSecret       string
+	JWTIssuer       string
+	JWTAudience     string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
+// UploadConfig - Uploaded files are kept in Dir and served under BaseURL,
+// which may also point at a CDN in front of the server
+type UploadConfig struct {
+	Dir         string
+	BaseURL     string
+	MaxFileSize int64
+	MaxFiles    int
+}
+
+// CartConfig - Guest carts live in a cookie-held token and are dropped after
+// GuestTTL without changes; SecureCookie marks that cookie HTTPS only.
+// Checkout sessions must be placed within CheckoutTTL of starting.
+type CartConfig struct {
+	GuestTTL     time.Duration
+	SecureCookie bool
+	CheckoutTTL  time.Duration
+}
+
+// PricingConfig - TaxRate is a percentage of the discounted goods, already
+// contained in the prices when TaxInclusive. MemberDiscount is the
+// percentage members get off every item.
+type PricingConfig struct {
+	TaxRate        int
+	TaxInclusive   bool
+	MemberDiscount int
+}
+
+// Addr - Listen address of the HTTP server
+func (s ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+// ValidationError - Every missing or invalid key found while loading the config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load - Read the configuration. The file named by CONFIG_FILE is read first
+// (".env" when unset, skipped if it does not exist), then environment variables.
+// All problems are collected and returned together.
+func Load() (*Config, error) {
+	file, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &loader{file: file}
+	cfg := &Config{
+		Env:      l.oneOf("APP_ENV", "development", "development", "production"),
+		LogLevel: l.oneOf("LOG_LEVEL", "info", "debug", "info", "warn", "error"),
+		// memory keeps everything in process, for demos and tests without MySQL
+		Storage: l.oneOf("STORAGE", "mysql", "mysql", "memory"),
+		Server: ServerConfig{
+			// Railway and most PaaS hosts inject PORT
+			Port:              l.port([]string{"SERVER_PORT", "PORT"}, 8080),
+			ReadTimeout:       l.duration("SERVER_READ_TIMEOUT", 15*time.Second),
+			ReadHeaderTimeout: l.duration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+			WriteTimeout:      l.duration("SERVER_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:       l.duration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			ShutdownTimeout:   l.duration("SERVER_SHUTDOWN_TIMEOUT", 10*time.Second),
+		},
+		Database: DatabaseConfig{
+			// Railway's MySQL plugin exposes MYSQLHOST, MYSQLPORT, ...
+			Host:            l.str([]string{"DB_HOST", "MYSQLHOST"}, "localhost"),
+			Port:            l.port([]string{"DB_PORT", "MYSQLPORT"}, 3306),
+			User:            l.str([]string{"DB_USER", "MYSQLUSER"}, "root"),
+			Password:        l.str([]string{"DB_PASSWORD", "MYSQLPASSWORD"}, ""),
+			Name:            l.str([]string{"DB_NAME", "MYSQLDATABASE"}, "go_commerce"),
+			ConnectTimeout:  l.duration("DB_CONNECT_TIMEOUT", 10*time.Second),
+			MaxOpenConns:    l.positiveInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    l.positiveInt("DB_MAX_IDLE_CONNS", 25),
+			ConnMaxLifetime: l.duration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		},
+		Auth: AuthConfig{
+			JWTSecret:       l.str([]string{"JWT_SECRET"}, ""),
+			JWTIssuer:       l.str([]string{"JWT_ISSUER"}, "go-commerce-api"),
+			JWTAudience:     l.str([]string{"JWT_AUDIENCE"}, "go-commerce-web"),
+			AccessTokenTTL:  l.duration("JWT_ACCESS_TTL", 15*time.Minute),
+			RefreshTokenTTL: l.duration("JWT_REFRESH_TTL", 30*24*time.Hour),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: l.list("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		},
+		Uploads: UploadConfig{
+			Dir:         l.str([]string{"UPLOAD_DIR"}, "uploads"),
+			BaseURL:     strings.TrimSuffix(l.str([]string{"UPLOAD_BASE_URL"}, "/uploads"), "/"),
+			MaxFileSize: int64(l.positiveInt("UPLOAD_MAX_FILE_MB", 5)) << 20,
+			MaxFiles:    l.positiveInt("UPLOAD_MAX_FILES", 10),
+		},
+		Cart: CartConfig{
+			GuestTTL:    l.duration("CART_GUEST_TTL", 30*24*time.Hour),
+			CheckoutTTL: l.duration("CHECKOUT_TTL", time.Hour),
+		},
+		Pricing: PricingConfig{
+			TaxRate:        l.percent("TAX_RATE", 11),
+			TaxInclusive:   l.boolean("TAX_INCLUSIVE", false),
+			MemberDiscount: l.percent("MEMBER_DISCOUNT", 10),
+		},
+	}
+
+	// Cross-field rules
+	cfg.Cart.SecureCookie = cfg.Env == "production"
+	if cfg.Storage == "mysql" && cfg.Database.Name == "" {
+		l.fail("DB_NAME: is required")
+	}
+	if cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		l.fail("DB_MAX_IDLE_CONNS: must not exceed DB_MAX_OPEN_CONNS (%d)", cfg.Database.MaxOpenConns)
+	}
+	if cfg.Auth.JWTSecret == "" && cfg.Env == "production" {
+		l.fail("JWT_SECRET: is required when APP_ENV=production")
+	}
+	if cfg.Auth.JWTSecret != "" && len(cfg.Auth.JWTSecret) < 32 {
+		l.fail("JWT_SECRET: must be at least 32 characters")
+	}
+	if cfg.Auth.RefreshTokenTTL <= cfg.Auth.AccessTokenTTL {
+		l.fail("JWT_REFRESH_TTL: must be longer than JWT_ACCESS_TTL")
+	}
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			l.fail("CORS_ALLOWED_ORIGINS: %q must start with http:// or https://", origin)
+		}
+	}
+
+	if u := cfg.Uploads.BaseURL; !strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		l.fail("UPLOAD_BASE_URL: %q must be a path starting with / or an http(s) URL", u)
+	}
+
+	if len(l.problems) > 0 {
+		return nil, &ValidationError{Problems: l.problems}
+	}
+	return cfg, nil
+}
+
+// readConfigFile - Parse the optional KEY=VALUE file
+func readConfigFile() (map[string]string, error) {
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = ".env"
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// loader - Looks keys up and records every problem instead of stopping at the first
+type loader struct {
+	file     map[string]string
+	problems []string
+}
+
+func (l *loader) fail(format string, args ...interface{}) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+// lookup - First key that is set, in the environment or else in the file
+func (l *loader) lookup(keys []string) (string, string, bool) {
+	for _, key := range keys {
+		if v, ok := os.LookupEnv(key); ok {
+			return key, strings.TrimSpace(v), true
+		}
+	}
+	for _, key := range keys {
+		if v, ok := l.file[key]; ok {
+			return key, v, true
+		}
+	}
+	return keys[0], "", false
+}
+
+func (l *loader) str(keys []string, def string) string {
+	if _, v, ok := l.lookup(keys); ok {
+		return v
+	}
+	return def
+}
+
+func (l *loader) oneOf(key, def string, allowed ...string) string {
+	_, v, ok := l.lookup([]string{key})
+	if !ok || v == "" {
+		return def
+	}
+	v = strings.ToLower(v)
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+	l.fail("%s: must be one of %s (got %q)", key, strings.Join(allowed, ", "), v)
+	return def
+}
+
+func (l *loader) boolean(key string, def bool) bool {
+	_, v, ok := l.lookup([]string{key})
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.fail("%s: must be true or false (got %q)", key, v)
+		return def
+	}
+	return b
+}
+
+func (l *loader) port(keys []string, def int) int {
+	key, v, ok := l.lookup(keys)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 65535 {
+		l.fail("%s: must be a port number between 1 and 65535 (got %q)", key, v)
+		return def
+	}
+	return n
+}
+
+func (l *loader) positiveInt(key string, def int) int {
+	_, v, ok := l.lookup([]string{key})
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		l.fail("%s: must be a positive integer (got %q)", key, v)
+		return def
+	}
+	return n
+}
+
+func (l *loader) percent(key string, def int) int {
+	_, v, ok := l.lookup([]string{key})
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > 100 {
+		l.fail("%s: must be a percentage between 0 and 100 (got %q)", key, v)
+		return def
+	}
+	return n
+}
+
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	_, v, ok := l.lookup([]string{key})
+	if !ok || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		l.fail("%s: must be a positive duration such as 30s or 5m (got %q)", key, v)
+		return def
+	}
+	return d
+}
+
+func (l *loader) list(key string, def []string) []string {
+	_, v, ok := l.lookup([]string{key})
+	if !ok || v == "" {
+		return def
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.TrimSuffix(item, "/"))
+		}
+	}
+	if len(items) == 0 {
+		l.fail("%s: must list at least one origin", key)
+		return def
+	}
+	return items
+}
@@ -5,27 +5,42 @@ import (
 	"fmt"
 	"log"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 var DB *sql.DB
 
-// ConnectDatabase - Connect to MySQL database
-func ConnectDatabase() error {
-	dsn := "root:@tcp(localhost:3306)/go_commerce?parseTime=true"
+// DSN - MySQL connection string for these settings
+func (d DatabaseConfig) DSN() string {
+	c := mysql.NewConfig()
+	c.User = d.User
+	c.Passwd = d.Password
+	c.Net = "tcp"
+	c.Addr = fmt.Sprintf("%s:%d", d.Host, d.Port)
+	c.DBName = d.Name
+	c.ParseTime = true
+	c.Timeout = d.ConnectTimeout
+	return c.FormatDSN()
+}
 
-	db, err := sql.Open("mysql", dsn)
+// ConnectDatabase - Connect to MySQL database
+func ConnectDatabase(cfg DatabaseConfig) error {
+	db, err := sql.Open("mysql", cfg.DSN())
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
 	err = db.Ping()
 	if err != nil {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	DB = db
-	log.Println("✅ Database connected successfully")
+	log.Printf("✅ Database connected successfully (%s@%s:%d/%s)", cfg.User, cfg.Host, cfg.Port, cfg.Name)
 	return nil
 }
 
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/regions"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type AddressController struct {
+	Addresses repositories.AddressRepository
+}
+
+func NewAddressController(addresses repositories.AddressRepository) *AddressController {
+	return &AddressController{Addresses: addresses}
+}
+
+// GetAddresses - GET /api/addresses (the default first, then newest)
+func (c *AddressController) GetAddresses(w http.ResponseWriter, r *http.Request) {
+	c.writeAddresses(w, r, "Addresses fetched successfully")
+}
+
+// GetAddress - GET /api/addresses/{id}
+func (c *AddressController) GetAddress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	id, ok := addressID(w, r)
+	if !ok {
+		return
+	}
+
+	address, err := c.Addresses.Get(r.Context(), id, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Address not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch address")
+		return
+	}
+
+	utils.SuccessResponse(w, "Address fetched successfully", address)
+}
+
+// CreateAddress - POST /api/addresses. The first address becomes the
+// default.
+func (c *AddressController) CreateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+
+	var req models.AddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	address, msg := newAddress(req)
+	if msg != "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+	address.UserID = userID
+
+	if err := c.Addresses.Create(r.Context(), &address); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create address")
+		return
+	}
+
+	utils.CreatedResponse(w, "Address created successfully", address)
+}
+
+// UpdateAddress - PUT /api/addresses/{id}. The default stays the default
+// until another address is made the default.
+func (c *AddressController) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	id, ok := addressID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	address, msg := newAddress(req)
+	if msg != "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+	address.ID, address.UserID = id, userID
+
+	err := c.Addresses.Update(r.Context(), &address)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Address not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update address")
+		return
+	}
+
+	utils.SuccessResponse(w, "Address updated successfully", address)
+}
+
+// SetDefaultAddress - PUT /api/addresses/{id}/default
+func (c *AddressController) SetDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	id, ok := addressID(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.Addresses.SetDefault(r.Context(), id, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Address not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to set default address")
+		return
+	}
+
+	c.writeAddresses(w, r, "Default address updated successfully")
+}
+
+// DeleteAddress - DELETE /api/addresses/{id}. Deleting the default makes
+// the newest address left the default.
+func (c *AddressController) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	id, ok := addressID(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.Addresses.Delete(r.Context(), id, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Address not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete address")
+		return
+	}
+
+	c.writeAddresses(w, r, "Address deleted successfully")
+}
+
+// writeAddresses - Respond with the user's addresses, so the client sees
+// which one is the default after a change
+func (c *AddressController) writeAddresses(w http.ResponseWriter, r *http.Request, message string) {
+	userID, _ := middlewares.UserID(r)
+
+	addresses, err := c.Addresses.List(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch addresses")
+		return
+	}
+
+	utils.SuccessResponse(w, message, addresses)
+}
+
+// addressID - The {id} path value, answering 400 when it is not a number
+func addressID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid address ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// newAddress - Check the request and fill in the province name from its
+// code, returning the problem as a message
+func newAddress(req models.AddressRequest) (models.Address, string) {
+	label := strings.ToLower(strings.TrimSpace(req.Label))
+	if label == "" {
+		label = models.AddressHome
+	}
+	if !containsString(models.AddressLabels, label) {
+		return models.Address{}, "Invalid label, use " + strings.Join(models.AddressLabels, ", ")
+	}
+
+	province, ok := regions.FindProvince(strings.TrimSpace(req.ProvinceCode))
+	if !ok {
+		return models.Address{}, "Unknown province, pick one from /api/regions/provinces"
+	}
+	if strings.TrimSpace(req.District) == "" {
+		return models.Address{}, "District is required (at most 100 characters)"
+	}
+
+	shipping, msg := normalizeAddress(models.ShippingAddress{
+		RecipientName: req.RecipientName,
+		Phone:         req.Phone,
+		Street:        req.Street,
+		District:      req.District,
+		City:          req.City,
+		Province:      province.Name,
+		PostalCode:    req.PostalCode,
+		Notes:         req.Notes,
+	})
+	if msg != "" {
+		return models.Address{}, msg
+	}
+
+	return models.Address{
+		Label:         label,
+		RecipientName: shipping.RecipientName,
+		Phone:         shipping.Phone,
+		Street:        shipping.Street,
+		ProvinceCode:  province.Code,
+		Province:      shipping.Province,
+		City:          shipping.City,
+		District:      shipping.District,
+		PostalCode:    shipping.PostalCode,
+		Notes:         shipping.Notes,
+		IsDefault:     req.IsDefault,
+	}, ""
+}
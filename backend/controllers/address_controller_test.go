@@ -0,0 +1,96 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// addAddress - Save an address labelled label, made the default or not
+func (a *testAPI) addAddress(token, label string, isDefault bool) models.Address {
+	a.t.Helper()
+	var address models.Address
+	a.call("POST", "/api/addresses", token, map[string]interface{}{
+		"label":          label,
+		"recipient_name": "Test Customer",
+		"phone":          "081234567890",
+		"street":         "Jl. Merdeka 1",
+		"province_code":  "11",
+		"city":           "Banda Aceh",
+		"district":       "Baiturrahman",
+		"postal_code":    "23111",
+		"is_default":     isDefault,
+	}).expect(a.t, http.StatusCreated).decode(a.t, &address)
+	return address
+}
+
+// defaults - Labels of the addresses marked default in the answer
+func defaults(t *testing.T, resp apiResponse) []string {
+	t.Helper()
+	var addresses []models.Address
+	resp.decode(t, &addresses)
+	var labels []string
+	for _, address := range addresses {
+		if address.IsDefault {
+			labels = append(labels, address.Label)
+		}
+	}
+	return labels
+}
+
+func TestAddressBookKeepsOneDefault(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+
+	home := api.addAddress(token, "home", false)
+	if !home.IsDefault || home.Province != "Aceh" {
+		t.Fatalf("first address default %t in %q, want the default in Aceh", home.IsDefault, home.Province)
+	}
+	api.addAddress(token, "office", false)
+	api.addAddress(token, "other", true)
+
+	list := api.call("GET", "/api/addresses", token, nil).expect(t, http.StatusOK)
+	if got := defaults(t, list); len(got) != 1 || got[0] != "other" {
+		t.Fatalf("defaults = %v, want [other]", got)
+	}
+
+	resp := api.call("PUT", "/api/addresses/"+strconv.Itoa(home.ID)+"/default", token, nil).expect(t, http.StatusOK)
+	if got := defaults(t, resp); len(got) != 1 || got[0] != "home" {
+		t.Fatalf("defaults = %v, want [home]", got)
+	}
+
+	// The newest address left takes over from a deleted default
+	resp = api.call("DELETE", "/api/addresses/"+strconv.Itoa(home.ID), token, nil).expect(t, http.StatusOK)
+	if got := defaults(t, resp); len(got) != 1 || got[0] != "other" {
+		t.Fatalf("defaults = %v, want [other]", got)
+	}
+}
+
+func TestAddressBookIsPrivate(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.user("owner@example.com", models.RoleCustomer, 0)
+	_, other := api.user("other@example.com", models.RoleCustomer, 0)
+	path := "/api/addresses/" + strconv.Itoa(api.addAddress(owner, "home", false).ID)
+
+	api.call("GET", path, other, nil).expect(t, http.StatusNotFound)
+	api.call("PUT", path+"/default", other, nil).expect(t, http.StatusNotFound)
+	api.call("DELETE", path, other, nil).expect(t, http.StatusNotFound)
+	api.call("GET", path, owner, nil).expect(t, http.StatusOK)
+}
+
+func TestAddressNeedsAKnownProvince(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+
+	api.call("POST", "/api/addresses", token, map[string]string{
+		"recipient_name": "Test Customer",
+		"phone":          "081234567890",
+		"street":         "Jl. Merdeka 1",
+		"province_code":  "99",
+		"city":           "Banda Aceh",
+		"district":       "Baiturrahman",
+		"postal_code":    "23111",
+	}).expect(t, http.StatusBadRequest)
+}
@@ -0,0 +1,167 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/routes"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/search"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+)
+
+// testAPI - The routes over a fresh in-memory store, wired as main does.
+// Tax and the member discount are off so totals are plain sums.
+type testAPI struct {
+	t      *testing.T
+	ctx    context.Context
+	repos  *repositories.Repositories
+	router http.Handler
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	cfg := &config.Config{
+		LogLevel: "warn",
+		Auth: config.AuthConfig{
+			JWTSecret:       strings.Repeat("s", 32),
+			JWTIssuer:       "go-commerce-test",
+			JWTAudience:     "go-commerce-test",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: time.Hour,
+		},
+		CORS:    config.CORSConfig{AllowedOrigins: []string{"*"}},
+		Uploads: config.UploadConfig{Dir: t.TempDir(), BaseURL: "/uploads", MaxFileSize: 1 << 20, MaxFiles: 5},
+		Cart:    config.CartConfig{GuestTTL: time.Hour, CheckoutTTL: time.Hour},
+	}
+	if err := config.ApplyAuthConfig(cfg.Auth); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repos := repositories.NewMemory()
+	index, err := search.Build(ctx, repos.Products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAPI{t: t, ctx: ctx, repos: repos, router: routes.SetupRoutes(cfg, repos, index)}
+}
+
+// apiResponse - A recorded answer with its envelope decoded
+type apiResponse struct {
+	Code    int
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+	Cookies []*http.Cookie
+}
+
+// call - Send a request as the holder of token ("" for a guest) with the
+// body encoded as JSON and any cookies
+func (a *testAPI) call(method, path, token string, body interface{}, cookies ...*http.Cookie) apiResponse {
+	a.t.Helper()
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+
+	resp := apiResponse{Code: w.Code, Cookies: w.Result().Cookies()}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		a.t.Fatalf("%s %s: invalid JSON %q", method, path, w.Body.String())
+	}
+	return resp
+}
+
+// expect - Fail unless the answer has the status code
+func (r apiResponse) expect(t *testing.T, code int) apiResponse {
+	t.Helper()
+	if r.Code != code {
+		t.Fatalf("got status %d (%s%s), want %d", r.Code, r.Message, r.Error, code)
+	}
+	return r
+}
+
+// decode - Unmarshal the data of the answer into v
+func (r apiResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("invalid data %s: %v", r.Data, err)
+	}
+}
+
+// user - Store a user with the role and balance and sign an access token
+// for them
+func (a *testAPI) user(email, role string, balance int) (models.User, string) {
+	a.t.Helper()
+	user := models.User{Name: "Test " + role, Email: email, Role: role, Balance: balance}
+	if err := a.repos.Users.Create(a.ctx, &user); err != nil {
+		a.t.Fatal(err)
+	}
+	token, _, err := utils.GenerateAccessToken(user.ID, user.Role)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return user, token
+}
+
+// product - Store a product without variants
+func (a *testAPI) product(id string, price, stock int) {
+	a.t.Helper()
+	product := models.Product{ID: id, Name: "Product " + id, Price: price, Stock: stock}
+	if err := a.repos.Products.Create(a.ctx, &product); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// stock - The product's current stock
+func (a *testAPI) stock(id string) int {
+	a.t.Helper()
+	product, err := a.repos.Products.GetByID(a.ctx, id)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return product.Stock
+}
+
+// balance - The user's current balance
+func (a *testAPI) balance(userID int) int {
+	a.t.Helper()
+	user, err := a.repos.Users.GetByID(a.ctx, userID)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return user.Balance
+}
+
+// cart - The lines of the caller's cart
+func (a *testAPI) cart(token string, cookies ...*http.Cookie) []models.CartItem {
+	a.t.Helper()
+	var cart models.Cart
+	a.call("GET", "/api/cart", token, nil, cookies...).expect(a.t, http.StatusOK).decode(a.t, &cart)
+	return cart.Items
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+)
+
+type AuthController struct {
+	Users      repositories.UserRepository
+	Tokens     repositories.TokenRepository
+	Carts      repositories.CartRepository
+	CartConfig config.CartConfig
+}
+
+func NewAuthController(users repositories.UserRepository, tokens repositories.TokenRepository,
+	carts repositories.CartRepository, cartConfig config.CartConfig) *AuthController {
+	return &AuthController{Users: users, Tokens: tokens, Carts: carts, CartConfig: cartConfig}
+}
+
+// Register - POST /api/auth/register
+func (c *AuthController) Register(w http.ResponseWriter, r *http.Request) {
+	var req models.RegisterRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	email, err := utils.NormalizeEmail(req.Email)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	user := models.User{
+		Name:         name,
+		Email:        email,
+		PasswordHash: hash,
+		Role:         models.RoleCustomer,
+	}
+
+	err = c.Users.Create(r.Context(), &user)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		utils.ErrorResponse(w, http.StatusConflict, "Email is already registered")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to register user")
+		return
+	}
+
+	resp, err := c.issueTokens(r, user, newTokenFamily())
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	c.mergeGuestCart(w, r, user.ID)
+	utils.CreatedResponse(w, "Registration successful", resp)
+}
+
+// Login - POST /api/auth/login
+func (c *AuthController) Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Email and password are required")
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	user, err := c.Users.GetByEmail(r.Context(), email)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch user")
+		return
+	}
+
+	// Same response for unknown email and wrong password
+	if !utils.CheckPassword(user.PasswordHash, req.Password) {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	resp, err := c.issueTokens(r, user, newTokenFamily())
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	c.mergeGuestCart(w, r, user.ID)
+	utils.SuccessResponse(w, "Login successful", resp)
+}
+
+// RefreshToken - POST /api/auth/refresh
+// Refresh tokens are single use: each call revokes the presented token and
+// returns a new pair from the same family. Presenting a token that was already
+// rotated means it leaked, so the whole family is revoked.
+func (c *AuthController) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	userID, err := c.Tokens.Rotate(r.Context(), utils.HashToken(req.RefreshToken), models.RefreshToken{
+		TokenHash: refreshHash,
+		ExpiresAt: time.Now().Add(config.RefreshTokenTTL),
+	})
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	case errors.Is(err, repositories.ErrTokenRevoked):
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Refresh token has been revoked")
+		return
+	case errors.Is(err, repositories.ErrTokenExpired):
+		utils.ErrorResponse(w, http.StatusUnauthorized, "Refresh token has expired")
+		return
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to rotate refresh token")
+		return
+	}
+
+	user, err := c.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnauthorized, "User no longer exists")
+		return
+	}
+
+	resp, err := newAuthResponse(user, refreshToken)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	utils.SuccessResponse(w, "Token refreshed successfully", resp)
+}
+
+// Logout - POST /api/auth/logout
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	// Revoke the whole session, not just the presented token
+	err = c.Tokens.RevokeFamily(r.Context(), utils.HashToken(req.RefreshToken))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to revoke refresh token")
+		return
+	}
+
+	utils.SuccessResponse(w, "Logged out successfully", nil)
+}
+
+// mergeGuestCart - Fold the cart built before signing in into the user's
+// cart and drop the cart cookie. A failed merge does not fail the login; the
+// cookie stays so the next login tries again.
+func (c *AuthController) mergeGuestCart(w http.ResponseWriter, r *http.Request, userID int) {
+	token := cartToken(r)
+	if token == "" {
+		return
+	}
+	if err := c.Carts.Merge(r.Context(), utils.HashToken(token), userID, maxCartQuantity); err != nil {
+		return
+	}
+	clearCartCookie(w, c.CartConfig)
+}
+
+// issueTokens - Store a new refresh token in the given family and sign an access token
+func (c *AuthController) issueTokens(r *http.Request, user models.User, familyID string) (models.AuthResponse, error) {
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	err = c.Tokens.Create(r.Context(), models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: refreshHash,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(config.RefreshTokenTTL),
+	})
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	return newAuthResponse(user, refreshToken)
+}
+
+// newAuthResponse - Sign an access token to go with the given refresh token
+func newAuthResponse(user models.User, refreshToken string) (models.AuthResponse, error) {
+	accessToken, expiresAt, err := utils.GenerateAccessToken(user.ID, user.Role)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	user.PasswordHash = ""
+	return models.AuthResponse{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Seconds()),
+	}, nil
+}
+
+// newTokenFamily - Random ID grouping the refresh tokens of one login session
+func newTokenFamily() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,85 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// register - Sign up and return the tokens
+func (a *testAPI) register(email, password string) models.AuthResponse {
+	a.t.Helper()
+	var auth models.AuthResponse
+	a.call("POST", "/api/auth/register", "", map[string]string{
+		"name":     "Test Customer",
+		"email":    email,
+		"password": password,
+	}).expect(a.t, http.StatusCreated).decode(a.t, &auth)
+	return auth
+}
+
+// refresh - Trade the refresh token for a new pair
+func (a *testAPI) refresh(refreshToken string) apiResponse {
+	a.t.Helper()
+	return a.call("POST", "/api/auth/refresh", "", map[string]string{"refresh_token": refreshToken})
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	api := newTestAPI(t)
+	auth := api.register("New@Example.com", "secret123")
+
+	if auth.User.Email != "new@example.com" || auth.User.Role != models.RoleCustomer {
+		t.Fatalf("registered %s as %s", auth.User.Email, auth.User.Role)
+	}
+	api.call("GET", "/api/orders", auth.AccessToken, nil).expect(t, http.StatusOK)
+
+	api.call("POST", "/api/auth/register", "", map[string]string{
+		"name": "Again", "email": "new@example.com", "password": "secret123",
+	}).expect(t, http.StatusConflict)
+
+	api.call("POST", "/api/auth/login", "", map[string]string{
+		"email": "new@example.com", "password": "secret123",
+	}).expect(t, http.StatusOK)
+	api.call("POST", "/api/auth/login", "", map[string]string{
+		"email": "new@example.com", "password": "wrong1234",
+	}).expect(t, http.StatusUnauthorized)
+	api.call("POST", "/api/auth/login", "", map[string]string{
+		"email": "nobody@example.com", "password": "secret123",
+	}).expect(t, http.StatusUnauthorized)
+}
+
+func TestProtectedRoutesNeedAToken(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+
+	api.call("GET", "/api/orders", "", nil).expect(t, http.StatusUnauthorized)
+	api.call("GET", "/api/orders", "not-a-token", nil).expect(t, http.StatusUnauthorized)
+	api.call("GET", "/api/admin/users", token, nil).expect(t, http.StatusForbidden)
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	api := newTestAPI(t)
+	first := api.register("c@example.com", "secret123")
+
+	var second models.AuthResponse
+	api.refresh(first.RefreshToken).expect(t, http.StatusOK).decode(t, &second)
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh did not rotate the refresh token")
+	}
+
+	// Replaying the rotated token revokes the whole session
+	api.refresh(first.RefreshToken).expect(t, http.StatusUnauthorized)
+	api.refresh(second.RefreshToken).expect(t, http.StatusUnauthorized)
+
+	api.refresh("unknown").expect(t, http.StatusUnauthorized)
+}
+
+func TestLogoutRevokesTheSession(t *testing.T) {
+	api := newTestAPI(t)
+	auth := api.register("c@example.com", "secret123")
+
+	api.call("POST", "/api/auth/logout", "", map[string]string{"refresh_token": auth.RefreshToken}).
+		expect(t, http.StatusOK)
+	api.refresh(auth.RefreshToken).expect(t, http.StatusUnauthorized)
+}
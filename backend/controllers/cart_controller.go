@@ -0,0 +1,542 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type CartController struct {
+	Products  repositories.ProductRepository
+	Carts     repositories.CartRepository
+	Wishlists repositories.WishlistRepository
+	Vouchers  repositories.VoucherRepository
+	Users     repositories.UserRepository
+	Pricing   pricing.Rules
+	Config    config.CartConfig
+}
+
+func NewCartController(products repositories.ProductRepository, carts repositories.CartRepository,
+	wishlists repositories.WishlistRepository, vouchers repositories.VoucherRepository, users repositories.UserRepository,
+	rules pricing.Rules, cfg config.CartConfig) *CartController {
+	return &CartController{Products: products, Carts: carts, Wishlists: wishlists, Vouchers: vouchers, Users: users,
+		Pricing: rules, Config: cfg}
+}
+
+// maxCartQuantity - Most units of one product and variant in a cart
+const maxCartQuantity = 100
+
+// cartCookie - Cookie holding a guest's opaque cart token
+const cartCookie = "cart_token"
+
+// GetCart - GET /api/cart (prices and stock are checked again on every read)
+func (c *CartController) GetCart(w http.ResponseWriter, r *http.Request) {
+	owner, ok := c.owner(w, r, false)
+	if !ok {
+		return
+	}
+	c.respond(w, r, owner, http.StatusOK, "Cart fetched successfully")
+}
+
+// AddCartItem - POST /api/cart/items. Adding a product already in the cart
+// raises the quantity of its line. A guest's first item starts their cart.
+func (c *CartController) AddCartItem(w http.ResponseWriter, r *http.Request) {
+	owner, ok := c.owner(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req models.CartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	if req.ProductID == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Product ID is required")
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 1 || req.Quantity > maxCartQuantity {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Quantity must be between 1 and "+strconv.Itoa(maxCartQuantity))
+		return
+	}
+
+	product, err := c.Products.GetByID(r.Context(), req.ProductID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add item to cart")
+		return
+	}
+
+	price, stock := product.Price, product.Stock
+	switch {
+	case len(product.Variants) > 0 && req.VariantID == 0:
+		utils.ErrorResponse(w, http.StatusBadRequest, "Choose a variant of this product")
+		return
+	case req.VariantID != 0:
+		variant, ok := findVariant(product.Variants, req.VariantID)
+		if !ok {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Variant not found")
+			return
+		}
+		if variant.PriceOverride != nil {
+			price = *variant.PriceOverride
+		}
+		stock = variant.Stock
+	}
+
+	items, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add item to cart")
+		return
+	}
+	quantity := req.Quantity
+	for _, item := range items {
+		if item.ProductID == req.ProductID && item.VariantID == req.VariantID {
+			quantity += item.Quantity
+		}
+	}
+	if quantity > maxCartQuantity {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Quantity must be between 1 and "+strconv.Itoa(maxCartQuantity))
+		return
+	}
+	if quantity > stock {
+		writeStockLimit(w, stock)
+		return
+	}
+
+	_, err = c.Carts.AddItem(r.Context(), owner, models.CartItem{
+		ProductID:     req.ProductID,
+		VariantID:     req.VariantID,
+		Quantity:      req.Quantity,
+		PreviousPrice: price,
+	})
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add item to cart")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusCreated, "Item added to cart successfully")
+}
+
+// UpdateCartItem - PATCH /api/cart/items/{itemId}. Saving a line also
+// accepts its current price, which clears the repriced flag.
+func (c *CartController) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	owner, ok := c.owner(w, r, true)
+	if !ok {
+		return
+	}
+	item, ok := c.findItem(w, r, owner)
+	if !ok {
+		return
+	}
+
+	var req models.CartItemUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	if req.Quantity != nil {
+		if *req.Quantity < 1 || *req.Quantity > maxCartQuantity {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Quantity must be between 1 and "+strconv.Itoa(maxCartQuantity))
+			return
+		}
+		// Lowering the quantity is always allowed, so lines over the stock
+		// can be fixed
+		if *req.Quantity > item.Quantity && *req.Quantity > item.Stock {
+			writeStockLimit(w, item.Stock)
+			return
+		}
+		item.Quantity = *req.Quantity
+	}
+	if req.Selected != nil {
+		item.Selected = *req.Selected
+	}
+	item.PreviousPrice = item.Price
+
+	err := c.Carts.UpdateItem(r.Context(), owner, item)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Cart item not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update cart item")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Cart item updated successfully")
+}
+
+// DeleteCartItem - DELETE /api/cart/items/{itemId}
+func (c *CartController) DeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	owner, ok := c.owner(w, r, true)
+	if !ok {
+		return
+	}
+	item, ok := c.findItem(w, r, owner)
+	if !ok {
+		return
+	}
+
+	if err := c.Carts.DeleteItems(r.Context(), owner, []int{item.ID}); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete cart item")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Cart item deleted successfully")
+}
+
+// DeleteCartItems - DELETE /api/cart/items with {"item_ids": [...]}; no IDs
+// (or no body) empties the cart
+func (c *CartController) DeleteCartItems(w http.ResponseWriter, r *http.Request) {
+	owner, ok := c.owner(w, r, true)
+	if !ok {
+		return
+	}
+	req, ok := decodeCartBulk(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.Carts.DeleteItems(r.Context(), owner, req.ItemIDs); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete cart items")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Cart items deleted successfully")
+}
+
+// SelectCartItems - PATCH /api/cart/items with {"item_ids": [...],
+// "selected": bool}; no IDs selects or clears every line
+func (c *CartController) SelectCartItems(w http.ResponseWriter, r *http.Request) {
+	owner, ok := c.owner(w, r, true)
+	if !ok {
+		return
+	}
+	req, ok := decodeCartBulk(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.Carts.SelectItems(r.Context(), owner, req.ItemIDs, req.Selected); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update cart items")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Cart items updated successfully")
+}
+
+// MoveToWishlist - POST /api/cart/move-to-wishlist with {"item_ids": [...]};
+// no IDs moves the selected lines. Lines are saved at their current price.
+func (c *CartController) MoveToWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	owner := repositories.CartOwner{UserID: userID}
+
+	var req models.WishlistMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	items, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+	ids := []int{}
+	for _, item := range items {
+		if len(req.ItemIDs) == 0 && item.Selected || containsInt(req.ItemIDs, item.ID) {
+			ids = append(ids, item.ID)
+		}
+	}
+	for _, id := range req.ItemIDs {
+		if !containsInt(ids, id) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Cart item not found")
+			return
+		}
+	}
+	if len(ids) == 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "No items selected")
+		return
+	}
+
+	if _, err := c.Wishlists.MoveFromCart(r.Context(), userID, ids); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to move items to wishlist")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Items moved to wishlist successfully")
+}
+
+// ApplyVoucher - POST /api/cart/voucher with {"code": "..."}. The code is
+// checked against the selected lines now and again on every read; a
+// rejection answers with the reason.
+func (c *CartController) ApplyVoucher(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	owner := repositories.CartOwner{UserID: userID}
+
+	var req models.VoucherApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	code := models.NormalizeVoucherCode(req.Code)
+	if code == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Voucher code is required")
+		return
+	}
+
+	voucher, err := c.Vouchers.GetByCode(r.Context(), code, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		writeVoucherRejection(w, models.VoucherReasonNotFound, voucher, 0)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to apply voucher")
+		return
+	}
+
+	items, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+	member, err := isMember(r.Context(), c.Users, userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to apply voucher")
+		return
+	}
+	breakdown, applied := quoteCart(c.Pricing, models.NewCart(items), member, &voucher)
+	if !applied.Valid {
+		writeVoucherRejection(w, applied.Reason, voucher, breakdown.Subtotal)
+		return
+	}
+
+	if err := c.Carts.SetVoucher(r.Context(), owner, voucher.ID); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to apply voucher")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Voucher applied successfully")
+}
+
+// RemoveVoucher - DELETE /api/cart/voucher
+func (c *CartController) RemoveVoucher(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	owner := repositories.CartOwner{UserID: userID}
+
+	if err := c.Carts.SetVoucher(r.Context(), owner, 0); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to remove voucher")
+		return
+	}
+
+	c.respond(w, r, owner, http.StatusOK, "Voucher removed successfully")
+}
+
+// findItem - The line named by the itemId route variable, with its live
+// price and stock; answers 400, 404 or 500 and returns false otherwise
+func (c *CartController) findItem(w http.ResponseWriter, r *http.Request, owner repositories.CartOwner) (models.CartItem, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["itemId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid cart item ID")
+		return models.CartItem{}, false
+	}
+
+	items, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return models.CartItem{}, false
+	}
+	for _, item := range items {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	utils.ErrorResponse(w, http.StatusNotFound, "Cart item not found")
+	return models.CartItem{}, false
+}
+
+// owner - Whose cart the request works on: the signed in user's, or the
+// guest's named by the cart cookie. Changes (write) give a guest without a
+// cookie a new token and renew the cookie, so it expires with the cart.
+// Answers 500 and returns false when no token can be made.
+func (c *CartController) owner(w http.ResponseWriter, r *http.Request, write bool) (repositories.CartOwner, bool) {
+	if userID, ok := middlewares.UserID(r); ok {
+		return repositories.CartOwner{UserID: userID}, true
+	}
+
+	token := cartToken(r)
+	if !write {
+		return repositories.CartOwner{TokenHash: hashCartToken(token)}, true
+	}
+	if token == "" {
+		var err error
+		if token, _, err = utils.GenerateOpaqueToken(); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to start a cart")
+			return repositories.CartOwner{}, false
+		}
+	}
+	setCartCookie(w, token, c.Config)
+	return repositories.CartOwner{TokenHash: utils.HashToken(token)}, true
+}
+
+// respond - Answer with the owner's cart as it is now, priced for them with
+// its voucher checked against the selected lines
+func (c *CartController) respond(w http.ResponseWriter, r *http.Request, owner repositories.CartOwner, status int, message string) {
+	items, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+	voucherID, err := c.Carts.VoucherID(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+
+	member, err := isMember(r.Context(), c.Users, owner.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+
+	var voucher *models.Voucher
+	if voucherID != 0 {
+		v, err := c.Vouchers.GetByID(r.Context(), voucherID, owner.UserID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+			return
+		}
+		if err == nil {
+			voucher = &v
+		}
+	}
+
+	cart := models.NewCart(items)
+	cart.Summary.PriceBreakdown, cart.Voucher = quoteCart(c.Pricing, cart, member, voucher)
+	if status == http.StatusCreated {
+		utils.CreatedResponse(w, message, cart)
+		return
+	}
+	utils.SuccessResponse(w, message, cart)
+}
+
+// quoteCart - Price the selected lines of the cart, with the voucher if any
+func quoteCart(rules pricing.Rules, cart models.Cart, member bool, voucher *models.Voucher) (models.PriceBreakdown, *models.AppliedVoucher) {
+	return rules.Quote(pricing.Input{
+		Lines:   pricing.CartLines(cart.Items),
+		Member:  member,
+		Voucher: voucher,
+		Now:     time.Now(),
+	})
+}
+
+// isMember - Whether the user gets the member discount; guests (0) and
+// users deleted since do not
+func isMember(ctx context.Context, users repositories.UserRepository, userID int) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	user, err := users.GetByID(ctx, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	return user.IsMember, err
+}
+
+func decodeCartBulk(w http.ResponseWriter, r *http.Request) (models.CartBulkRequest, bool) {
+	var req models.CartBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return req, false
+	}
+	return req, true
+}
+
+// cartToken - The guest cart token sent with the request, if any
+func cartToken(r *http.Request) string {
+	cookie, err := r.Cookie(cartCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// hashCartToken - The stored form of a cart token; empty stays empty so a
+// guest without a token matches no cart
+func hashCartToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	return utils.HashToken(token)
+}
+
+// setCartCookie - Store the cart token for the guest cart lifetime. The
+// cookie covers /api so the auth endpoints can merge the cart on login.
+func setCartCookie(w http.ResponseWriter, token string, cfg config.CartConfig) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cartCookie,
+		Value:    token,
+		Path:     "/api",
+		MaxAge:   int(cfg.GuestTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearCartCookie - Drop the cart token once its cart has been merged
+func clearCartCookie(w http.ResponseWriter, cfg config.CartConfig) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cartCookie,
+		Path:     "/api",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func writeStockLimit(w http.ResponseWriter, stock int) {
+	if stock <= 0 {
+		utils.ErrorResponse(w, http.StatusConflict, "Out of stock")
+		return
+	}
+	utils.ErrorResponse(w, http.StatusConflict, "Only "+strconv.Itoa(stock)+" left in stock")
+}
+
+func findVariant(variants []models.ProductVariant, id int) (models.ProductVariant, bool) {
+	for _, v := range variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return models.ProductVariant{}, false
+}
@@ -0,0 +1,81 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// cartCookie - The cart_token cookie set by the answer
+func cartCookie(t *testing.T, resp apiResponse) *http.Cookie {
+	t.Helper()
+	for _, cookie := range resp.Cookies {
+		if cookie.Name == "cart_token" {
+			return cookie
+		}
+	}
+	t.Fatal("no cart_token cookie in the answer")
+	return nil
+}
+
+// addToCart - Add quantity of the product to the caller's cart
+func (a *testAPI) addToCart(token, productID string, quantity int, cookies ...*http.Cookie) apiResponse {
+	a.t.Helper()
+	return a.call("POST", "/api/cart/items", token,
+		map[string]interface{}{"product_id": productID, "quantity": quantity}, cookies...)
+}
+
+func TestAddCartItemStaysWithinStock(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 3)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+
+	api.addToCart(token, "P1", 2).expect(t, http.StatusCreated)
+	api.addToCart(token, "P1", 2).expect(t, http.StatusConflict)
+	api.addToCart(token, "P1", 0).expect(t, http.StatusCreated)
+	api.addToCart(token, "P1", 101).expect(t, http.StatusBadRequest)
+	api.addToCart(token, "missing", 1).expect(t, http.StatusNotFound)
+
+	items := api.cart(token)
+	if len(items) != 1 || items[0].Quantity != 3 {
+		t.Fatalf("cart = %+v, want one line of 3", items)
+	}
+}
+
+func TestGuestCartMergesOnLogin(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	api.product("P2", 20000, 5)
+	api.register("c@example.com", "secret123")
+	var auth models.AuthResponse
+	api.call("POST", "/api/auth/login", "", map[string]string{"email": "c@example.com", "password": "secret123"}).
+		expect(t, http.StatusOK).decode(t, &auth)
+	api.addToCart(auth.AccessToken, "P1", 3).expect(t, http.StatusCreated)
+
+	// The guest cart lives in the cookie handed out with the first line
+	cookie := cartCookie(t, api.addToCart("", "P1", 4).expect(t, http.StatusCreated))
+	api.addToCart("", "P2", 1, cookie).expect(t, http.StatusCreated)
+	if items := api.cart("", cookie); len(items) != 2 {
+		t.Fatalf("guest cart has %d lines, want 2", len(items))
+	}
+
+	login := api.call("POST", "/api/auth/login", "", map[string]string{
+		"email": "c@example.com", "password": "secret123",
+	}, cookie).expect(t, http.StatusOK)
+	if cleared := cartCookie(t, login); cleared.MaxAge >= 0 {
+		t.Error("login kept the cart cookie")
+	}
+
+	// Shared lines add up, capped at the stock
+	quantities := map[string]int{}
+	for _, item := range api.cart(auth.AccessToken) {
+		quantities[item.ProductID] = item.Quantity
+	}
+	if quantities["P1"] != 5 || quantities["P2"] != 1 || len(quantities) != 2 {
+		t.Fatalf("merged cart = %v, want P1: 5, P2: 1", quantities)
+	}
+	if items := api.cart("", cookie); len(items) != 0 {
+		t.Errorf("guest cart still has %d lines", len(items))
+	}
+}
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/search"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type CategoryController struct {
+	Categories repositories.CategoryRepository
+	Products   repositories.ProductRepository
+	Search     *search.Index
+}
+
+func NewCategoryController(categories repositories.CategoryRepository, products repositories.ProductRepository,
+	index *search.Index) *CategoryController {
+	return &CategoryController{Categories: categories, Products: products, Search: index}
+}
+
+// Limits of a category
+const (
+	maxCategoryNameLen  = 100
+	maxCategorySlugLen  = 120
+	maxCategoryImageLen = 500
+)
+
+// GetCategories - GET /api/categories (flat, in display order)
+func (c *CategoryController) GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := c.Categories.List(r.Context())
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+
+	utils.SuccessResponse(w, "Categories fetched successfully", categories)
+}
+
+// GetCategoryTree - GET /api/categories/tree
+func (c *CategoryController) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	categories, err := c.Categories.List(r.Context())
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+
+	utils.SuccessResponse(w, "Category tree fetched successfully", models.CategoryTree(categories))
+}
+
+// GetCategory - GET /api/categories/{slug}, with its breadcrumb path and
+// subcategories
+func (c *CategoryController) GetCategory(w http.ResponseWriter, r *http.Request) {
+	category, err := c.Categories.GetBySlug(r.Context(), mux.Vars(r)["slug"])
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Category not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch category")
+		return
+	}
+
+	categories, err := c.Categories.List(r.Context())
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch category")
+		return
+	}
+	category.Path = models.CategoryPath(categories, category.ID)
+	category.Children = []models.Category{}
+	for _, child := range categories {
+		if child.ParentID != nil && *child.ParentID == category.ID {
+			category.Children = append(category.Children, child)
+		}
+	}
+
+	utils.SuccessResponse(w, "Category fetched successfully", category)
+}
+
+// CreateCategory - POST /api/admin/categories
+func (c *CategoryController) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	category, ok := c.decodeCategory(w, r, 0)
+	if !ok {
+		return
+	}
+
+	err := c.Categories.Create(r.Context(), &category)
+	if !writeCategoryError(w, err, "Failed to create category") {
+		return
+	}
+
+	utils.CreatedResponse(w, "Category created successfully", category)
+}
+
+// UpdateCategory - PUT /api/admin/categories/{id}
+func (c *CategoryController) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	existing, err := c.Categories.GetByID(r.Context(), id)
+	if !writeCategoryError(w, err, "Failed to update category") {
+		return
+	}
+
+	category, ok := c.decodeCategory(w, r, id)
+	if !ok {
+		return
+	}
+	category.ID = id
+	category.CreatedAt = existing.CreatedAt
+
+	err = c.Categories.Update(r.Context(), category)
+	if !writeCategoryError(w, err, "Failed to update category") {
+		return
+	}
+	if category.Name != existing.Name {
+		c.reindex(r, id)
+	}
+
+	utils.SuccessResponse(w, "Category updated successfully", category)
+}
+
+// DeleteCategory - DELETE /api/admin/categories/{id}
+func (c *CategoryController) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	err = c.Categories.Delete(r.Context(), id)
+	if errors.Is(err, repositories.ErrInUse) {
+		utils.ErrorResponse(w, http.StatusConflict, "Move or delete the category's subcategories and products first")
+		return
+	}
+	if !writeCategoryError(w, err, "Failed to delete category") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Category deleted successfully", nil)
+}
+
+// decodeCategory - Read and validate a category body. The parent must exist
+// and, for an existing category (id > 0), must not be the category itself
+// or one of its descendants.
+func (c *CategoryController) decodeCategory(w http.ResponseWriter, r *http.Request, id int) (models.Category, bool) {
+	var req models.CategoryRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return models.Category{}, false
+	}
+
+	// Validation
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxCategoryNameLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Name is required, up to "+strconv.Itoa(maxCategoryNameLen)+" characters")
+		return models.Category{}, false
+	}
+	if req.Slug == "" {
+		req.Slug = req.Name
+	}
+	req.Slug = models.Slugify(req.Slug)
+	if req.Slug == "" || len(req.Slug) > maxCategorySlugLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Slug must have letters or digits, up to "+strconv.Itoa(maxCategorySlugLen)+" characters")
+		return models.Category{}, false
+	}
+	if req.Slug == "tree" {
+		utils.ErrorResponse(w, http.StatusBadRequest, `The slug "tree" is reserved`)
+		return models.Category{}, false
+	}
+	req.Image = strings.TrimSpace(req.Image)
+	if len(req.Image) > maxCategoryImageLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Image URL must be at most "+strconv.Itoa(maxCategoryImageLen)+" characters")
+		return models.Category{}, false
+	}
+
+	if req.ParentID != nil {
+		categories, err := c.Categories.List(r.Context())
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch categories")
+			return models.Category{}, false
+		}
+		if !containsCategory(categories, *req.ParentID) {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Parent category not found")
+			return models.Category{}, false
+		}
+		if id > 0 && containsInt(models.CategoryDescendants(categories, id), *req.ParentID) {
+			utils.ErrorResponse(w, http.StatusBadRequest, "A category cannot be moved under itself or its subcategories")
+			return models.Category{}, false
+		}
+	}
+
+	return models.Category{
+		ParentID:  req.ParentID,
+		Name:      req.Name,
+		Slug:      req.Slug,
+		Image:     req.Image,
+		SortOrder: req.SortOrder,
+	}, true
+}
+
+// reindex - Refresh the search entries of a renamed category's products
+func (c *CategoryController) reindex(r *http.Request, id int) {
+	products, _, err := c.Products.List(r.Context(), repositories.ProductFilter{CategoryIDs: []int{id}})
+	if err != nil {
+		return
+	}
+	for _, p := range products {
+		c.Search.Add(p)
+	}
+}
+
+// writeCategoryError - Answer for a failed category read or write, false
+// when it answered
+func writeCategoryError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Category not found")
+		return false
+	case errors.Is(err, repositories.ErrDuplicate):
+		utils.ErrorResponse(w, http.StatusConflict, "Slug already exists")
+		return false
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, message)
+		return false
+	}
+	return true
+}
+
+func containsCategory(categories []models.Category, id int) bool {
+	for _, c := range categories {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, n int) bool {
+	for _, v := range values {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
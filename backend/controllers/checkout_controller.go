@@ -0,0 +1,578 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// Shipping address field limits, matching what the checkout page collects
+const (
+	maxRecipientLen = 100
+	maxStreetLen    = 255
+	maxRegionLen    = 100
+	maxAddressNotes = 255
+	minPhoneDigits  = 8
+	maxPhoneDigits  = 15
+	postalCodeLen   = 5
+)
+
+type CheckoutController struct {
+	Checkouts repositories.CheckoutRepository
+	Carts     repositories.CartRepository
+	Vouchers  repositories.VoucherRepository
+	Orders    repositories.OrderRepository
+	Users     repositories.UserRepository
+	Addresses repositories.AddressRepository
+	Pricing   pricing.Rules
+	Config    config.CartConfig
+}
+
+func NewCheckoutController(checkouts repositories.CheckoutRepository, carts repositories.CartRepository,
+	vouchers repositories.VoucherRepository, orders repositories.OrderRepository, users repositories.UserRepository,
+	addresses repositories.AddressRepository, rules pricing.Rules, cfg config.CartConfig) *CheckoutController {
+	return &CheckoutController{Checkouts: checkouts, Carts: carts, Vouchers: vouchers, Orders: orders, Users: users,
+		Addresses: addresses, Pricing: rules, Config: cfg}
+}
+
+// GetCheckoutOptions - GET /api/checkout/options, the shipping and payment
+// methods to choose from
+func (c *CheckoutController) GetCheckoutOptions(w http.ResponseWriter, r *http.Request) {
+	utils.SuccessResponse(w, "Checkout options fetched successfully", map[string]interface{}{
+		"shipping_methods": models.ShippingMethods,
+		"payment_methods":  models.PaymentMethods,
+	})
+}
+
+// StartCheckout - POST /api/checkout, start a session from the selected
+// lines of the caller's cart and its voucher. Starting again replaces the
+// caller's open session.
+func (c *CheckoutController) StartCheckout(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	owner := repositories.CartOwner{UserID: userID}
+
+	items, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+
+	cart := models.NewCart(items)
+	var selected, blocked []models.CartItem
+	for _, item := range cart.Items {
+		if !item.Selected {
+			continue
+		}
+		if !item.Purchasable() {
+			blocked = append(blocked, item)
+			continue
+		}
+		// The checkout starts at the prices the customer sees now
+		item.PreviousPrice = item.Price
+		selected = append(selected, item)
+	}
+	if len(blocked) > 0 {
+		utils.ErrorResponseWithData(w, http.StatusConflict, "Some selected items cannot be bought, update your cart first",
+			map[string]interface{}{"items": blocked})
+		return
+	}
+	if len(selected) == 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Select the items you want to check out")
+		return
+	}
+
+	checkout := models.Checkout{
+		ID:        generateCheckoutID(),
+		UserID:    userID,
+		Items:     selected,
+		ExpiresAt: time.Now().Add(c.Config.CheckoutTTL),
+	}
+	voucherID, err := c.Carts.VoucherID(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to start checkout")
+		return
+	}
+	if voucherID != 0 {
+		voucher, err := c.Vouchers.GetByID(r.Context(), voucherID, userID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to start checkout")
+			return
+		}
+		checkout.VoucherCode = voucher.Code
+	}
+
+	if err := c.Checkouts.Create(r.Context(), &checkout); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusConflict, "Some selected items no longer exist, update your cart first")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to start checkout")
+		return
+	}
+
+	checkout, ok := c.load(w, r, checkout.ID)
+	if !ok {
+		return
+	}
+	if !c.check(w, r, &checkout) {
+		return
+	}
+	utils.CreatedResponse(w, "Checkout started successfully", checkout)
+}
+
+// GetCheckout - GET /api/checkout/{id}, the session with its lines, prices
+// and stock checked again
+func (c *CheckoutController) GetCheckout(w http.ResponseWriter, r *http.Request) {
+	checkout, ok := c.load(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if !c.check(w, r, &checkout) {
+		return
+	}
+	utils.SuccessResponse(w, "Checkout fetched successfully", checkout)
+}
+
+// UpdateCheckoutShipping - PUT /api/checkout/{id}/shipping, the shipping
+// step: delivery address, or a saved one, and shipping method
+func (c *CheckoutController) UpdateCheckoutShipping(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+
+	var req models.CheckoutShippingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.AddressID != 0 {
+		saved, err := c.Addresses.Get(r.Context(), req.AddressID, userID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Address not found")
+			return
+		}
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch address")
+			return
+		}
+		req.Address = saved.ShippingAddress()
+	}
+
+	// Validation
+	address, msg := normalizeAddress(req.Address)
+	if msg != "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+	if _, ok := models.FindShippingMethod(req.ShippingMethod); !ok {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid shipping method, use "+strings.Join(shippingCodes(), ", "))
+		return
+	}
+
+	checkout, ok := c.loadOpen(w, r)
+	if !ok {
+		return
+	}
+	checkout.Address = &address
+	checkout.ShippingMethod = req.ShippingMethod
+	c.saveStep(w, r, checkout, "Shipping saved successfully")
+}
+
+// UpdateCheckoutPayment - PUT /api/checkout/{id}/payment, the payment step:
+// payment method and, optionally, another voucher
+func (c *CheckoutController) UpdateCheckoutPayment(w http.ResponseWriter, r *http.Request) {
+	var req models.CheckoutPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	if _, ok := models.FindPaymentMethod(req.PaymentMethod); !ok {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid payment method, use "+strings.Join(paymentCodes(), ", "))
+		return
+	}
+
+	checkout, ok := c.loadOpen(w, r)
+	if !ok {
+		return
+	}
+	if checkout.NextStep() == models.CheckoutStepShipping {
+		utils.ErrorResponse(w, http.StatusConflict, "Complete the shipping step first")
+		return
+	}
+
+	checkout.PaymentMethod = req.PaymentMethod
+	if req.VoucherCode != nil {
+		checkout.VoucherCode = models.NormalizeVoucherCode(*req.VoucherCode)
+		if checkout.VoucherCode != "" {
+			// A new code must fit now; one brought from the cart may be
+			// checked again at review
+			if !c.check(w, r, &checkout) {
+				return
+			}
+			if !checkout.Voucher.Valid {
+				voucher, _ := c.Vouchers.GetByCode(r.Context(), checkout.VoucherCode, checkout.UserID)
+				writeVoucherRejection(w, checkout.Voucher.Reason, voucher, checkout.Summary.Subtotal)
+				return
+			}
+		}
+	}
+	c.saveStep(w, r, checkout, "Payment saved successfully")
+}
+
+// GetCheckoutSummary - GET /api/checkout/{id}/summary, the read-only review
+// of the order once shipping and payment are chosen
+func (c *CheckoutController) GetCheckoutSummary(w http.ResponseWriter, r *http.Request) {
+	checkout, ok := c.load(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if checkout.NextStep() != models.CheckoutStepReview {
+		utils.ErrorResponse(w, http.StatusConflict, "Complete the shipping and payment steps first")
+		return
+	}
+	if !c.check(w, r, &checkout) {
+		return
+	}
+
+	shipping, _ := models.FindShippingMethod(checkout.ShippingMethod)
+	payment, _ := models.FindPaymentMethod(checkout.PaymentMethod)
+	utils.SuccessResponse(w, "Checkout summary fetched successfully", models.CheckoutSummary{
+		CheckoutID:     checkout.ID,
+		Ready:          checkout.Ready,
+		Items:          checkout.Items,
+		Address:        checkout.Address,
+		ShippingMethod: &shipping,
+		PaymentMethod:  &payment,
+		Voucher:        checkout.Voucher,
+		Price:          checkout.Summary,
+		ExpiresAt:      checkout.ExpiresAt,
+	})
+}
+
+// PlaceCheckoutOrder - POST /api/checkout/{id}/place with
+// {"accept_terms": true}. Stock, prices and the voucher are checked once
+// more; a price the customer has not seen yet answers 409 with the session
+// so they can review it and place again.
+func (c *CheckoutController) PlaceCheckoutOrder(w http.ResponseWriter, r *http.Request) {
+	var req models.CheckoutPlaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !req.AcceptTerms {
+		utils.ErrorResponse(w, http.StatusBadRequest, "You must accept the terms and conditions to place the order")
+		return
+	}
+
+	checkout, ok := c.loadOpen(w, r)
+	if !ok {
+		return
+	}
+	if checkout.NextStep() != models.CheckoutStepReview {
+		utils.ErrorResponse(w, http.StatusConflict, "Complete the shipping and payment steps first")
+		return
+	}
+	if !c.check(w, r, &checkout) {
+		return
+	}
+
+	switch {
+	case checkoutRepriced(checkout):
+		c.rejectPrices(w, r, checkout)
+		return
+	case !checkout.Ready && checkout.Voucher != nil && !checkout.Voucher.Valid:
+		voucher, _ := c.Vouchers.GetByCode(r.Context(), checkout.VoucherCode, checkout.UserID)
+		writeVoucherRejection(w, checkout.Voucher.Reason, voucher, checkout.Summary.Subtotal)
+		return
+	case !checkout.Ready:
+		utils.ErrorResponseWithData(w, http.StatusConflict, "Some items cannot be bought, go back to your cart",
+			map[string]interface{}{"reason": "items_unavailable", "checkout": checkout})
+		return
+	}
+
+	shipping, _ := models.FindShippingMethod(checkout.ShippingMethod)
+	acceptedAt := time.Now()
+	order := models.Order{
+		ID:              generateOrderID(),
+		CustomerID:      checkout.UserID,
+		CheckoutID:      checkout.ID,
+		ShippingAddress: checkout.Address,
+		ShippingMethod:  checkout.ShippingMethod,
+		PaymentMethod:   checkout.PaymentMethod,
+		TermsAcceptedAt: &acceptedAt,
+		VoucherCode:     checkout.VoucherCode,
+		Shipping:        shipping.Fee,
+	}
+	for _, item := range checkout.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:     item.ProductID,
+			VariantID:     item.VariantID,
+			Quantity:      item.Quantity,
+			AcceptedPrice: item.PreviousPrice,
+		})
+	}
+
+	err := c.Orders.Create(r.Context(), &order, c.Pricing, actorOf(r))
+	var stockErr *repositories.StockError
+	var voucherErr *repositories.VoucherError
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Checkout not found")
+		return
+	case errors.Is(err, repositories.ErrCheckoutClosed):
+		utils.ErrorResponse(w, http.StatusConflict, "This checkout has already been placed")
+		return
+	case errors.As(err, &stockErr):
+		writeStockError(w, stockErr)
+		return
+	case errors.As(err, &voucherErr):
+		writeVoucherRejection(w, voucherErr.Reason, voucherErr.Voucher, voucherErr.Subtotal)
+		return
+	case errors.Is(err, repositories.ErrRepriced):
+		// A price changed after the check above; reload for the new one
+		if checkout, ok = c.load(w, r, checkout.ID); !ok || !c.check(w, r, &checkout) {
+			return
+		}
+		c.rejectPrices(w, r, checkout)
+		return
+	case errors.Is(err, repositories.ErrInsufficientBalance):
+		utils.ErrorResponse(w, http.StatusConflict, "Your balance does not cover the order total, choose another payment method")
+		return
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to place order")
+		return
+	}
+
+	utils.CreatedResponse(w, "Order placed successfully", order)
+}
+
+// rejectPrices - Answer 409 with the session so the customer sees the new
+// prices, which count as seen from then on
+func (c *CheckoutController) rejectPrices(w http.ResponseWriter, r *http.Request, checkout models.Checkout) {
+	if err := c.Checkouts.Update(r.Context(), acceptPrices(checkout)); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to place order")
+		return
+	}
+	utils.ErrorResponseWithData(w, http.StatusConflict, "Some prices changed, review your order and place it again",
+		map[string]interface{}{"reason": "prices_changed", "checkout": checkout})
+}
+
+// load - The caller's session; answers 404 or 500 and returns false
+// otherwise
+func (c *CheckoutController) load(w http.ResponseWriter, r *http.Request, id string) (models.Checkout, bool) {
+	userID, _ := middlewares.UserID(r)
+	checkout, err := c.Checkouts.Get(r.Context(), id, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Checkout not found")
+		return checkout, false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch checkout")
+		return checkout, false
+	}
+	return checkout, true
+}
+
+// loadOpen - The caller's session named by the route, which must still be
+// open: answers 409 once placed and 410 once expired
+func (c *CheckoutController) loadOpen(w http.ResponseWriter, r *http.Request) (models.Checkout, bool) {
+	checkout, ok := c.load(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return checkout, false
+	}
+	if checkout.Status != models.CheckoutOpen {
+		utils.ErrorResponseWithData(w, http.StatusConflict, "This checkout has already been placed",
+			map[string]interface{}{"order_id": checkout.OrderID})
+		return checkout, false
+	}
+	if !time.Now().Before(checkout.ExpiresAt) {
+		utils.ErrorResponse(w, http.StatusGone, "This checkout has expired, start again from your cart")
+		return checkout, false
+	}
+	return checkout, true
+}
+
+// check - Flag the lines against live stock and prices, price the session
+// with its voucher and shipping, and work out the step and whether it can
+// be placed. Answers 500 and returns false when the customer or voucher
+// cannot be read.
+func (c *CheckoutController) check(w http.ResponseWriter, r *http.Request, checkout *models.Checkout) bool {
+	member, err := isMember(r.Context(), c.Users, checkout.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch checkout")
+		return false
+	}
+	voucher, err := c.voucher(r.Context(), *checkout)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch checkout")
+		return false
+	}
+
+	checkout.Items = models.NewCart(checkout.Items).Items
+	shipping, _ := models.FindShippingMethod(checkout.ShippingMethod)
+	checkout.Summary, checkout.Voucher = c.Pricing.Quote(pricing.Input{
+		Lines:    pricing.CartLines(checkout.Items),
+		Member:   member,
+		Voucher:  voucher,
+		Shipping: shipping.Fee,
+		Now:      time.Now(),
+	})
+	if voucher == nil && checkout.VoucherCode != "" {
+		reason := models.VoucherReasonNotFound
+		checkout.Voucher = &models.AppliedVoucher{Code: checkout.VoucherCode, Reason: reason,
+			Message: models.Voucher{}.RejectionMessage(reason, 0)}
+	}
+
+	checkout.Step = checkout.NextStep()
+	checkout.Ready = checkout.Status == models.CheckoutOpen && checkout.Step == models.CheckoutStepReview &&
+		time.Now().Before(checkout.ExpiresAt) && len(checkout.Items) > 0 &&
+		(checkout.Voucher == nil || checkout.Voucher.Valid) && !checkoutRepriced(*checkout)
+	for _, item := range checkout.Items {
+		checkout.Ready = checkout.Ready && item.Purchasable()
+	}
+	return true
+}
+
+// voucher - The session's voucher loaded for the customer, nil when it has
+// none or the code no longer exists
+func (c *CheckoutController) voucher(ctx context.Context, checkout models.Checkout) (*models.Voucher, error) {
+	if checkout.VoucherCode == "" {
+		return nil, nil
+	}
+	voucher, err := c.Vouchers.GetByCode(ctx, checkout.VoucherCode, checkout.UserID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &voucher, nil
+}
+
+// saveStep - Check the session again, store the step and answer with the
+// session. The prices in the answer count as seen, so a repriced line is
+// flagged in this answer only.
+func (c *CheckoutController) saveStep(w http.ResponseWriter, r *http.Request, checkout models.Checkout, message string) {
+	if !c.check(w, r, &checkout) {
+		return
+	}
+	if err := c.Checkouts.Update(r.Context(), acceptPrices(checkout)); err != nil {
+		if errors.Is(err, repositories.ErrCheckoutClosed) {
+			utils.ErrorResponse(w, http.StatusConflict, "This checkout has already been placed")
+			return
+		}
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to save checkout")
+		return
+	}
+	utils.SuccessResponse(w, message, checkout)
+}
+
+// acceptPrices - The session with the live prices as the ones last seen
+func acceptPrices(checkout models.Checkout) models.Checkout {
+	items := make([]models.CartItem, len(checkout.Items))
+	for i, item := range checkout.Items {
+		item.PreviousPrice = item.Price
+		items[i] = item
+	}
+	checkout.Items = items
+	return checkout
+}
+
+// checkoutRepriced - Whether a line's price changed since the customer last
+// saw it
+func checkoutRepriced(checkout models.Checkout) bool {
+	for _, item := range checkout.Items {
+		if item.Repriced {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAddress - Trim the address and check it, returning the problem
+// as a message
+func normalizeAddress(address models.ShippingAddress) (models.ShippingAddress, string) {
+	address.RecipientName = strings.TrimSpace(address.RecipientName)
+	address.Phone = strings.TrimSpace(address.Phone)
+	address.Street = strings.TrimSpace(address.Street)
+	address.District = strings.TrimSpace(address.District)
+	address.City = strings.TrimSpace(address.City)
+	address.Province = strings.TrimSpace(address.Province)
+	address.PostalCode = strings.TrimSpace(address.PostalCode)
+	address.Notes = strings.TrimSpace(address.Notes)
+
+	switch {
+	case address.RecipientName == "" || len(address.RecipientName) > maxRecipientLen:
+		return address, "Recipient name is required (at most 100 characters)"
+	case !isPhoneNumber(address.Phone):
+		return address, "Phone must be 8 to 15 digits, optionally starting with +"
+	case address.Street == "" || len(address.Street) > maxStreetLen:
+		return address, "Street address is required (at most 255 characters)"
+	case len(address.District) > maxRegionLen:
+		return address, "District must be at most 100 characters"
+	case address.City == "" || len(address.City) > maxRegionLen:
+		return address, "City is required (at most 100 characters)"
+	case address.Province == "" || len(address.Province) > maxRegionLen:
+		return address, "Province is required (at most 100 characters)"
+	case !isDigits(address.PostalCode) || len(address.PostalCode) != postalCodeLen:
+		return address, "Postal code must be 5 digits"
+	case len(address.Notes) > maxAddressNotes:
+		return address, "Notes must be at most 255 characters"
+	}
+	return address, ""
+}
+
+// isPhoneNumber - 8 to 15 digits with an optional leading +
+func isPhoneNumber(phone string) bool {
+	digits := strings.TrimPrefix(phone, "+")
+	return isDigits(digits) && len(digits) >= minPhoneDigits && len(digits) <= maxPhoneDigits
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func shippingCodes() []string {
+	codes := make([]string, len(models.ShippingMethods))
+	for i, m := range models.ShippingMethods {
+		codes[i] = m.Code
+	}
+	return codes
+}
+
+func paymentCodes() []string {
+	codes := make([]string, len(models.PaymentMethods))
+	for i, m := range models.PaymentMethods {
+		codes[i] = m.Code
+	}
+	return codes
+}
+
+// generateCheckoutID - Build a checkout ID like CHK-9F2C1A7B3D4E5F60
+func generateCheckoutID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "CHK-" + strings.ToUpper(hex.EncodeToString(b))
+}
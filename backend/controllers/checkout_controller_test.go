@@ -0,0 +1,95 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// startCheckout - Put quantity of the product in the cart and take it
+// through checkout up to the review step
+func (a *testAPI) startCheckout(token, productID string, quantity int) models.Checkout {
+	a.t.Helper()
+	a.addToCart(token, productID, quantity).expect(a.t, http.StatusCreated)
+
+	var checkout models.Checkout
+	a.call("POST", "/api/checkout", token, nil).expect(a.t, http.StatusCreated).decode(a.t, &checkout)
+	a.call("PUT", "/api/checkout/"+checkout.ID+"/shipping", token, map[string]interface{}{
+		"address": map[string]string{
+			"recipient_name": "Test Customer",
+			"phone":          "081234567890",
+			"street":         "Jl. Merdeka 1",
+			"city":           "Banda Aceh",
+			"province":       "Aceh",
+			"postal_code":    "23111",
+		},
+		"shipping_method": "regular",
+	}).expect(a.t, http.StatusOK)
+	a.call("PUT", "/api/checkout/"+checkout.ID+"/payment", token,
+		map[string]string{"payment_method": "bank_transfer"}).expect(a.t, http.StatusOK)
+	return checkout
+}
+
+// placeCheckout - Place the session, accepting the terms or not
+func (a *testAPI) placeCheckout(token, id string, acceptTerms bool) apiResponse {
+	a.t.Helper()
+	return a.call("POST", "/api/checkout/"+id+"/place", token, map[string]bool{"accept_terms": acceptTerms})
+}
+
+func TestCheckoutPlacesTheOrder(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+	checkout := api.startCheckout(token, "P1", 2)
+
+	api.placeCheckout(token, checkout.ID, false).expect(t, http.StatusBadRequest)
+
+	var order models.Order
+	api.placeCheckout(token, checkout.ID, true).expect(t, http.StatusCreated).decode(t, &order)
+
+	if order.Subtotal != 20000 || order.Shipping != 15000 || order.Total != 35000 {
+		t.Errorf("order subtotal %d, shipping %d, total %d", order.Subtotal, order.Shipping, order.Total)
+	}
+	if order.CheckoutID != checkout.ID || order.TermsAcceptedAt == nil {
+		t.Errorf("order not tied to checkout %s with the terms accepted", checkout.ID)
+	}
+	if got := api.stock("P1"); got != 3 {
+		t.Errorf("stock = %d, want 3", got)
+	}
+	if items := api.cart(token); len(items) != 0 {
+		t.Errorf("cart still has %d lines", len(items))
+	}
+
+	api.placeCheckout(token, checkout.ID, true).expect(t, http.StatusConflict)
+	if got := api.stock("P1"); got != 3 {
+		t.Errorf("stock after placing twice = %d, want 3", got)
+	}
+}
+
+func TestCheckoutAsksToReviewChangedPrices(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+	checkout := api.startCheckout(token, "P1", 1)
+
+	err := api.repos.Products.Update(api.ctx, "P1", models.ProductUpdateRequest{Name: "Product P1", Price: 12000, Stock: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rejected struct {
+		Reason string `json:"reason"`
+	}
+	api.placeCheckout(token, checkout.ID, true).expect(t, http.StatusConflict).decode(t, &rejected)
+	if rejected.Reason != "prices_changed" {
+		t.Fatalf("reason = %q, want prices_changed", rejected.Reason)
+	}
+
+	// The new price has now been shown, so placing again goes through at it
+	var order models.Order
+	api.placeCheckout(token, checkout.ID, true).expect(t, http.StatusCreated).decode(t, &order)
+	if order.Subtotal != 12000 {
+		t.Errorf("subtotal = %d, want 12000", order.Subtotal)
+	}
+}
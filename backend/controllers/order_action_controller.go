@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// CancelOrder - POST /api/orders/{id}/cancel
+func (c *OrderController) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// The body is optional, an empty one cancels without a reason
+	var req models.OrderCancelRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !c.ownOrder(w, r, id) {
+		return
+	}
+
+	note := req.Reason
+	if note == "" {
+		note = "Cancelled by customer"
+	}
+
+	refunded, err := c.Orders.Cancel(r.Context(), id, actorOf(r), note)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, "Order cancelled successfully", map[string]interface{}{
+		"id":       id,
+		"status":   models.OrderStatusCancelled,
+		"refunded": refunded,
+	})
+}
+
+// ConfirmOrderReceived - POST /api/orders/{id}/confirm
+func (c *OrderController) ConfirmOrderReceived(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !c.ownOrder(w, r, id) {
+		return
+	}
+
+	err := c.Orders.Transition(r.Context(), id, models.OrderStatusCompleted, actorOf(r), "Received by customer")
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, "Order completed successfully", map[string]string{
+		"id":     id,
+		"status": models.OrderStatusCompleted,
+	})
+}
+
+// ReorderOrder - POST /api/orders/{id}/reorder
+// Adds the items still in stock to the caller's cart, with each cart line
+// capped at the stock and the cart quantity limit, and returns the lines
+// priced at today's prices with what changed since. A line that could not
+// be added in full is flagged low_stock.
+func (c *OrderController) ReorderOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !c.ownOrder(w, r, id) {
+		return
+	}
+
+	lines, err := c.Orders.ReorderLines(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order items")
+		return
+	}
+
+	callerID, _ := middlewares.UserID(r)
+	owner := repositories.CartOwner{UserID: callerID}
+	cart, err := c.Carts.Items(r.Context(), owner)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add order items to cart")
+		return
+	}
+	for i, line := range lines {
+		if line.OutOfStock {
+			continue
+		}
+		// What is already in the cart counts towards the caps
+		room := min(line.Stock, maxCartQuantity) - findCartItem(cart, line.ProductID, line.VariantID).Quantity
+		quantity := min(line.Quantity, room)
+		if quantity < line.Quantity {
+			lines[i].LowStock = true
+		}
+		if quantity <= 0 {
+			continue
+		}
+		_, err := c.Carts.AddItem(r.Context(), owner, models.CartItem{
+			ProductID:     line.ProductID,
+			VariantID:     line.VariantID,
+			Quantity:      quantity,
+			PreviousPrice: line.Price,
+		})
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add order items to cart")
+			return
+		}
+	}
+
+	utils.SuccessResponse(w, "Order items added to cart", lines)
+}
+
+// ownOrder - Customer actions are limited to the caller's own orders. Other
+// customers' orders answer 404 like unknown ones, so IDs cannot be probed.
+func (c *OrderController) ownOrder(w http.ResponseWriter, r *http.Request, id string) bool {
+	order, err := c.Orders.GetByID(r.Context(), id)
+	callerID, _ := middlewares.UserID(r)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && order.CustomerID != callerID) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type OrderController struct {
+	Orders  repositories.OrderRepository
+	Carts   repositories.CartRepository
+	Pricing pricing.Rules
+}
+
+func NewOrderController(orders repositories.OrderRepository, carts repositories.CartRepository, rules pricing.Rules) *OrderController {
+	return &OrderController{Orders: orders, Carts: carts, Pricing: rules}
+}
+
+// CreateOrder - POST /api/orders
+func (c *OrderController) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	var req models.OrderCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Customers order for themselves; only order managers may order on behalf of someone else
+	callerID, _ := middlewares.UserID(r)
+	if req.CustomerID == 0 {
+		req.CustomerID = callerID
+	}
+	if !middlewares.CanAccessUser(r, req.CustomerID, models.PermManageOrders) {
+		utils.ErrorResponse(w, http.StatusForbidden, "You can only place orders for yourself")
+		return
+	}
+
+	// Validation
+	if len(req.Items) == 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "At least one item is required")
+		return
+	}
+	if _, ok := models.FindPaymentMethod(req.PaymentMethod); req.PaymentMethod != "" && !ok {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid payment method, use "+strings.Join(paymentCodes(), ", "))
+		return
+	}
+
+	// Merge duplicate lines so each product or variant is locked and decremented once
+	order := models.Order{
+		ID:            generateOrderID(),
+		CustomerID:    req.CustomerID,
+		VoucherCode:   models.NormalizeVoucherCode(req.VoucherCode),
+		PaymentMethod: req.PaymentMethod,
+	}
+	type lineKey struct {
+		productID string
+		variantID int
+	}
+	lines := make(map[lineKey]int)
+	for _, item := range req.Items {
+		if item.ProductID == "" || item.Quantity <= 0 || item.VariantID < 0 {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Each item needs a product ID and a positive quantity")
+			return
+		}
+		key := lineKey{item.ProductID, item.VariantID}
+		if i, ok := lines[key]; ok {
+			order.Items[i].Quantity += item.Quantity
+			continue
+		}
+		lines[key] = len(order.Items)
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	err = c.Orders.Create(r.Context(), &order, c.Pricing, actorOf(r))
+	var stockErr *repositories.StockError
+	var voucherErr *repositories.VoucherError
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Customer not found")
+		return
+	case errors.As(err, &stockErr):
+		writeStockError(w, stockErr)
+		return
+	case errors.As(err, &voucherErr):
+		writeVoucherRejection(w, voucherErr.Reason, voucherErr.Voucher, voucherErr.Subtotal)
+		return
+	case errors.Is(err, repositories.ErrInsufficientBalance):
+		utils.ErrorResponse(w, http.StatusConflict, "Your balance does not cover the order total")
+		return
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create order")
+		return
+	}
+
+	utils.CreatedResponse(w, "Order created successfully", order)
+}
+
+// writeStockError - Unknown products or variants and missing variant
+// choices are a bad request, shortages a conflict
+func writeStockError(w http.ResponseWriter, stockErr *repositories.StockError) {
+	if len(stockErr.Missing) > 0 {
+		utils.ErrorResponseWithData(w, http.StatusBadRequest, "Some products do not exist", map[string]interface{}{
+			"product_ids": stockErr.Missing,
+		})
+		return
+	}
+	if len(stockErr.MissingVariants) > 0 {
+		utils.ErrorResponseWithData(w, http.StatusBadRequest, "Some variants do not exist", map[string]interface{}{
+			"variant_ids": stockErr.MissingVariants,
+		})
+		return
+	}
+	if len(stockErr.NeedsVariant) > 0 {
+		utils.ErrorResponseWithData(w, http.StatusBadRequest, "Choose a variant for these products", map[string]interface{}{
+			"product_ids": stockErr.NeedsVariant,
+		})
+		return
+	}
+
+	ids := make([]string, len(stockErr.Shortages))
+	for i, s := range stockErr.Shortages {
+		ids[i] = s.ProductID
+	}
+	utils.ErrorResponseWithData(w, http.StatusConflict, "Insufficient stock", map[string]interface{}{
+		"product_ids": ids,
+		"shortages":   stockErr.Shortages,
+	})
+}
+
+// generateOrderID - Build an order ID like ORD-20240115-9F2C1A7B
+func generateOrderID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("ORD-%s-%s", time.Now().Format("20060102"), strings.ToUpper(hex.EncodeToString(b)))
+}
+
+// GetAllOrders - GET /api/admin/orders?status=to_pay&range=30d&q=keyword&customer_id=1
+func (c *OrderController) GetAllOrders(w http.ResponseWriter, r *http.Request) {
+	c.listOrders(w, r, 0)
+}
+
+// GetMyOrders - GET /api/orders?status=to_pay&range=30d&q=keyword
+func (c *OrderController) GetMyOrders(w http.ResponseWriter, r *http.Request) {
+	callerID, _ := middlewares.UserID(r)
+	c.listOrders(w, r, callerID)
+}
+
+// GetUserOrders - GET /api/users/{id}/orders
+func (c *OrderController) GetUserOrders(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if !middlewares.CanAccessUser(r, id, models.PermManageOrders) {
+		utils.ErrorResponse(w, http.StatusForbidden, "You can only view your own orders")
+		return
+	}
+
+	c.listOrders(w, r, id)
+}
+
+// GetOrderByID - GET /api/orders/{id}
+func (c *OrderController) GetOrderByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	order, ok := c.loadOrder(w, r, id)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(w, "Order fetched successfully", order)
+}
+
+// loadOrder - Fetch an order the caller may see. Orders of other customers
+// answer 404 as if they did not exist, so order IDs cannot be probed.
+func (c *OrderController) loadOrder(w http.ResponseWriter, r *http.Request, id string) (models.Order, bool) {
+	order, err := c.Orders.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) ||
+		(err == nil && !middlewares.CanAccessUser(r, order.CustomerID, models.PermManageOrders)) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return order, false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order")
+		return order, false
+	}
+	return order, true
+}
+
+// listOrders - Shared handler for the order list and per-customer history.
+// The badge counts honour the date range and search but not the status tab,
+// so every tab shows how many orders it would contain.
+func (c *OrderController) listOrders(w http.ResponseWriter, r *http.Request, customerID int) {
+	params := r.URL.Query()
+	filter := repositories.OrderFilter{
+		CustomerID: customerID,
+		Query:      strings.TrimSpace(params.Get("q")),
+	}
+
+	if customerID == 0 {
+		if raw := params.Get("customer_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil {
+				utils.ErrorResponse(w, http.StatusBadRequest, "Invalid customer ID")
+				return
+			}
+			filter.CustomerID = id
+		}
+	}
+
+	since, ok := orderRangeStart(params.Get("range"))
+	if !ok {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid range, use 30d, 3mo, 6mo or all")
+		return
+	}
+	filter.Since = since
+
+	if tab := params.Get("status"); tab != "" && tab != "all" {
+		statuses, ok := models.OrderStatusTabs[tab]
+		if !ok {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid status tab")
+			return
+		}
+		filter.Statuses = statuses
+	}
+
+	orders, perStatus, err := c.Orders.List(r.Context(), filter)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch orders")
+		return
+	}
+
+	// Badge counts per status tab
+	counts := map[string]int{"all": 0}
+	for _, n := range perStatus {
+		counts["all"] += n
+	}
+	for tab, statuses := range models.OrderStatusTabs {
+		counts[tab] = 0
+		for _, s := range statuses {
+			counts[tab] += perStatus[s]
+		}
+	}
+
+	utils.SuccessResponse(w, "Orders fetched successfully", models.OrderListResponse{
+		Orders: orders,
+		Counts: counts,
+	})
+}
+
+// orderRangeStart - Translate a date range filter into its start time.
+// A zero time means no lower bound.
+func orderRangeStart(value string) (time.Time, bool) {
+	now := time.Now()
+	switch value {
+	case "", "all":
+		return time.Time{}, true
+	case "30d":
+		return now.AddDate(0, 0, -30), true
+	case "3mo":
+		return now.AddDate(0, -3, 0), true
+	case "6mo":
+		return now.AddDate(0, -6, 0), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,193 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// voucher - Store an active public voucher taking amount off, usable once
+func (a *testAPI) voucher(code string, amount int) models.Voucher {
+	a.t.Helper()
+	voucher := models.Voucher{
+		Code:         code,
+		Name:         "Voucher " + code,
+		Type:         models.VoucherFixed,
+		Value:        amount,
+		StartsAt:     time.Now().Add(-time.Hour),
+		ExpiresAt:    time.Now().Add(24 * time.Hour),
+		UsageLimit:   1,
+		PerUserLimit: 1,
+		IsPublic:     true,
+		IsActive:     true,
+	}
+	if err := a.repos.Vouchers.Create(a.ctx, &voucher); err != nil {
+		a.t.Fatal(err)
+	}
+	return voucher
+}
+
+// usedCount - How many times the voucher has been redeemed
+func (a *testAPI) usedCount(voucher models.Voucher) int {
+	a.t.Helper()
+	stored, err := a.repos.Vouchers.GetByID(a.ctx, voucher.ID, 0)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return stored.UsedCount
+}
+
+// placeOrder - Order quantity of the product for the holder of token
+func (a *testAPI) placeOrder(token, productID string, quantity int, voucherCode, payment string) apiResponse {
+	a.t.Helper()
+	return a.call("POST", "/api/orders", token, map[string]interface{}{
+		"items":          []map[string]interface{}{{"product_id": productID, "quantity": quantity}},
+		"voucher_code":   voucherCode,
+		"payment_method": payment,
+	})
+}
+
+func TestOrderPlaceAndCancelRoundTrip(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	voucher := api.voucher("HEMAT", 2000)
+	customer, token := api.user("c@example.com", models.RoleCustomer, 50000)
+
+	var order models.Order
+	api.placeOrder(token, "P1", 2, "hemat", models.PaymentBalance).expect(t, http.StatusCreated).decode(t, &order)
+
+	if order.Total != 18000 || order.BalancePaid != 18000 || order.Status != models.OrderStatusPaid {
+		t.Fatalf("order total %d, balance paid %d, status %s", order.Total, order.BalancePaid, order.Status)
+	}
+	if got := api.stock("P1"); got != 3 {
+		t.Errorf("stock after order = %d, want 3", got)
+	}
+	if got := api.balance(customer.ID); got != 32000 {
+		t.Errorf("balance after order = %d, want 32000", got)
+	}
+	if got := api.usedCount(voucher); got != 1 {
+		t.Errorf("voucher used %d times, want 1", got)
+	}
+
+	var cancelled struct {
+		Refunded int `json:"refunded"`
+	}
+	api.call("POST", "/api/orders/"+order.ID+"/cancel", token, nil).expect(t, http.StatusOK).decode(t, &cancelled)
+
+	if cancelled.Refunded != 18000 {
+		t.Errorf("refunded %d, want 18000", cancelled.Refunded)
+	}
+	if got := api.stock("P1"); got != 5 {
+		t.Errorf("stock after cancel = %d, want 5", got)
+	}
+	if got := api.balance(customer.ID); got != 50000 {
+		t.Errorf("balance after cancel = %d, want 50000", got)
+	}
+	if got := api.usedCount(voucher); got != 0 {
+		t.Errorf("voucher used %d times after cancel, want 0", got)
+	}
+
+	// A cancelled order stays cancelled and refunds once
+	api.call("POST", "/api/orders/"+order.ID+"/cancel", token, nil).expect(t, http.StatusConflict)
+	if got := api.balance(customer.ID); got != 50000 {
+		t.Errorf("balance after second cancel = %d, want 50000", got)
+	}
+}
+
+func TestOrderRefusedWhenBalanceFallsShort(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	customer, token := api.user("c@example.com", models.RoleCustomer, 15000)
+
+	api.placeOrder(token, "P1", 2, "", models.PaymentBalance).expect(t, http.StatusConflict)
+
+	if got := api.stock("P1"); got != 5 {
+		t.Errorf("stock = %d, want 5", got)
+	}
+	if got := api.balance(customer.ID); got != 15000 {
+		t.Errorf("balance = %d, want 15000", got)
+	}
+}
+
+func TestOrderRefusedBeyondStock(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 1)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+
+	api.placeOrder(token, "P1", 2, "", "").expect(t, http.StatusConflict)
+
+	if got := api.stock("P1"); got != 1 {
+		t.Errorf("stock = %d, want 1", got)
+	}
+}
+
+func TestAdminStatusChangesSettleTheOrder(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	customer, token := api.user("c@example.com", models.RoleCustomer, 100000)
+	_, adminToken := api.user("a@example.com", models.RoleAdmin, 0)
+
+	var first, second models.Order
+	api.placeOrder(token, "P1", 2, "", models.PaymentBalance).expect(t, http.StatusCreated).decode(t, &first)
+	api.placeOrder(token, "P1", 1, "", models.PaymentBalance).expect(t, http.StatusCreated).decode(t, &second)
+
+	api.call("PUT", "/api/admin/orders/"+first.ID+"/status", adminToken,
+		map[string]string{"status": models.OrderStatusCancelled}).expect(t, http.StatusOK)
+	if got := api.stock("P1"); got != 4 {
+		t.Errorf("stock after admin cancel = %d, want 4", got)
+	}
+	if got := api.balance(customer.ID); got != 90000 {
+		t.Errorf("balance after admin cancel = %d, want 90000", got)
+	}
+
+	// A refund gives the money back; the goods stay sold
+	api.call("PUT", "/api/admin/orders/"+second.ID+"/status", adminToken,
+		map[string]string{"status": models.OrderStatusRefunded}).expect(t, http.StatusOK)
+	if got := api.stock("P1"); got != 4 {
+		t.Errorf("stock after refund = %d, want 4", got)
+	}
+	if got := api.balance(customer.ID); got != 100000 {
+		t.Errorf("balance after refund = %d, want 100000", got)
+	}
+}
+
+func TestOrderActionsHideOtherCustomersOrders(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	_, owner := api.user("owner@example.com", models.RoleCustomer, 0)
+	_, other := api.user("other@example.com", models.RoleCustomer, 0)
+
+	var order models.Order
+	api.placeOrder(owner, "P1", 1, "", "").expect(t, http.StatusCreated).decode(t, &order)
+
+	for _, action := range []string{"cancel", "confirm", "reorder"} {
+		api.call("POST", "/api/orders/"+order.ID+"/"+action, other, nil).expect(t, http.StatusNotFound)
+	}
+	if got := api.stock("P1"); got != 4 {
+		t.Errorf("stock = %d, want 4", got)
+	}
+}
+
+func TestReorderCapsCartLines(t *testing.T) {
+	api := newTestAPI(t)
+	api.product("P1", 10000, 5)
+	_, token := api.user("c@example.com", models.RoleCustomer, 0)
+
+	var order models.Order
+	api.placeOrder(token, "P1", 2, "", "").expect(t, http.StatusCreated).decode(t, &order)
+	api.call("POST", "/api/cart/items", token, map[string]interface{}{"product_id": "P1", "quantity": 2}).
+		expect(t, http.StatusCreated)
+
+	var lines []models.ReorderLine
+	api.call("POST", "/api/orders/"+order.ID+"/reorder", token, nil).expect(t, http.StatusOK).decode(t, &lines)
+
+	if len(lines) != 1 || !lines[0].LowStock {
+		t.Fatalf("reorder lines = %+v, want one low_stock line", lines)
+	}
+	items := api.cart(token)
+	if len(items) != 1 || items[0].Quantity != 3 {
+		t.Fatalf("cart = %+v, want one line of 3 (the stock left)", items)
+	}
+}
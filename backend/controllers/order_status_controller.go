@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// UpdateOrderStatus - PUT /api/admin/orders/{id}/status
+func (c *OrderController) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req models.OrderStatusUpdateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !models.IsValidOrderStatus(req.Status) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Unknown order status")
+		return
+	}
+
+	// Cancelling and refunding also give back stock, the voucher use and
+	// the balance paid
+	refunded := 0
+	switch req.Status {
+	case models.OrderStatusCancelled:
+		refunded, err = c.Orders.Cancel(r.Context(), id, actorOf(r), req.Note)
+	case models.OrderStatusRefunded:
+		refunded, err = c.Orders.Refund(r.Context(), id, actorOf(r), req.Note)
+	default:
+		err = c.Orders.Transition(r.Context(), id, req.Status, actorOf(r), req.Note)
+	}
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	utils.SuccessResponse(w, "Order status updated successfully", map[string]interface{}{
+		"id":       id,
+		"status":   req.Status,
+		"refunded": refunded,
+	})
+}
+
+// GetOrderTimeline - GET /api/orders/{id}/timeline
+func (c *OrderController) GetOrderTimeline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	order, ok := c.loadOrder(w, r, id)
+	if !ok {
+		return
+	}
+
+	events, err := c.Orders.Events(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order events")
+		return
+	}
+
+	utils.SuccessResponse(w, "Order timeline fetched successfully", models.OrderTimeline{
+		OrderID: id,
+		Status:  order.Status,
+		Steps:   buildTimelineSteps(order.Status, order.CreatedAt, events),
+		Events:  events,
+	})
+}
+
+// actorOf - Actor recorded on order events for the authenticated user, e.g. "customer:12"
+func actorOf(r *http.Request) string {
+	id, ok := middlewares.UserID(r)
+	if !ok {
+		return "system"
+	}
+	return fmt.Sprintf("%s:%d", middlewares.Role(r), id)
+}
+
+// writeTransitionError - Map transition errors onto HTTP responses
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var invalid *repositories.TransitionError
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Order not found")
+	case errors.As(err, &invalid):
+		utils.ErrorResponse(w, http.StatusConflict, invalid.Error())
+	default:
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update order status")
+	}
+}
+
+// buildTimelineSteps - Turn the recorded events into the steps shown in the
+// order details modal. Cancelled and refunded orders show the happy path up to
+// the last status they reached, followed by the terminal status.
+func buildTimelineSteps(status string, createdAt time.Time, events []models.OrderEvent) []models.OrderTimelineStep {
+	reachedAt := map[string]time.Time{
+		models.OrderStatusPendingPayment: createdAt,
+	}
+	for _, event := range events {
+		reachedAt[models.NormalizeOrderStatus(event.ToStatus)] = event.CreatedAt
+	}
+
+	flowIndex := func(s string) int {
+		for i, step := range models.OrderStatusFlow {
+			if step == s {
+				return i
+			}
+		}
+		return -1
+	}
+
+	last := flowIndex(status)
+	terminal := last < 0
+	if terminal {
+		for s := range reachedAt {
+			if i := flowIndex(s); i > last {
+				last = i
+			}
+		}
+	}
+
+	var steps []models.OrderTimelineStep
+	for i, s := range models.OrderStatusFlow {
+		if terminal && i > last {
+			break
+		}
+		step := models.OrderTimelineStep{
+			Status:    s,
+			Label:     models.OrderStatusLabels[s],
+			Completed: i <= last,
+			Current:   !terminal && i == last,
+		}
+		if at, ok := reachedAt[s]; ok && step.Completed {
+			step.At = &at
+		}
+		steps = append(steps, step)
+	}
+
+	if terminal {
+		step := models.OrderTimelineStep{
+			Status:    status,
+			Label:     models.OrderStatusLabels[status],
+			Completed: true,
+			Current:   true,
+		}
+		if at, ok := reachedAt[status]; ok {
+			step.At = &at
+		}
+		steps = append(steps, step)
+	}
+
+	return steps
+}
@@ -2,62 +2,171 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
-	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/search"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/storage"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
 	"github.com/gorilla/mux"
 )
 
-// GetAllProducts - GET /api/products
-func GetAllProducts(w http.ResponseWriter, r *http.Request) {
-	query := `SELECT id, name, price, stock, category, rating, created_at FROM products ORDER BY created_at DESC`
+type ProductController struct {
+	Products   repositories.ProductRepository
+	Categories repositories.CategoryRepository
+	Reviews    repositories.ReviewRepository
+	Search     *search.Index
+	Files      storage.Storage
+}
+
+func NewProductController(products repositories.ProductRepository, categories repositories.CategoryRepository,
+	reviews repositories.ReviewRepository, index *search.Index, files storage.Storage) *ProductController {
+	return &ProductController{Products: products, Categories: categories, Reviews: reviews, Search: index, Files: files}
+}
+
+// Page sizes for paginated lists
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// GetAllProducts - GET /api/products?category=laptop&brand=Asus,Lenovo&min_price=1000000
+// &max_price=5000000&min_rating=4&in_stock=true&sort=price_asc&page=1&limit=20
+func (c *ProductController) GetAllProducts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter, ok := c.productFilter(w, r, params)
+	if !ok {
+		return
+	}
+
+	filter.Sort = params.Get("sort")
+	if filter.Sort == "" {
+		filter.Sort = repositories.SortNewest
+	}
+	if !containsString(repositories.ProductSorts, filter.Sort) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid sort, use "+strings.Join(repositories.ProductSorts, ", "))
+		return
+	}
+
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
 
-	rows, err := config.DB.Query(query)
+	products, total, err := c.Products.List(r.Context(), filter)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch products")
 		return
 	}
-	defer rows.Close()
 
-	var products []models.Product
-	for rows.Next() {
-		var product models.Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.Stock,
-			&product.Category, &product.Rating, &product.CreatedAt)
+	utils.PaginatedResponse(w, "Products fetched successfully", products, utils.NewPagination(page, limit, total))
+}
+
+// GetProductFacets - GET /api/products/facets (same filters as the listing)
+func (c *ProductController) GetProductFacets(w http.ResponseWriter, r *http.Request) {
+	filter, ok := c.productFilter(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	facets, err := c.Products.Facets(r.Context(), filter)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch facets")
+		return
+	}
+
+	utils.SuccessResponse(w, "Facets fetched successfully", facets)
+}
+
+// productFilter - Read the listing filters, answering 400 when one is
+// invalid and 404 for an unknown category. A category matches its
+// subcategories' products too.
+func (c *ProductController) productFilter(w http.ResponseWriter, r *http.Request, params url.Values) (repositories.ProductFilter, bool) {
+	filter := repositories.ProductFilter{}
+	if v := strings.TrimSpace(params.Get("category")); v != "" {
+		// Slugify accepts category names too, as links from before the tree used them
+		category, err := c.Categories.GetBySlug(r.Context(), models.Slugify(v))
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Category not found")
+			return filter, false
+		}
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch category")
+			return filter, false
+		}
+		categories, err := c.Categories.List(r.Context())
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch category")
+			return filter, false
+		}
+		filter.CategoryIDs = models.CategoryDescendants(categories, category.ID)
+	}
+	for _, brand := range strings.Split(params.Get("brand"), ",") {
+		if brand = strings.TrimSpace(brand); brand != "" {
+			filter.Brands = append(filter.Brands, brand)
+		}
+	}
+
+	var err error
+	if filter.MinPrice, err = intParam(params, "min_price"); err != nil || filter.MinPrice < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid min_price")
+		return filter, false
+	}
+	if filter.MaxPrice, err = intParam(params, "max_price"); err != nil || filter.MaxPrice < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid max_price")
+		return filter, false
+	}
+	if filter.MaxPrice > 0 && filter.MinPrice > filter.MaxPrice {
+		utils.ErrorResponse(w, http.StatusBadRequest, "min_price must not exceed max_price")
+		return filter, false
+	}
+
+	if v := params.Get("min_rating"); v != "" {
+		filter.MinRating, err = strconv.ParseFloat(v, 64)
+		if err != nil || filter.MinRating < 0 || filter.MinRating > 5 {
+			utils.ErrorResponse(w, http.StatusBadRequest, "min_rating must be between 0 and 5")
+			return filter, false
+		}
+	}
+
+	if v := params.Get("in_stock"); v != "" {
+		filter.InStock, err = strconv.ParseBool(v)
 		if err != nil {
-			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to scan product")
-			return
+			utils.ErrorResponse(w, http.StatusBadRequest, "in_stock must be true or false")
+			return filter, false
 		}
-		products = append(products, product)
 	}
 
-	utils.SuccessResponse(w, "Products fetched successfully", products)
+	return filter, true
 }
 
 // GetProductByID - GET /api/products/{id}
-func GetProductByID(w http.ResponseWriter, r *http.Request) {
+func (c *ProductController) GetProductByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	query := `SELECT id, name, price, stock, category, rating, created_at FROM products WHERE id = ?`
-
-	var product models.Product
-	err := config.DB.QueryRow(query, id).Scan(
-		&product.ID, &product.Name, &product.Price, &product.Stock,
-		&product.Category, &product.Rating, &product.CreatedAt,
-	)
-	if err != nil {
+	product, err := c.Products.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
 		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch product")
+		return
+	}
 
 	utils.SuccessResponse(w, "Product fetched successfully", product)
 }
 
-// CreateProduct - POST /api/products
-func CreateProduct(w http.ResponseWriter, r *http.Request) {
+// CreateProduct - POST /api/admin/products
+func (c *ProductController) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var req models.ProductCreateRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -70,19 +179,41 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 		utils.ErrorResponse(w, http.StatusBadRequest, "ID, name, and price are required")
 		return
 	}
+	if msg := cleanProductContent(&req.ProductContent); msg != "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+	categoryName, ok := c.categoryName(w, r, req.CategoryID)
+	if !ok {
+		return
+	}
+
+	product := models.Product{
+		ID:         req.ID,
+		Name:       req.Name,
+		Price:      req.Price,
+		Stock:      req.Stock,
+		CategoryID: req.CategoryID,
+		Category:   categoryName,
+	}
+	req.ProductContent.Apply(&product)
 
-	query := `INSERT INTO products (id, name, price, stock, category, rating) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err = config.DB.Exec(query, req.ID, req.Name, req.Price, req.Stock, req.Category, req.Rating)
+	err = c.Products.Create(r.Context(), &product)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		utils.ErrorResponse(w, http.StatusConflict, "Product ID already exists")
+		return
+	}
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create product")
 		return
 	}
+	c.Search.Add(product)
 
-	utils.CreatedResponse(w, "Product created successfully", req)
+	utils.CreatedResponse(w, "Product created successfully", product)
 }
 
-// UpdateProduct - PUT /api/products/{id}
-func UpdateProduct(w http.ResponseWriter, r *http.Request) {
+// UpdateProduct - PUT /api/admin/products/{id}
+func (c *ProductController) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -92,75 +223,440 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-
-	query := `UPDATE products SET name = ?, price = ?, stock = ?, category = ?, rating = ? WHERE id = ?`
-	result, err := config.DB.Exec(query, req.Name, req.Price, req.Stock, req.Category, req.Rating, id)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update product")
+	if msg := cleanProductContent(&req.ProductContent); msg != "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+	if _, ok := c.categoryName(w, r, req.CategoryID); !ok {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	err = c.Products.Update(r.Context(), id, req)
+	if errors.Is(err, repositories.ErrNotFound) {
 		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+
+	c.reindex(r, id)
 
 	utils.SuccessResponse(w, "Product updated successfully", nil)
 }
 
-// DeleteProduct - DELETE /api/products/{id}
-func DeleteProduct(w http.ResponseWriter, r *http.Request) {
+// DeleteProduct - DELETE /api/admin/products/{id}
+func (c *ProductController) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	query := `DELETE FROM products WHERE id = ?`
-	result, err := config.DB.Exec(query, id)
+	// The gallery and review rows go with the product; their files are
+	// removed afterwards
+	product, err := c.Products.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete product")
+		return
+	}
+	reviews, _, err := c.Reviews.List(r.Context(), repositories.ReviewFilter{ProductID: id, WithImages: true})
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete product")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	err = c.Products.Delete(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
 		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
 		return
 	}
+	if errors.Is(err, repositories.ErrInUse) {
+		utils.ErrorResponse(w, http.StatusConflict, "This product has been ordered, set its stock to 0 instead")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete product")
+		return
+	}
+	c.Search.Remove(id)
+	for _, image := range product.Images {
+		deleteImageFiles(r.Context(), c.Files, image.Key)
+	}
+	for _, review := range reviews {
+		deleteReviewImages(r, c.Files, review)
+	}
 
 	utils.SuccessResponse(w, "Product deleted successfully", nil)
 }
 
-// SearchProducts - GET /api/products/search?q=keyword
-func SearchProducts(w http.ResponseWriter, r *http.Request) {
-	keyword := r.URL.Query().Get("q")
+// categoryName - Name of the category a product is assigned to, answering
+// 400 when it does not exist
+func (c *ProductController) categoryName(w http.ResponseWriter, r *http.Request, id *int) (string, bool) {
+	if id == nil {
+		return "", true
+	}
+	category, err := c.Categories.GetByID(r.Context(), *id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Category not found")
+		return "", false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch category")
+		return "", false
+	}
+	return category.Name, true
+}
+
+// Limits of the product content
+const (
+	maxTags     = 10
+	maxTagLen   = 30
+	maxFeatures = 20
+	maxBrandLen = 100
+)
+
+// cleanProductContent - Trim the content, drop empty entries and lowercase
+// and deduplicate tags. Returns a message when something is invalid.
+func cleanProductContent(content *models.ProductContent) string {
+	content.Brand = strings.TrimSpace(content.Brand)
+	if len(content.Brand) > maxBrandLen {
+		return "Brand must be at most " + strconv.Itoa(maxBrandLen) + " characters"
+	}
+	content.Description = strings.TrimSpace(content.Description)
+
+	features := []string{}
+	for _, f := range content.Features {
+		if f = strings.TrimSpace(f); f != "" {
+			features = append(features, f)
+		}
+	}
+	if len(features) > maxFeatures {
+		return "At most " + strconv.Itoa(maxFeatures) + " features"
+	}
+	content.Features = features
+
+	specs := []models.SpecGroup{}
+	for _, group := range content.Specs {
+		group.Name = strings.TrimSpace(group.Name)
+		items := []models.SpecItem{}
+		for _, item := range group.Items {
+			item.Label, item.Value = strings.TrimSpace(item.Label), strings.TrimSpace(item.Value)
+			if item.Label == "" || item.Value == "" {
+				return "Each specification needs a label and a value"
+			}
+			items = append(items, item)
+		}
+		if group.Name == "" || len(items) == 0 {
+			return "Each specification group needs a name and at least one item"
+		}
+		group.Items = items
+		specs = append(specs, group)
+	}
+	content.Specs = specs
+
+	tags := []string{}
+	for _, tag := range content.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || containsString(tags, tag) {
+			continue
+		}
+		if len(tag) > maxTagLen {
+			return "Tags must be at most " + strconv.Itoa(maxTagLen) + " characters"
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return "At most " + strconv.Itoa(maxTags) + " tags"
+	}
+	content.Tags = tags
+
+	return ""
+}
+
+// CreateVariant - POST /api/admin/products/{id}/variants
+func (c *ProductController) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+
+	variant, ok := c.decodeVariant(w, r, productID, 0)
+	if !ok {
+		return
+	}
+
+	err := c.Products.CreateVariant(r.Context(), &variant)
+	if !writeVariantError(w, err, "Failed to create variant") {
+		return
+	}
+	c.reindex(r, productID)
+
+	utils.CreatedResponse(w, "Variant created successfully", variant)
+}
+
+// UpdateVariant - PUT /api/admin/products/{id}/variants/{variantId}
+func (c *ProductController) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID := vars["id"]
+	variantID, err := strconv.Atoi(vars["variantId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+
+	variant, ok := c.decodeVariant(w, r, productID, variantID)
+	if !ok {
+		return
+	}
+	variant.ID = variantID
+
+	err = c.Products.UpdateVariant(r.Context(), variant)
+	if !writeVariantError(w, err, "Failed to update variant") {
+		return
+	}
+	c.reindex(r, productID)
+
+	utils.SuccessResponse(w, "Variant updated successfully", variant)
+}
+
+// DeleteVariant - DELETE /api/admin/products/{id}/variants/{variantId}
+func (c *ProductController) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID := vars["id"]
+	variantID, err := strconv.Atoi(vars["variantId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid variant ID")
+		return
+	}
+
+	err = c.Products.DeleteVariant(r.Context(), productID, variantID)
+	if !writeVariantError(w, err, "Failed to delete variant") {
+		return
+	}
+	c.reindex(r, productID)
+
+	utils.SuccessResponse(w, "Variant deleted successfully", nil)
+}
+
+// decodeVariant - Read and validate a variant body for the product. The
+// option combination must not repeat another variant's (other than
+// exceptID) and every variant of a product must use the same option names.
+func (c *ProductController) decodeVariant(w http.ResponseWriter, r *http.Request, productID string, exceptID int) (models.ProductVariant, bool) {
+	var req models.ProductVariantRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return models.ProductVariant{}, false
+	}
+
+	// Validation
+	req.SKU = strings.TrimSpace(req.SKU)
+	if req.SKU == "" || len(req.Options) == 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "SKU and at least one option are required")
+		return models.ProductVariant{}, false
+	}
+	names := make(map[string]bool)
+	for i, o := range req.Options {
+		o.Name, o.Value = strings.TrimSpace(o.Name), strings.TrimSpace(o.Value)
+		if o.Name == "" || o.Value == "" {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Each option needs a name and a value")
+			return models.ProductVariant{}, false
+		}
+		if names[strings.ToLower(o.Name)] {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Option "+o.Name+" is given twice")
+			return models.ProductVariant{}, false
+		}
+		names[strings.ToLower(o.Name)] = true
+		req.Options[i] = o
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Price must be positive")
+		return models.ProductVariant{}, false
+	}
+	if req.Stock < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Stock must not be negative")
+		return models.ProductVariant{}, false
+	}
+
+	product, err := c.Products.GetByID(r.Context(), productID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return models.ProductVariant{}, false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch product")
+		return models.ProductVariant{}, false
+	}
+
+	variant := models.ProductVariant{
+		ProductID:     productID,
+		SKU:           req.SKU,
+		Options:       req.Options,
+		PriceOverride: req.Price,
+		Stock:         req.Stock,
+		Images:        req.Images,
+	}
+	for _, other := range product.Variants {
+		if other.ID == exceptID {
+			continue
+		}
+		if !sameOptionNames(other.Options, variant.Options) {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Variants of a product must use the same options")
+			return models.ProductVariant{}, false
+		}
+		if other.Key() == variant.Key() {
+			utils.ErrorResponse(w, http.StatusConflict, "A variant with these options already exists")
+			return models.ProductVariant{}, false
+		}
+	}
+
+	variant.Price = product.Price
+	if variant.PriceOverride != nil {
+		variant.Price = *variant.PriceOverride
+	}
+	variant.InStock = variant.Stock > 0
+	return variant, true
+}
+
+// writeVariantError - Answer for a failed variant write, false when it
+// answered
+func writeVariantError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Variant not found")
+		return false
+	case errors.Is(err, repositories.ErrDuplicate):
+		utils.ErrorResponse(w, http.StatusConflict, "SKU already exists")
+		return false
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, message)
+		return false
+	}
+	return true
+}
+
+// reindex - Refresh the search entry of a product after its variants change
+func (c *ProductController) reindex(r *http.Request, productID string) {
+	if product, err := c.Products.GetByID(r.Context(), productID); err == nil {
+		c.Search.Add(product)
+	}
+}
+
+func sameOptionNames(a, b []models.VariantOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	names := make(map[string]bool, len(a))
+	for _, o := range a {
+		names[strings.ToLower(o.Name)] = true
+	}
+	for _, o := range b {
+		if !names[strings.ToLower(o.Name)] {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchProducts - GET /api/products/search?q=keyword&page=1&limit=20
+func (c *ProductController) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	keyword := strings.TrimSpace(params.Get("q"))
 	if keyword == "" {
 		utils.ErrorResponse(w, http.StatusBadRequest, "Search keyword is required")
 		return
 	}
 
-	query := `SELECT id, name, price, stock, category, rating, created_at 
-              FROM products 
-              WHERE name LIKE ? OR category LIKE ?
-              ORDER BY rating DESC`
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+
+	hits, total := c.Search.Search(keyword, (page-1)*limit, limit)
 
-	searchPattern := "%" + keyword + "%"
-	rows, err := config.DB.Query(query, searchPattern, searchPattern)
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ProductID
+	}
+	products, err := c.Products.GetMany(r.Context(), ids)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to search products")
 		return
 	}
-	defer rows.Close()
 
-	var products []models.Product
-	for rows.Next() {
-		var product models.Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.Stock,
-			&product.Category, &product.Rating, &product.CreatedAt)
-		if err != nil {
-			continue
+	byID := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	results := []models.ProductSearchResult{}
+	for _, hit := range hits {
+		if p, ok := byID[hit.ProductID]; ok {
+			results = append(results, models.ProductSearchResult{
+				Product:   p,
+				Score:     hit.Score,
+				Highlight: hit.Highlight,
+			})
 		}
-		products = append(products, product)
 	}
 
-	utils.SuccessResponse(w, "Search completed", products)
+	utils.PaginatedResponse(w, "Search completed", results, utils.NewPagination(page, limit, total))
+}
+
+// AutocompleteProducts - GET /api/products/autocomplete?q=lapt&limit=8
+func (c *ProductController) AutocompleteProducts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	limit, err := intParam(params, "limit")
+	if err != nil || limit < 0 || limit > 20 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 20")
+		return
+	}
+	if limit == 0 {
+		limit = 8
+	}
+
+	utils.SuccessResponse(w, "Suggestions fetched successfully", c.Search.Suggest(params.Get("q"), limit))
+}
+
+// pageParams - Read page (from 1) and limit (up to maxPageLimit), answering
+// 400 when either is invalid
+func pageParams(w http.ResponseWriter, params url.Values) (int, int, bool) {
+	page, err := intParam(params, "page")
+	if err != nil || page < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid page")
+		return 0, 0, false
+	}
+	if page == 0 {
+		page = 1
+	}
+
+	limit, err := intParam(params, "limit")
+	if err != nil || limit < 0 || limit > maxPageLimit {
+		utils.ErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+		return 0, 0, false
+	}
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+
+	return page, limit, true
+}
+
+// intParam - Integer query parameter, 0 when absent
+func intParam(params url.Values, key string) (int, error) {
+	v := params.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
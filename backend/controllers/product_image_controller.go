@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/media"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/storage"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type ProductImageController struct {
+	Products    repositories.ProductRepository
+	Images      repositories.ProductImageRepository
+	Files       storage.Storage
+	MaxFileSize int64
+	MaxFiles    int
+}
+
+func NewProductImageController(products repositories.ProductRepository, images repositories.ProductImageRepository,
+	files storage.Storage, maxFileSize int64, maxFiles int) *ProductImageController {
+	return &ProductImageController{
+		Products:    products,
+		Images:      images,
+		Files:       files,
+		MaxFileSize: maxFileSize,
+		MaxFiles:    maxFiles,
+	}
+}
+
+// upload - A file of the request that passed inspection
+type upload struct {
+	data []byte
+	info media.Info
+}
+
+// UploadImages - POST /api/products/{id}/images (multipart, one or more
+// files in the "images" field). Images are appended to the gallery.
+func (c *ProductImageController) UploadImages(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+	if !c.productExists(w, r, productID) {
+		return
+	}
+
+	uploads, ok := readImages(w, r, c.MaxFileSize, c.MaxFiles, true)
+	if !ok {
+		return
+	}
+
+	images := []models.ProductImage{}
+	for _, u := range uploads {
+		image, err := c.store(r.Context(), productID, u)
+		if errors.Is(err, repositories.ErrNotFound) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+			return
+		}
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store image")
+			return
+		}
+		images = append(images, image)
+	}
+
+	utils.CreatedResponse(w, "Images uploaded successfully", images)
+}
+
+// GetImages - GET /api/products/{id}/images
+func (c *ProductImageController) GetImages(w http.ResponseWriter, r *http.Request) {
+	product, err := c.Products.GetByID(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch images")
+		return
+	}
+
+	utils.SuccessResponse(w, "Images fetched successfully", product.Images)
+}
+
+// ReorderImages - PUT /api/products/{id}/images/order
+func (c *ProductImageController) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+
+	var req models.ProductImageOrderRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !c.productExists(w, r, productID) {
+		return
+	}
+
+	err = c.Images.Reorder(r.Context(), productID, req.ImageIDs)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "image_ids must list every image of the product once")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to reorder images")
+		return
+	}
+
+	c.writeGallery(w, r, productID, "Images reordered successfully")
+}
+
+// SetPrimaryImage - PUT /api/products/{id}/images/{imageId}/primary
+func (c *ProductImageController) SetPrimaryImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imageParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.Images.SetPrimary(r.Context(), productID, imageID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Image not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to set primary image")
+		return
+	}
+
+	c.writeGallery(w, r, productID, "Primary image updated successfully")
+}
+
+// DeleteImage - DELETE /api/products/{id}/images/{imageId}
+func (c *ProductImageController) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imageParams(w, r)
+	if !ok {
+		return
+	}
+
+	image, err := c.Images.Delete(r.Context(), productID, imageID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Image not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete image")
+		return
+	}
+	deleteImageFiles(r.Context(), c.Files, image.Key)
+
+	utils.SuccessResponse(w, "Image deleted successfully", nil)
+}
+
+// store - Save the original and its thumbnails, then add the image to the
+// gallery. Files are removed again when anything fails.
+func (c *ProductImageController) store(ctx context.Context, productID string, u upload) (models.ProductImage, error) {
+	key, thumbnails, err := putImage(ctx, c.Files, "products", u)
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+
+	image := models.ProductImage{
+		ProductID:   productID,
+		Key:         key,
+		URL:         c.Files.URL(key),
+		Thumbnails:  thumbnails,
+		ContentType: u.info.ContentType,
+		Width:       u.info.Width,
+		Height:      u.info.Height,
+		Size:        int64(len(u.data)),
+	}
+	if err := c.Images.Add(ctx, &image); err != nil {
+		deleteImageFiles(ctx, c.Files, key)
+		return image, err
+	}
+	return image, nil
+}
+
+// productExists - Answers 404 or 500 and returns false when the product
+// cannot be found
+func (c *ProductImageController) productExists(w http.ResponseWriter, r *http.Request, productID string) bool {
+	_, err := c.Products.GetByID(r.Context(), productID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch product")
+		return false
+	}
+	return true
+}
+
+// writeGallery - Answer with the product's gallery after a change
+func (c *ProductImageController) writeGallery(w http.ResponseWriter, r *http.Request, productID, message string) {
+	images, err := c.Images.List(r.Context(), productID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch images")
+		return
+	}
+	utils.SuccessResponse(w, message, images)
+}
+
+func imageParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	vars := mux.Vars(r)
+	imageID, err := strconv.Atoi(vars["imageId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid image ID")
+		return "", 0, false
+	}
+	return vars["id"], imageID, true
+}
+
+// readImages - Parse a multipart request and check every file of its
+// "images" field before anything is stored, so a bad file rejects the whole
+// upload. Answers 4xx and returns false when the request or a file is
+// rejected. Other form values stay readable with r.FormValue.
+func readImages(w http.ResponseWriter, r *http.Request, maxFileSize int64, maxFiles int, required bool) ([]upload, bool) {
+	// Room for every file plus the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize*int64(maxFiles)+1<<20)
+	err := r.ParseMultipartForm(8 << 20)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, "Upload too large")
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Expected multipart/form-data with image files")
+		return nil, false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["images"]
+	if required && len(headers) == 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, `At least one image is required in the "images" field`)
+		return nil, false
+	}
+	if len(headers) > maxFiles {
+		utils.ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("At most %d images per upload", maxFiles))
+		return nil, false
+	}
+
+	uploads := make([]upload, 0, len(headers))
+	for _, header := range headers {
+		if header.Size > maxFileSize {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("%s is larger than %d MB", header.Filename, maxFileSize>>20))
+			return nil, false
+		}
+		data, err := readUpload(header)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Failed to read "+header.Filename)
+			return nil, false
+		}
+		info, err := media.Inspect(data)
+		if errors.Is(err, media.ErrUnsupportedType) {
+			utils.ErrorResponse(w, http.StatusUnsupportedMediaType, header.Filename+": "+err.Error())
+			return nil, false
+		}
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, header.Filename+": "+err.Error())
+			return nil, false
+		}
+		uploads = append(uploads, upload{data: data, info: info})
+	}
+	return uploads, true
+}
+
+// putImage - Save an upload and its thumbnails in a new directory under
+// prefix, returning the original's key and the thumbnail URLs by size name.
+// Files are removed again when anything fails.
+func putImage(ctx context.Context, files storage.Storage, prefix string, u upload) (string, map[string]string, error) {
+	decoded, err := media.Decode(u.data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// A random directory per image, so keys never repeat and can be cached forever
+	b := make([]byte, 12)
+	rand.Read(b)
+	key := prefix + "/" + hex.EncodeToString(b) + "/original." + media.Extensions[u.info.ContentType]
+
+	err = files.Put(ctx, key, bytes.NewReader(u.data), u.info.ContentType)
+	if err != nil {
+		return "", nil, err
+	}
+	thumbnails := make(map[string]string)
+	for _, size := range media.ThumbnailSizes {
+		var buf bytes.Buffer
+		if err := decoded.Thumbnail(&buf, size.Size); err != nil {
+			deleteImageFiles(ctx, files, key)
+			return "", nil, err
+		}
+		thumbKey := thumbnailKey(key, size.Name)
+		if err := files.Put(ctx, thumbKey, &buf, "image/jpeg"); err != nil {
+			deleteImageFiles(ctx, files, key)
+			return "", nil, err
+		}
+		thumbnails[size.Name] = files.URL(thumbKey)
+	}
+	return key, thumbnails, nil
+}
+
+func readUpload(header *multipart.FileHeader) ([]byte, error) {
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// thumbnailKey - Thumbnails sit next to the original, e.g.
+// products/3f9a.../medium.jpg
+func thumbnailKey(originalKey, size string) string {
+	return path.Dir(originalKey) + "/" + size + ".jpg"
+}
+
+// deleteImageFiles - Remove an image's original and thumbnails. Failures
+// only leave unreachable files behind, so they are logged, not returned.
+func deleteImageFiles(ctx context.Context, files storage.Storage, originalKey string) {
+	keys := []string{originalKey}
+	for _, size := range media.ThumbnailSizes {
+		keys = append(keys, thumbnailKey(originalKey, size.Name))
+	}
+	for _, key := range keys {
+		if err := files.Delete(ctx, key); err != nil {
+			log.Println("⚠️  Failed to delete", key+":", err)
+		}
+	}
+}
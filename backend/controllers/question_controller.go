@@ -0,0 +1,422 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type QuestionController struct {
+	Products  repositories.ProductRepository
+	Questions repositories.QuestionRepository
+	Orders    repositories.OrderRepository
+}
+
+func NewQuestionController(products repositories.ProductRepository, questions repositories.QuestionRepository,
+	orders repositories.OrderRepository) *QuestionController {
+	return &QuestionController{Products: products, Questions: questions, Orders: orders}
+}
+
+// Limits of a question and an answer
+const (
+	maxQuestionLen = 1000
+	maxAnswerLen   = 2000
+)
+
+// GetQuestions - GET /api/products/{id}/questions?sort=votes&page=1&limit=20
+// (approved questions with their approved answers)
+func (c *QuestionController) GetQuestions(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter := repositories.QuestionFilter{
+		ProductID:    mux.Vars(r)["id"],
+		Status:       models.ModerationApproved,
+		AnswerStatus: models.ModerationApproved,
+		Sort:         params.Get("sort"),
+	}
+	if filter.Sort == "" {
+		filter.Sort = repositories.QuestionSortVotes
+	}
+	if !containsString(repositories.QuestionSorts, filter.Sort) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid sort, use "+strings.Join(repositories.QuestionSorts, ", "))
+		return
+	}
+
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	if !c.productExists(w, r, filter.ProductID) {
+		return
+	}
+	questions, total, err := c.Questions.ListQuestions(r.Context(), filter)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch questions")
+		return
+	}
+
+	utils.PaginatedResponse(w, "Questions fetched successfully", questions, utils.NewPagination(page, limit, total))
+}
+
+// AskQuestion - POST /api/products/{id}/questions. Customers' questions wait
+// for moderation, moderators' are approved right away.
+func (c *QuestionController) AskQuestion(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+	userID, _ := middlewares.UserID(r)
+
+	body, ok := decodeQABody(w, r, maxQuestionLen)
+	if !ok {
+		return
+	}
+
+	question := models.Question{
+		ProductID: productID,
+		UserID:    userID,
+		Body:      body,
+		Status:    initialStatus(r),
+		Answers:   []models.Answer{},
+	}
+	err := c.Questions.CreateQuestion(r.Context(), &question)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create question")
+		return
+	}
+
+	// Read back for the author's name
+	if created, err := c.Questions.GetQuestion(r.Context(), productID, question.ID); err == nil {
+		question = created
+	}
+	utils.CreatedResponse(w, "Question created successfully", question)
+}
+
+// AnswerQuestion - POST /api/products/{id}/questions/{questionId}/answers.
+// The answer is flagged when written by staff or by a customer who bought
+// the product.
+func (c *QuestionController) AnswerQuestion(w http.ResponseWriter, r *http.Request) {
+	productID, questionID, ok := questionParams(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middlewares.UserID(r)
+
+	body, ok := decodeQABody(w, r, maxAnswerLen)
+	if !ok {
+		return
+	}
+
+	if _, ok := c.approvedQuestion(w, r, productID, questionID, "Failed to create answer"); !ok {
+		return
+	}
+	purchased, err := c.Orders.Purchased(r.Context(), userID, productID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create answer")
+		return
+	}
+
+	answer := models.Answer{
+		QuestionID:      questionID,
+		ProductID:       productID,
+		UserID:          userID,
+		Body:            body,
+		Status:          initialStatus(r),
+		IsStaff:         middlewares.Role(r) != models.RoleCustomer,
+		IsVerifiedBuyer: purchased,
+	}
+	err = c.Questions.CreateAnswer(r.Context(), &answer)
+	if !writeQuestionError(w, err, "Failed to create answer") {
+		return
+	}
+
+	if created, err := c.Questions.GetAnswer(r.Context(), questionID, answer.ID); err == nil {
+		answer = created
+	}
+	utils.CreatedResponse(w, "Answer created successfully", answer)
+}
+
+// VoteQuestion - PUT /api/products/{id}/questions/{questionId}/vote
+func (c *QuestionController) VoteQuestion(w http.ResponseWriter, r *http.Request) {
+	productID, questionID, ok := questionParams(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middlewares.UserID(r)
+
+	value, ok := decodeVote(w, r)
+	if !ok {
+		return
+	}
+
+	question, ok := c.approvedQuestion(w, r, productID, questionID, "Failed to update votes")
+	if !ok {
+		return
+	}
+	if question.UserID == userID {
+		utils.ErrorResponse(w, http.StatusBadRequest, "You cannot vote on your own question")
+		return
+	}
+
+	tally, err := c.Questions.VoteQuestion(r.Context(), questionID, userID, value)
+	if !writeQuestionError(w, err, "Failed to update votes") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Votes updated successfully", tally)
+}
+
+// VoteAnswer - PUT /api/products/{id}/questions/{questionId}/answers/{answerId}/vote
+func (c *QuestionController) VoteAnswer(w http.ResponseWriter, r *http.Request) {
+	productID, questionID, ok := questionParams(w, r)
+	if !ok {
+		return
+	}
+	answerID, err := strconv.Atoi(mux.Vars(r)["answerId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid answer ID")
+		return
+	}
+	userID, _ := middlewares.UserID(r)
+
+	value, ok := decodeVote(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := c.approvedQuestion(w, r, productID, questionID, "Failed to update votes"); !ok {
+		return
+	}
+	answer, err := c.Questions.GetAnswer(r.Context(), questionID, answerID)
+	if errors.Is(err, repositories.ErrNotFound) || err == nil && answer.Status != models.ModerationApproved {
+		utils.ErrorResponse(w, http.StatusNotFound, "Answer not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update votes")
+		return
+	}
+	if answer.UserID == userID {
+		utils.ErrorResponse(w, http.StatusBadRequest, "You cannot vote on your own answer")
+		return
+	}
+
+	tally, err := c.Questions.VoteAnswer(r.Context(), answerID, userID, value)
+	if !writeQuestionError(w, err, "Failed to update votes") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Votes updated successfully", tally)
+}
+
+// GetModerationQuestions - GET /api/admin/questions?status=pending&page=1&limit=20
+// (every product, newest first, with all their answers)
+func (c *QuestionController) GetModerationQuestions(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	status, ok := moderationFilter(w, params.Get("status"))
+	if !ok {
+		return
+	}
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+
+	questions, total, err := c.Questions.ListQuestions(r.Context(), repositories.QuestionFilter{
+		Status: status,
+		Sort:   repositories.QuestionSortNewest,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	})
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch questions")
+		return
+	}
+
+	utils.PaginatedResponse(w, "Questions fetched successfully", questions, utils.NewPagination(page, limit, total))
+}
+
+// GetModerationAnswers - GET /api/admin/answers?status=pending&page=1&limit=20
+func (c *QuestionController) GetModerationAnswers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	status, ok := moderationFilter(w, params.Get("status"))
+	if !ok {
+		return
+	}
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+
+	answers, total, err := c.Questions.ListAnswers(r.Context(), repositories.AnswerFilter{
+		Status: status,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	})
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch answers")
+		return
+	}
+
+	utils.PaginatedResponse(w, "Answers fetched successfully", answers, utils.NewPagination(page, limit, total))
+}
+
+// ModerateQuestion - PUT /api/admin/questions/{id}/status
+func (c *QuestionController) ModerateQuestion(w http.ResponseWriter, r *http.Request) {
+	c.moderate(w, r, c.Questions.SetQuestionStatus, "Question")
+}
+
+// ModerateAnswer - PUT /api/admin/answers/{id}/status
+func (c *QuestionController) ModerateAnswer(w http.ResponseWriter, r *http.Request) {
+	c.moderate(w, r, c.Questions.SetAnswerStatus, "Answer")
+}
+
+func (c *QuestionController) moderate(w http.ResponseWriter, r *http.Request,
+	setStatus func(ctx context.Context, id int, status string) error, item string) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid "+strings.ToLower(item)+" ID")
+		return
+	}
+
+	var req models.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !containsString(models.ModerationStatuses, req.Status) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Status must be one of "+strings.Join(models.ModerationStatuses, ", "))
+		return
+	}
+
+	err = setStatus(r.Context(), id, req.Status)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, item+" not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update status")
+		return
+	}
+
+	utils.SuccessResponse(w, item+" status updated successfully", map[string]interface{}{
+		"id":     id,
+		"status": req.Status,
+	})
+}
+
+// approvedQuestion - The question when it is public; answers 404 or 500
+// and returns false otherwise
+func (c *QuestionController) approvedQuestion(w http.ResponseWriter, r *http.Request, productID string, id int,
+	message string) (models.Question, bool) {
+	question, err := c.Questions.GetQuestion(r.Context(), productID, id)
+	if err == nil && question.Status != models.ModerationApproved {
+		err = repositories.ErrNotFound
+	}
+	return question, writeQuestionError(w, err, message)
+}
+
+// productExists - Answers 404 or 500 and returns false when the product
+// cannot be found
+func (c *QuestionController) productExists(w http.ResponseWriter, r *http.Request, productID string) bool {
+	_, err := c.Products.GetByID(r.Context(), productID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch product")
+		return false
+	}
+	return true
+}
+
+// initialStatus - Moderators' posts skip the moderation queue
+func initialStatus(r *http.Request) string {
+	if models.HasPermission(middlewares.Role(r), models.PermModerate) {
+		return models.ModerationApproved
+	}
+	return models.ModerationPending
+}
+
+// decodeQABody - Read and validate the text of a question or answer
+func decodeQABody(w http.ResponseWriter, r *http.Request, maxLen int) (string, bool) {
+	var req models.QuestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return "", false
+	}
+
+	// Validation
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" || utf8.RuneCountInString(req.Body) > maxLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Text is required, up to "+strconv.Itoa(maxLen)+" characters")
+		return "", false
+	}
+	return req.Body, true
+}
+
+func decodeVote(w http.ResponseWriter, r *http.Request) (int, bool) {
+	var req models.VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return 0, false
+	}
+	if req.Value < -1 || req.Value > 1 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Vote must be 1, -1, or 0 to remove it")
+		return 0, false
+	}
+	return req.Value, true
+}
+
+// moderationFilter - Status of a moderation queue, pending by default and
+// "all" for every status
+func moderationFilter(w http.ResponseWriter, status string) (string, bool) {
+	switch {
+	case status == "":
+		return models.ModerationPending, true
+	case status == "all":
+		return "", true
+	case containsString(models.ModerationStatuses, status):
+		return status, true
+	}
+	utils.ErrorResponse(w, http.StatusBadRequest, "Status must be all or one of "+strings.Join(models.ModerationStatuses, ", "))
+	return "", false
+}
+
+func questionParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	vars := mux.Vars(r)
+	questionID, err := strconv.Atoi(vars["questionId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid question ID")
+		return "", 0, false
+	}
+	return vars["id"], questionID, true
+}
+
+// writeQuestionError - Answer for a failed question read or write, false
+// when it answered
+func writeQuestionError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Question not found")
+		return false
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, message)
+		return false
+	}
+	return true
+}
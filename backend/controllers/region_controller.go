@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/regions"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+)
+
+// RegionController - Province list for address forms, served from the
+// bundled region data
+type RegionController struct{}
+
+func NewRegionController() *RegionController {
+	return &RegionController{}
+}
+
+// GetProvinces - GET /api/regions/provinces
+func (c *RegionController) GetProvinces(w http.ResponseWriter, r *http.Request) {
+	utils.SuccessResponse(w, "Provinces fetched successfully", regions.Provinces())
+}
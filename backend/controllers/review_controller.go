@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/search"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/storage"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type ReviewController struct {
+	Products    repositories.ProductRepository
+	Reviews     repositories.ReviewRepository
+	Orders      repositories.OrderRepository
+	Search      *search.Index
+	Files       storage.Storage
+	MaxFileSize int64
+}
+
+func NewReviewController(products repositories.ProductRepository, reviews repositories.ReviewRepository,
+	orders repositories.OrderRepository, index *search.Index, files storage.Storage, maxFileSize int64) *ReviewController {
+	return &ReviewController{
+		Products:    products,
+		Reviews:     reviews,
+		Orders:      orders,
+		Search:      index,
+		Files:       files,
+		MaxFileSize: maxFileSize,
+	}
+}
+
+// Limits of a review
+const (
+	maxReviewLen    = 2000
+	maxReviewImages = 5
+)
+
+// GetReviews - GET /api/products/{id}/reviews?stars=5&with_images=true&sort=helpful&page=1&limit=20
+func (c *ReviewController) GetReviews(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter := repositories.ReviewFilter{ProductID: mux.Vars(r)["id"]}
+
+	var err error
+	filter.Stars, err = intParam(params, "stars")
+	if err != nil || filter.Stars < 0 || filter.Stars > models.MaxReviewRating {
+		utils.ErrorResponse(w, http.StatusBadRequest, "stars must be between 1 and 5")
+		return
+	}
+	if v := params.Get("with_images"); v != "" {
+		filter.WithImages, err = strconv.ParseBool(v)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "with_images must be true or false")
+			return
+		}
+	}
+	filter.Sort = params.Get("sort")
+	if filter.Sort == "" {
+		filter.Sort = repositories.ReviewSortNewest
+	}
+	if !containsString(repositories.ReviewSorts, filter.Sort) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid sort, use "+strings.Join(repositories.ReviewSorts, ", "))
+		return
+	}
+
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	if !c.productExists(w, r, filter.ProductID) {
+		return
+	}
+	reviews, total, err := c.Reviews.List(r.Context(), filter)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch reviews")
+		return
+	}
+
+	utils.PaginatedResponse(w, "Reviews fetched successfully", reviews, utils.NewPagination(page, limit, total))
+}
+
+// GetReviewSummary - GET /api/products/{id}/reviews/summary
+func (c *ReviewController) GetReviewSummary(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+	if !c.productExists(w, r, productID) {
+		return
+	}
+
+	summary, err := c.Reviews.Summary(r.Context(), productID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch rating summary")
+		return
+	}
+
+	utils.SuccessResponse(w, "Rating summary fetched successfully", summary)
+}
+
+// CreateReview - POST /api/products/{id}/reviews (JSON, or multipart with
+// photos in the "images" field)
+func (c *ReviewController) CreateReview(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+	userID, _ := middlewares.UserID(r)
+
+	var req models.ReviewRequest
+	var uploads []upload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		var ok bool
+		uploads, ok = readImages(w, r, c.MaxFileSize, maxReviewImages, false)
+		if !ok {
+			return
+		}
+		req.Body = r.FormValue("body")
+		if v := r.FormValue("rating"); v != "" {
+			rating, err := strconv.Atoi(v)
+			if err != nil {
+				utils.ErrorResponse(w, http.StatusBadRequest, "Rating must be a number")
+				return
+			}
+			req.Rating = rating
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Rating < models.MinReviewRating || req.Rating > models.MaxReviewRating {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Rating must be between 1 and 5")
+		return
+	}
+	if req.Body == "" || utf8.RuneCountInString(req.Body) > maxReviewLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Review text is required, up to "+strconv.Itoa(maxReviewLen)+" characters")
+		return
+	}
+
+	if !c.productExists(w, r, productID) {
+		return
+	}
+	purchased, err := c.Orders.Purchased(r.Context(), userID, productID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create review")
+		return
+	}
+	if !purchased {
+		utils.ErrorResponse(w, http.StatusForbidden, "Only customers with a completed order for this product can review it")
+		return
+	}
+
+	review := models.Review{
+		ProductID: productID,
+		UserID:    userID,
+		Rating:    req.Rating,
+		Body:      req.Body,
+		Images:    []models.ReviewImage{},
+	}
+	for _, u := range uploads {
+		key, thumbnails, err := putImage(r.Context(), c.Files, "reviews", u)
+		if err != nil {
+			deleteReviewImages(r, c.Files, review)
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store image")
+			return
+		}
+		review.Images = append(review.Images, models.ReviewImage{Key: key, URL: c.Files.URL(key), Thumbnails: thumbnails})
+	}
+
+	err = c.Reviews.Create(r.Context(), &review)
+	if err != nil {
+		deleteReviewImages(r, c.Files, review)
+	}
+	switch {
+	case errors.Is(err, repositories.ErrDuplicate):
+		utils.ErrorResponse(w, http.StatusConflict, "You have already reviewed this product")
+		return
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create review")
+		return
+	}
+	c.reindex(r, productID)
+
+	// Read back for the author's name
+	if created, err := c.Reviews.GetByID(r.Context(), productID, review.ID); err == nil {
+		review = created
+	}
+	utils.CreatedResponse(w, "Review created successfully", review)
+}
+
+// DeleteReview - DELETE /api/products/{id}/reviews/{reviewId} (the author,
+// or products:manage for moderation)
+func (c *ReviewController) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	productID, reviewID, ok := reviewParams(w, r)
+	if !ok {
+		return
+	}
+
+	review, err := c.Reviews.GetByID(r.Context(), productID, reviewID)
+	if !writeReviewError(w, err, "Failed to delete review") {
+		return
+	}
+	if !middlewares.CanAccessUser(r, review.UserID, models.PermManageProducts) {
+		utils.ErrorResponse(w, http.StatusForbidden, "You can only delete your own reviews")
+		return
+	}
+
+	review, err = c.Reviews.Delete(r.Context(), productID, reviewID)
+	if !writeReviewError(w, err, "Failed to delete review") {
+		return
+	}
+	deleteReviewImages(r, c.Files, review)
+	c.reindex(r, productID)
+
+	utils.SuccessResponse(w, "Review deleted successfully", nil)
+}
+
+// MarkHelpful - POST /api/products/{id}/reviews/{reviewId}/helpful
+func (c *ReviewController) MarkHelpful(w http.ResponseWriter, r *http.Request) {
+	c.setHelpful(w, r, true)
+}
+
+// UnmarkHelpful - DELETE /api/products/{id}/reviews/{reviewId}/helpful
+func (c *ReviewController) UnmarkHelpful(w http.ResponseWriter, r *http.Request) {
+	c.setHelpful(w, r, false)
+}
+
+func (c *ReviewController) setHelpful(w http.ResponseWriter, r *http.Request, helpful bool) {
+	productID, reviewID, ok := reviewParams(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middlewares.UserID(r)
+
+	review, err := c.Reviews.GetByID(r.Context(), productID, reviewID)
+	if !writeReviewError(w, err, "Failed to update helpful votes") {
+		return
+	}
+	if review.UserID == userID {
+		utils.ErrorResponse(w, http.StatusBadRequest, "You cannot vote on your own review")
+		return
+	}
+
+	count, err := c.Reviews.SetHelpful(r.Context(), reviewID, userID, helpful)
+	if !writeReviewError(w, err, "Failed to update helpful votes") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Helpful votes updated successfully", models.ReviewHelpfulResponse{
+		ReviewID:     reviewID,
+		Helpful:      helpful,
+		HelpfulCount: count,
+	})
+}
+
+// productExists - Answers 404 or 500 and returns false when the product
+// cannot be found
+func (c *ReviewController) productExists(w http.ResponseWriter, r *http.Request, productID string) bool {
+	_, err := c.Products.GetByID(r.Context(), productID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return false
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch product")
+		return false
+	}
+	return true
+}
+
+// reindex - Refresh the search entry of a product after its rating changes
+func (c *ReviewController) reindex(r *http.Request, productID string) {
+	if product, err := c.Products.GetByID(r.Context(), productID); err == nil {
+		c.Search.Add(product)
+	}
+}
+
+func reviewParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	vars := mux.Vars(r)
+	reviewID, err := strconv.Atoi(vars["reviewId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid review ID")
+		return "", 0, false
+	}
+	return vars["id"], reviewID, true
+}
+
+// writeReviewError - Answer for a failed review read or write, false when it
+// answered
+func writeReviewError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Review not found")
+		return false
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, message)
+		return false
+	}
+	return true
+}
+
+// deleteReviewImages - Remove the files of a review's photos
+func deleteReviewImages(r *http.Request, files storage.Storage, review models.Review) {
+	for _, image := range review.Images {
+		deleteImageFiles(r.Context(), files, image.Key)
+	}
+}
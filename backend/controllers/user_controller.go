@@ -2,42 +2,39 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
 	"github.com/gorilla/mux"
 )
 
-// GetAllUsers - GET /api/users
-func GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	query := `SELECT id, name, email, balance, is_member, created_at FROM users ORDER BY id`
+type UserController struct {
+	Users repositories.UserRepository
+}
+
+func NewUserController(users repositories.UserRepository) *UserController {
+	return &UserController{Users: users}
+}
 
-	rows, err := config.DB.Query(query)
+// GetAllUsers - GET /api/admin/users
+func (c *UserController) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := c.Users.List(r.Context())
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch users")
 		return
 	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Balance, &user.IsMember, &user.CreatedAt)
-		if err != nil {
-			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to scan user")
-			return
-		}
-		users = append(users, user)
-	}
 
 	utils.SuccessResponse(w, "Users fetched successfully", users)
 }
 
 // GetUserByID - GET /api/users/{id}
-func GetUserByID(w http.ResponseWriter, r *http.Request) {
+func (c *UserController) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -45,22 +42,26 @@ func GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `SELECT id, name, email, balance, is_member, created_at FROM users WHERE id = ?`
+	if !middlewares.CanAccessUser(r, id, models.PermManageUsers) {
+		utils.ErrorResponse(w, http.StatusForbidden, "You can only view your own account")
+		return
+	}
 
-	var user models.User
-	err = config.DB.QueryRow(query, id).Scan(
-		&user.ID, &user.Name, &user.Email, &user.Balance, &user.IsMember, &user.CreatedAt,
-	)
-	if err != nil {
+	user, err := c.Users.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
 		utils.ErrorResponse(w, http.StatusNotFound, "User not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch user")
+		return
+	}
 
 	utils.SuccessResponse(w, "User fetched successfully", user)
 }
 
-// CreateUser - POST /api/users
-func CreateUser(w http.ResponseWriter, r *http.Request) {
+// CreateUser - POST /api/admin/users
+func (c *UserController) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var req models.UserCreateRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -69,32 +70,66 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validation
+	req.Name = strings.TrimSpace(req.Name)
 	if req.Name == "" || req.Email == "" {
 		utils.ErrorResponse(w, http.StatusBadRequest, "Name and email are required")
 		return
 	}
+	if req.Balance < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Balance cannot be negative")
+		return
+	}
 
-	query := `INSERT INTO users (name, email, balance, is_member) VALUES (?, ?, ?, ?)`
-	result, err := config.DB.Exec(query, req.Name, req.Email, req.Balance, req.IsMember)
+	email, err := utils.NormalizeEmail(req.Email)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleCustomer
+	}
+	if !models.IsValidRole(req.Role) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid role")
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	user := models.User{
-		ID:       int(id),
 		Name:     req.Name,
-		Email:    req.Email,
+		Email:    email,
 		Balance:  req.Balance,
 		IsMember: req.IsMember,
+		Role:     req.Role,
+	}
+
+	// Password is optional here, but when given it goes through the same policy as registration
+	if req.Password != "" {
+		if err := utils.ValidatePassword(req.Password); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		user.PasswordHash, err = utils.HashPassword(req.Password)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to hash password")
+			return
+		}
+	}
+
+	err = c.Users.Create(r.Context(), &user)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		utils.ErrorResponse(w, http.StatusConflict, "Email is already registered")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+		return
 	}
 
 	utils.CreatedResponse(w, "User created successfully", user)
 }
 
 // UpdateUser - PUT /api/users/{id}
-func UpdateUser(w http.ResponseWriter, r *http.Request) {
+func (c *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -102,6 +137,11 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !middlewares.CanAccessUser(r, id, models.PermManageUsers) {
+		utils.ErrorResponse(w, http.StatusForbidden, "You can only update your own account")
+		return
+	}
+
 	var req models.UserUpdateRequest
 	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -109,24 +149,27 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `UPDATE users SET name = ?, balance = ?, is_member = ? WHERE id = ?`
-	result, err := config.DB.Exec(query, req.Name, req.Balance, req.IsMember, id)
-	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Name is required")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	err = c.Users.UpdateName(r.Context(), id, req.Name)
+	if errors.Is(err, repositories.ErrNotFound) {
 		utils.ErrorResponse(w, http.StatusNotFound, "User not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
 
 	utils.SuccessResponse(w, "User updated successfully", nil)
 }
 
-// DeleteUser - DELETE /api/users/{id}
-func DeleteUser(w http.ResponseWriter, r *http.Request) {
+// AdminUpdateUser - PUT /api/admin/users/{id}
+func (c *UserController) AdminUpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -134,18 +177,62 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `DELETE FROM users WHERE id = ?`
-	result, err := config.DB.Exec(query, id)
+	var req models.AdminUserUpdateRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete user")
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation of the fields that are sent
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Name cannot be empty")
+			return
+		}
+		req.Name = &name
+	}
+	if req.Balance != nil && *req.Balance < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Balance cannot be negative")
+		return
+	}
+	if req.Role != nil && !models.IsValidRole(*req.Role) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	err = c.Users.AdminUpdate(r.Context(), id, req)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	utils.SuccessResponse(w, "User updated successfully", nil)
+}
+
+// DeleteUser - DELETE /api/admin/users/{id}
+func (c *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = c.Users.Delete(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
 		utils.ErrorResponse(w, http.StatusNotFound, "User not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete user")
+		return
+	}
 
 	utils.SuccessResponse(w, "User deleted successfully", nil)
 }
@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// Voucher field limits, matching the vouchers table
+const (
+	minVoucherCodeLen  = 3
+	maxVoucherCodeLen  = 32
+	maxVoucherNameLen  = 100
+	maxVoucherTermsLen = 5000
+)
+
+type VoucherController struct {
+	Vouchers repositories.VoucherRepository
+	Carts    repositories.CartRepository
+	Users    repositories.UserRepository
+	Pricing  pricing.Rules
+}
+
+func NewVoucherController(vouchers repositories.VoucherRepository, carts repositories.CartRepository,
+	users repositories.UserRepository, rules pricing.Rules) *VoucherController {
+	return &VoucherController{Vouchers: vouchers, Carts: carts, Users: users, Pricing: rules}
+}
+
+// GetVouchers - GET /api/vouchers?tab=available|mine&sort=expiry|discount.
+// Available lists public vouchers, mine the claimed ones; expired and
+// deactivated vouchers drop off both. Each voucher is checked against the
+// selected items of the caller's cart.
+func (c *VoucherController) GetVouchers(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	params := r.URL.Query()
+
+	filter := repositories.VoucherFilter{UserID: userID, Current: true}
+	switch params.Get("tab") {
+	case "", "available":
+		filter.Public = true
+	case "mine":
+		filter.Claimed = true
+	default:
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid tab, use available or mine")
+		return
+	}
+
+	sortBy := params.Get("sort")
+	if sortBy == "" {
+		sortBy = repositories.VoucherSortExpiry
+	}
+	if !containsString(repositories.VoucherSorts, sortBy) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid sort, use "+strings.Join(repositories.VoucherSorts, ", "))
+		return
+	}
+
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+
+	vouchers, err := c.Vouchers.List(r.Context(), filter)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch vouchers")
+		return
+	}
+	items, err := c.Carts.Items(r.Context(), repositories.CartOwner{UserID: userID})
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+	member, err := isMember(r.Context(), c.Users, userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch vouchers")
+		return
+	}
+
+	cart := models.NewCart(items)
+	offers := make([]models.VoucherOffer, len(vouchers))
+	for i, v := range vouchers {
+		_, applied := quoteCart(c.Pricing, cart, member, &v)
+		offers[i] = models.NewVoucherOffer(v, *applied)
+	}
+	// The list comes soonest expiry first, which breaks discount ties
+	if sortBy == repositories.VoucherSortDiscount {
+		sort.SliceStable(offers, func(i, j int) bool { return offers[i].Discount > offers[j].Discount })
+	}
+
+	total := len(offers)
+	start := min((page-1)*limit, total)
+	end := min(start+limit, total)
+	utils.PaginatedResponse(w, "Vouchers fetched successfully", offers[start:end], utils.NewPagination(page, limit, total))
+}
+
+// ClaimVoucher - POST /api/vouchers/{id}/claim, save a public voucher to
+// the caller's vouchers
+func (c *VoucherController) ClaimVoucher(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid voucher ID")
+		return
+	}
+
+	// Private vouchers are only handed out as codes
+	voucher, err := c.Vouchers.GetByID(r.Context(), id, userID)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && !voucher.IsPublic) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Voucher not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to claim voucher")
+		return
+	}
+	// Checked without a cart, so only reasons about the voucher itself
+	// count; upcoming vouchers can be saved ahead
+	if reason := voucher.Check(time.Now(), 0, voucher.UserUses); reason != models.VoucherReasonNoItems &&
+		reason != models.VoucherReasonNotStarted {
+		writeVoucherRejection(w, reason, voucher, 0)
+		return
+	}
+
+	if err := c.Vouchers.Claim(r.Context(), id, userID); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to claim voucher")
+		return
+	}
+	voucher.Claimed = true
+
+	utils.SuccessResponse(w, "Voucher claimed successfully", voucher)
+}
+
+// GetAllVouchers - GET /api/admin/vouchers?q=keyword, soonest expiry first
+func (c *VoucherController) GetAllVouchers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page, limit, ok := pageParams(w, params)
+	if !ok {
+		return
+	}
+
+	vouchers, err := c.Vouchers.List(r.Context(), repositories.VoucherFilter{Query: strings.TrimSpace(params.Get("q"))})
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch vouchers")
+		return
+	}
+
+	total := len(vouchers)
+	start := min((page-1)*limit, total)
+	end := min(start+limit, total)
+	utils.PaginatedResponse(w, "Vouchers fetched successfully", vouchers[start:end], utils.NewPagination(page, limit, total))
+}
+
+// GetVoucher - GET /api/admin/vouchers/{id}
+func (c *VoucherController) GetVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid voucher ID")
+		return
+	}
+
+	voucher, err := c.Vouchers.GetByID(r.Context(), id, 0)
+	if !writeVoucherError(w, err, "Failed to fetch voucher") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Voucher fetched successfully", voucher)
+}
+
+// CreateVoucher - POST /api/admin/vouchers
+func (c *VoucherController) CreateVoucher(w http.ResponseWriter, r *http.Request) {
+	voucher, ok := decodeVoucher(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.Vouchers.Create(r.Context(), &voucher)
+	if !writeVoucherError(w, err, "Failed to create voucher") {
+		return
+	}
+
+	utils.CreatedResponse(w, "Voucher created successfully", voucher)
+}
+
+// UpdateVoucher - PUT /api/admin/vouchers/{id}. Changes apply to carts
+// holding the voucher on their next read; placed orders keep their discount.
+func (c *VoucherController) UpdateVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid voucher ID")
+		return
+	}
+
+	existing, err := c.Vouchers.GetByID(r.Context(), id, 0)
+	if !writeVoucherError(w, err, "Failed to update voucher") {
+		return
+	}
+
+	voucher, ok := decodeVoucher(w, r)
+	if !ok {
+		return
+	}
+	voucher.ID = id
+	voucher.UsedCount = existing.UsedCount
+	voucher.CreatedAt = existing.CreatedAt
+
+	err = c.Vouchers.Update(r.Context(), voucher)
+	if !writeVoucherError(w, err, "Failed to update voucher") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Voucher updated successfully", voucher)
+}
+
+// DeleteVoucher - DELETE /api/admin/vouchers/{id}
+func (c *VoucherController) DeleteVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid voucher ID")
+		return
+	}
+
+	err = c.Vouchers.Delete(r.Context(), id)
+	if errors.Is(err, repositories.ErrInUse) {
+		utils.ErrorResponse(w, http.StatusConflict, "This voucher has been used on orders, deactivate it instead")
+		return
+	}
+	if !writeVoucherError(w, err, "Failed to delete voucher") {
+		return
+	}
+
+	utils.SuccessResponse(w, "Voucher deleted successfully", nil)
+}
+
+// decodeVoucher - Read and validate a voucher body
+func decodeVoucher(w http.ResponseWriter, r *http.Request) (models.Voucher, bool) {
+	var req models.VoucherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return models.Voucher{}, false
+	}
+
+	// Validation
+	req.Code = models.NormalizeVoucherCode(req.Code)
+	if len(req.Code) < minVoucherCodeLen || len(req.Code) > maxVoucherCodeLen || !isVoucherCode(req.Code) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Code must be "+strconv.Itoa(minVoucherCodeLen)+" to "+
+			strconv.Itoa(maxVoucherCodeLen)+" letters, digits or hyphens")
+		return models.Voucher{}, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxVoucherNameLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Name is required, up to "+strconv.Itoa(maxVoucherNameLen)+" characters")
+		return models.Voucher{}, false
+	}
+	if !containsString(models.VoucherTypes, req.Type) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Type must be one of: "+strings.Join(models.VoucherTypes, ", "))
+		return models.Voucher{}, false
+	}
+	switch {
+	case req.Type == models.VoucherFixed && req.Value <= 0:
+		utils.ErrorResponse(w, http.StatusBadRequest, "Value must be a positive amount")
+		return models.Voucher{}, false
+	case req.Type == models.VoucherPercentage && (req.Value < 1 || req.Value > 100):
+		utils.ErrorResponse(w, http.StatusBadRequest, "Value must be a percentage between 1 and 100")
+		return models.Voucher{}, false
+	case req.Value < 0:
+		utils.ErrorResponse(w, http.StatusBadRequest, "Value cannot be negative")
+		return models.Voucher{}, false
+	}
+	if req.MaxDiscount < 0 || req.MinPurchase < 0 || req.UsageLimit < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Max discount, min purchase and usage limit cannot be negative")
+		return models.Voucher{}, false
+	}
+	if req.PerUserLimit == nil {
+		perUser := 1
+		req.PerUserLimit = &perUser
+	}
+	if *req.PerUserLimit < 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Per user limit cannot be negative")
+		return models.Voucher{}, false
+	}
+	startsAt := time.Now()
+	if req.StartsAt != nil {
+		startsAt = *req.StartsAt
+	}
+	if req.ExpiresAt.IsZero() || !req.ExpiresAt.After(startsAt) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Expiry is required and must be after the start")
+		return models.Voucher{}, false
+	}
+	req.Terms = strings.TrimSpace(req.Terms)
+	if len(req.Terms) > maxVoucherTermsLen {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Terms must be at most "+strconv.Itoa(maxVoucherTermsLen)+" characters")
+		return models.Voucher{}, false
+	}
+
+	return models.Voucher{
+		Code:         req.Code,
+		Name:         req.Name,
+		Type:         req.Type,
+		Value:        req.Value,
+		MaxDiscount:  req.MaxDiscount,
+		MinPurchase:  req.MinPurchase,
+		StartsAt:     startsAt,
+		ExpiresAt:    req.ExpiresAt,
+		UsageLimit:   req.UsageLimit,
+		PerUserLimit: *req.PerUserLimit,
+		Terms:        req.Terms,
+		IsPublic:     req.IsPublic,
+		IsActive:     req.IsActive == nil || *req.IsActive,
+	}, true
+}
+
+// isVoucherCode - Upper case letters, digits and hyphens only
+func isVoucherCode(code string) bool {
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// writeVoucherError - Answer for a failed voucher read or write, false
+// when it answered
+func writeVoucherError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		utils.ErrorResponse(w, http.StatusNotFound, "Voucher not found")
+		return false
+	case errors.Is(err, repositories.ErrDuplicate):
+		utils.ErrorResponse(w, http.StatusConflict, "Code already exists")
+		return false
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusInternalServerError, message)
+		return false
+	}
+	return true
+}
+
+// writeVoucherRejection - Tell the customer why the voucher cannot be used.
+// The reason is returned as data so clients can react to it; unknown codes
+// are a 404, everything else a 400.
+func writeVoucherRejection(w http.ResponseWriter, reason string, voucher models.Voucher, subtotal int) {
+	status := http.StatusBadRequest
+	if reason == models.VoucherReasonNotFound {
+		status = http.StatusNotFound
+	}
+	data := map[string]interface{}{"reason": reason}
+	if reason == models.VoucherReasonMinPurchase {
+		data["min_purchase"] = voucher.MinPurchase
+		data["shortfall"] = voucher.MinPurchase - subtotal
+	}
+	utils.ErrorResponseWithData(w, status, voucher.RejectionMessage(reason, subtotal), data)
+}
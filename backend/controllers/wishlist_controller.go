@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type WishlistController struct {
+	Products  repositories.ProductRepository
+	Carts     repositories.CartRepository
+	Wishlists repositories.WishlistRepository
+}
+
+func NewWishlistController(products repositories.ProductRepository, carts repositories.CartRepository,
+	wishlists repositories.WishlistRepository) *WishlistController {
+	return &WishlistController{Products: products, Carts: carts, Wishlists: wishlists}
+}
+
+// GetWishlist - GET /api/wishlist (newest first, with price drops since saving)
+func (c *WishlistController) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	c.respond(w, r, http.StatusOK, "Wishlist fetched successfully")
+}
+
+// AddWishlistItem - POST /api/wishlist/items. Saving a product again keeps
+// the price it was first saved at.
+func (c *WishlistController) AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+
+	var req models.WishlistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validation
+	if req.ProductID == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Product ID is required")
+		return
+	}
+
+	product, err := c.Products.GetByID(r.Context(), req.ProductID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add item to wishlist")
+		return
+	}
+
+	price := product.Price
+	if req.VariantID != 0 {
+		variant, ok := findVariant(product.Variants, req.VariantID)
+		if !ok {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Variant not found")
+			return
+		}
+		if variant.PriceOverride != nil {
+			price = *variant.PriceOverride
+		}
+	}
+
+	_, err = c.Wishlists.AddItem(r.Context(), userID, models.WishlistItem{
+		ProductID:  req.ProductID,
+		VariantID:  req.VariantID,
+		SavedPrice: price,
+	})
+	if errors.Is(err, repositories.ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to add item to wishlist")
+		return
+	}
+
+	c.respond(w, r, http.StatusCreated, "Item added to wishlist successfully")
+}
+
+// DeleteWishlistItem - DELETE /api/wishlist/items/{itemId}
+func (c *WishlistController) DeleteWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+	id, err := strconv.Atoi(mux.Vars(r)["itemId"])
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid wishlist item ID")
+		return
+	}
+
+	items, err := c.Wishlists.Items(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch wishlist")
+		return
+	}
+	if !containsWishlistItem(items, id) {
+		utils.ErrorResponse(w, http.StatusNotFound, "Wishlist item not found")
+		return
+	}
+
+	if err := c.Wishlists.DeleteItems(r.Context(), userID, []int{id}); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete wishlist item")
+		return
+	}
+
+	c.respond(w, r, http.StatusOK, "Wishlist item deleted successfully")
+}
+
+// DeleteWishlistProduct - DELETE /api/wishlist/products/{id}, the heart
+// button on the product page: removes the product with all its variants
+func (c *WishlistController) DeleteWishlistProduct(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+
+	if err := c.Wishlists.DeleteProduct(r.Context(), userID, mux.Vars(r)["id"]); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to delete wishlist item")
+		return
+	}
+
+	c.respond(w, r, http.StatusOK, "Product removed from wishlist successfully")
+}
+
+// MoveToCart - POST /api/wishlist/move-to-cart with {"item_ids": [...]}; no
+// IDs moves every line. Each line adds one unit to the cart. Nothing moves
+// unless every line can be bought.
+func (c *WishlistController) MoveToCart(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middlewares.UserID(r)
+
+	var req models.WishlistMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	items, err := c.Wishlists.Items(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch wishlist")
+		return
+	}
+	cart, err := c.Carts.Items(r.Context(), repositories.CartOwner{UserID: userID})
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+
+	// Validation
+	for _, id := range req.ItemIDs {
+		if !containsWishlistItem(items, id) {
+			utils.ErrorResponse(w, http.StatusNotFound, "Wishlist item not found")
+			return
+		}
+	}
+	ids, needsVariant, shortages := []int{}, []int{}, []int{}
+	for _, item := range items {
+		if len(req.ItemIDs) > 0 && !containsInt(req.ItemIDs, item.ID) {
+			continue
+		}
+		ids = append(ids, item.ID)
+		quantity := 1 + findCartItem(cart, item.ProductID, item.VariantID).Quantity
+		switch {
+		case item.NeedsVariant:
+			needsVariant = append(needsVariant, item.ID)
+		case quantity > item.Stock || quantity > maxCartQuantity:
+			shortages = append(shortages, item.ID)
+		}
+	}
+	if len(ids) == 0 {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Your wishlist is empty")
+		return
+	}
+	if len(needsVariant) > 0 {
+		utils.ErrorResponseWithData(w, http.StatusBadRequest, "Choose a variant for these items", map[string]interface{}{
+			"item_ids": needsVariant,
+		})
+		return
+	}
+	if len(shortages) > 0 {
+		utils.ErrorResponseWithData(w, http.StatusConflict, "Insufficient stock", map[string]interface{}{
+			"item_ids": shortages,
+		})
+		return
+	}
+
+	if _, err := c.Wishlists.MoveToCart(r.Context(), userID, ids, maxCartQuantity); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to move items to cart")
+		return
+	}
+
+	c.respond(w, r, http.StatusOK, "Items moved to cart successfully")
+}
+
+// respond - Answer with the caller's wishlist as it is now
+func (c *WishlistController) respond(w http.ResponseWriter, r *http.Request, status int, message string) {
+	userID, _ := middlewares.UserID(r)
+	items, err := c.Wishlists.Items(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to fetch wishlist")
+		return
+	}
+
+	wishlist := models.NewWishlist(items)
+	if status == http.StatusCreated {
+		utils.CreatedResponse(w, message, wishlist)
+		return
+	}
+	utils.SuccessResponse(w, message, wishlist)
+}
+
+func containsWishlistItem(items []models.WishlistItem, id int) bool {
+	for _, item := range items {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// findCartItem - The cart line for the product and variant, or the zero value
+func findCartItem(items []models.CartItem, productID string, variantID int) models.CartItem {
+	for _, item := range items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			return item
+		}
+	}
+	return models.CartItem{}
+}
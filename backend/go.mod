@@ -4,7 +4,9 @@ go 1.24.0
 
 require (
 	github.com/go-sql-driver/mysql v1.9.3
+	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/gorilla/mux v1.8.1
+	golang.org/x/crypto v0.48.0
 	golang.org/x/text v0.34.0
 )
 
@@ -1,46 +1,220 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/routes"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/search"
 )
 
 func main() {
 	fmt.Println("╔═══════════════════════════════════════╗")
 	fmt.Println("║   GO-COMMERCE REST API SERVER        ║")
-	fmt.Println("╚═══════════════════════════════════════╝\n")
+	fmt.Println("╚═══════════════════════════════════════╝")
+	fmt.Println()
 
-	// Connect to database
-	err := config.ConnectDatabase()
+	// Load configuration
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("❌ Database connection failed:", err)
+		log.Fatal("❌ ", err)
+	}
+
+	// go-commerce migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			log.Fatal("❌ ", err)
+		}
+		return
+	}
+
+	err = config.ApplyAuthConfig(cfg.Auth)
+	if err != nil {
+		log.Fatal("❌ Invalid auth configuration:", err)
+	}
+
+	// Connect to storage
+	var repos *repositories.Repositories
+	if cfg.Storage == "memory" {
+		fmt.Println("⚠️  Using in-memory storage, data is lost on restart")
+		repos = repositories.NewMemory()
+	} else {
+		err = config.ConnectDatabase(cfg.Database)
+		if err != nil {
+			log.Fatal("❌ Database connection failed:", err)
+		}
+		defer config.CloseDatabase()
+		warnPendingMigrations()
+		repos = repositories.NewMySQL(config.DB)
+	}
+
+	// Build the product search index
+	index, err := search.Build(context.Background(), repos.Products)
+	if err != nil {
+		log.Fatal("❌ Failed to build search index:", err)
 	}
-	defer config.CloseDatabase()
 
 	// Setup routes
-	router := routes.SetupRoutes()
+	router := routes.SetupRoutes(cfg, repos, index)
+
+	// Delete stale guest carts in the background until shutdown
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go expireGuestCarts(jobs, repos.Carts, cfg.Cart.GuestTTL)
 
 	// Start server
-	port := ":8080"
-	fmt.Printf("🚀 Server starting on http://localhost%s\n", port)
+	server := &http.Server{
+		Addr:              cfg.Server.Addr(),
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	fmt.Printf("🚀 Server starting on http://localhost%s (%s)\n", server.Addr, cfg.Env)
 	fmt.Println("\n📋 Available Endpoints:")
 	fmt.Println("   GET    /api/health")
-	fmt.Println("   GET    /api/users")
+	fmt.Println("   POST   /api/auth/register")
+	fmt.Println("   POST   /api/auth/login")
+	fmt.Println("   POST   /api/auth/refresh")
+	fmt.Println("   POST   /api/auth/logout")
 	fmt.Println("   GET    /api/users/{id}")
-	fmt.Println("   POST   /api/users")
 	fmt.Println("   PUT    /api/users/{id}")
-	fmt.Println("   DELETE /api/users/{id}")
+	fmt.Println("   GET    /api/users/{id}/orders")
 	fmt.Println("   GET    /api/products")
 	fmt.Println("   GET    /api/products/search?q=keyword")
+	fmt.Println("   GET    /api/products/autocomplete?q=prefix")
+	fmt.Println("   GET    /api/products/facets")
 	fmt.Println("   GET    /api/products/{id}")
-	fmt.Println("   POST   /api/products")
-	fmt.Println("   PUT    /api/products/{id}")
-	fmt.Println("   DELETE /api/products/{id}")
-	fmt.Println("\n⏳ Server is running... Press Ctrl+C to stop\n")
+	fmt.Println("   GET    /api/products/{id}/images")
+	fmt.Println("   POST   /api/products/{id}/images")
+	fmt.Println("   PUT    /api/products/{id}/images/order")
+	fmt.Println("   PUT    /api/products/{id}/images/{imageId}/primary")
+	fmt.Println("   DELETE /api/products/{id}/images/{imageId}")
+	fmt.Println("   GET    /api/products/{id}/reviews")
+	fmt.Println("   GET    /api/products/{id}/reviews/summary")
+	fmt.Println("   POST   /api/products/{id}/reviews")
+	fmt.Println("   DELETE /api/products/{id}/reviews/{reviewId}")
+	fmt.Println("   POST   /api/products/{id}/reviews/{reviewId}/helpful")
+	fmt.Println("   DELETE /api/products/{id}/reviews/{reviewId}/helpful")
+	fmt.Println("   GET    /api/products/{id}/questions")
+	fmt.Println("   POST   /api/products/{id}/questions")
+	fmt.Println("   PUT    /api/products/{id}/questions/{questionId}/vote")
+	fmt.Println("   POST   /api/products/{id}/questions/{questionId}/answers")
+	fmt.Println("   PUT    /api/products/{id}/questions/{questionId}/answers/{answerId}/vote")
+	fmt.Println("   GET    /api/categories")
+	fmt.Println("   GET    /api/categories/tree")
+	fmt.Println("   GET    /api/categories/{slug}")
+	fmt.Println("   GET    /api/cart")
+	fmt.Println("   POST   /api/cart/items")
+	fmt.Println("   PATCH  /api/cart/items")
+	fmt.Println("   DELETE /api/cart/items")
+	fmt.Println("   PATCH  /api/cart/items/{itemId}")
+	fmt.Println("   DELETE /api/cart/items/{itemId}")
+	fmt.Println("   POST   /api/cart/move-to-wishlist")
+	fmt.Println("   POST   /api/cart/voucher")
+	fmt.Println("   DELETE /api/cart/voucher")
+	fmt.Println("   GET    /api/vouchers")
+	fmt.Println("   POST   /api/vouchers/{id}/claim")
+	fmt.Println("   GET    /api/wishlist")
+	fmt.Println("   POST   /api/wishlist/items")
+	fmt.Println("   DELETE /api/wishlist/items/{itemId}")
+	fmt.Println("   DELETE /api/wishlist/products/{id}")
+	fmt.Println("   POST   /api/wishlist/move-to-cart")
+	fmt.Println("   GET    /api/addresses")
+	fmt.Println("   POST   /api/addresses")
+	fmt.Println("   GET    /api/addresses/{id}")
+	fmt.Println("   PUT    /api/addresses/{id}")
+	fmt.Println("   DELETE /api/addresses/{id}")
+	fmt.Println("   PUT    /api/addresses/{id}/default")
+	fmt.Println("   GET    /api/regions/provinces")
+	fmt.Println("   GET    /api/checkout/options")
+	fmt.Println("   POST   /api/checkout")
+	fmt.Println("   GET    /api/checkout/{id}")
+	fmt.Println("   PUT    /api/checkout/{id}/shipping")
+	fmt.Println("   PUT    /api/checkout/{id}/payment")
+	fmt.Println("   GET    /api/checkout/{id}/summary")
+	fmt.Println("   POST   /api/checkout/{id}/place")
+	fmt.Println("   GET    /api/orders")
+	fmt.Println("   GET    /api/orders/{id}")
+	fmt.Println("   GET    /api/orders/{id}/timeline")
+	fmt.Println("   POST   /api/orders")
+	fmt.Println("   POST   /api/orders/{id}/cancel")
+	fmt.Println("   POST   /api/orders/{id}/confirm")
+	fmt.Println("   POST   /api/orders/{id}/reorder")
+	fmt.Println("   GET    /api/admin/users")
+	fmt.Println("   POST   /api/admin/users")
+	fmt.Println("   PUT    /api/admin/users/{id}")
+	fmt.Println("   DELETE /api/admin/users/{id}")
+	fmt.Println("   POST   /api/admin/products")
+	fmt.Println("   PUT    /api/admin/products/{id}")
+	fmt.Println("   DELETE /api/admin/products/{id}")
+	fmt.Println("   POST   /api/admin/products/{id}/variants")
+	fmt.Println("   PUT    /api/admin/products/{id}/variants/{variantId}")
+	fmt.Println("   DELETE /api/admin/products/{id}/variants/{variantId}")
+	fmt.Println("   POST   /api/admin/categories")
+	fmt.Println("   PUT    /api/admin/categories/{id}")
+	fmt.Println("   DELETE /api/admin/categories/{id}")
+	fmt.Println("   GET    /api/admin/questions")
+	fmt.Println("   PUT    /api/admin/questions/{id}/status")
+	fmt.Println("   GET    /api/admin/answers")
+	fmt.Println("   PUT    /api/admin/answers/{id}/status")
+	fmt.Println("   GET    /api/admin/vouchers")
+	fmt.Println("   POST   /api/admin/vouchers")
+	fmt.Println("   GET    /api/admin/vouchers/{id}")
+	fmt.Println("   PUT    /api/admin/vouchers/{id}")
+	fmt.Println("   DELETE /api/admin/vouchers/{id}")
+	fmt.Println("   GET    /api/admin/orders")
+	fmt.Println("   PUT    /api/admin/orders/{id}/status")
+	fmt.Println("\n⏳ Server is running... Press Ctrl+C to stop")
+	fmt.Println()
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal("❌ Server failed:", err)
+		}
+	}()
+
+	// Wait for Ctrl+C or the platform's SIGTERM, then drain in-flight requests
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Server shutdown error:", err)
+	}
+	log.Println("Server stopped")
+}
+
+// expireGuestCarts - Delete guest carts without changes for ttl, at start and
+// then every hour, until ctx is cancelled
+func expireGuestCarts(ctx context.Context, carts repositories.CartRepository, ttl time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
 
-	log.Fatal(http.ListenAndServe(port, router))
+	for {
+		n, err := carts.DeleteGuestCarts(ctx, time.Now().Add(-ttl))
+		if err != nil && ctx.Err() == nil {
+			log.Println("Failed to delete expired guest carts:", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d expired guest carts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
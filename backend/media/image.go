@@ -0,0 +1,149 @@
+// Package media - Checks uploaded images and generates their thumbnails,
+// using only the standard library decoders (JPEG, PNG and GIF).
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+)
+
+// Errors reported for rejected uploads
+var (
+	ErrUnsupportedType = errors.New("unsupported image type, use JPEG, PNG or GIF")
+	ErrTooLarge        = errors.New("image dimensions too large")
+)
+
+// MaxPixels - Largest image accepted, checked before decoding so a small
+// file cannot expand into gigabytes of pixels
+const MaxPixels = 40_000_000
+
+// Extensions - File extension for each accepted content type
+var Extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// ThumbnailSize - A generated thumbnail fits in a Size x Size square
+type ThumbnailSize struct {
+	Name string
+	Size int
+}
+
+// ThumbnailSizes - Thumbnails generated for every upload
+var ThumbnailSizes = []ThumbnailSize{
+	{Name: "small", Size: 150},
+	{Name: "medium", Size: 400},
+	{Name: "large", Size: 800},
+}
+
+// Info - What an upload turned out to be
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Image - A decoded upload
+type Image struct {
+	Info
+	img image.Image
+}
+
+// Inspect - Sniff the content type from the bytes (the client's claim is
+// ignored) and check the dimensions, without decoding the pixels
+func Inspect(data []byte) (Info, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := Extensions[contentType]; !ok {
+		return Info{}, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, ErrUnsupportedType
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return Info{}, ErrTooLarge
+	}
+	return Info{ContentType: contentType, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// Decode - Inspect, then decode the pixels
+func Decode(data []byte) (*Image, error) {
+	info, err := Inspect(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	return &Image{Info: info, img: img}, nil
+}
+
+// Thumbnail - Write a JPEG of the image scaled to fit in size x size.
+// Smaller images are not enlarged; transparency is flattened onto white.
+func (m *Image) Thumbnail(w io.Writer, size int) error {
+	width, height := fit(m.Width, m.Height, size)
+	thumb := resize(m.img, width, height)
+	return jpeg.Encode(w, thumb, &jpeg.Options{Quality: 85})
+}
+
+// fit - Dimensions scaled to fit in a size x size box, keeping the aspect ratio
+func fit(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+// resize - Area-averaging downscale: every target pixel is the mean of the
+// source pixels it covers, which avoids the aliasing of nearest neighbour
+func resize(src image.Image, width, height int) *image.RGBA {
+	// Flatten onto white first so transparent pixels do not turn black in JPEG
+	b := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, b.Min, draw.Over)
+
+	if width == b.Dx() && height == b.Dy() {
+		return flat
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4:]
+					r += int(p[0])
+					g += int(p[1])
+					bl += int(p[2])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(bl/n), 0xff
+		}
+	}
+	return dst
+}
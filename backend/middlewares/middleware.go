@@ -18,21 +18,40 @@ func Logger(next http.Handler) http.Handler {
     })
 }
 
-// CORS - Enable CORS
-func CORS(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-        
-        // Handle preflight request
-        if r.Method == "OPTIONS" {
-            w.WriteHeader(http.StatusOK)
-            return
+// CORS - Enable CORS for the configured origins ("*" allows any origin)
+func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
+    allowAll := false
+    allowed := make(map[string]bool)
+    for _, origin := range allowedOrigins {
+        if origin == "*" {
+            allowAll = true
         }
-        
-        next.ServeHTTP(w, r)
-    })
+        allowed[origin] = true
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            origin := r.Header.Get("Origin")
+            if allowAll {
+                w.Header().Set("Access-Control-Allow-Origin", "*")
+            } else if allowed[origin] {
+                // Named origins may send cookies, such as the guest cart token
+                w.Header().Set("Access-Control-Allow-Origin", origin)
+                w.Header().Set("Access-Control-Allow-Credentials", "true")
+                w.Header().Add("Vary", "Origin")
+            }
+            w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+            w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+            // Handle preflight request
+            if r.Method == "OPTIONS" {
+                w.WriteHeader(http.StatusOK)
+                return
+            }
+
+            next.ServeHTTP(w, r)
+        })
+    }
 }
 
 // ContentTypeJSON - Set JSON content type
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/migrations"
+)
+
+const migrateUsage = `usage: go-commerce migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrate - The "migrate" subcommand
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if cfg.Storage != "mysql" {
+		return errors.New("migrations need STORAGE=mysql")
+	}
+
+	err := config.ConnectDatabase(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("database connection failed: %w", err)
+	}
+	defer config.CloseDatabase()
+
+	migrator, err := migrations.New(config.DB)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("✅ Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("✅ Schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("down: %q is not a positive number of steps", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("↩️  Rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// warnPendingMigrations - The server does not migrate on its own, but an
+// outdated or tampered schema is worth a loud warning at startup
+func warnPendingMigrations() {
+	migrator, err := migrations.New(config.DB)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		log.Println("⚠️  Could not check migrations:", err)
+		return
+	}
+	if len(pending) > 0 {
+		log.Printf("⚠️  %d pending migration(s), run \"go-commerce migrate up\"", len(pending))
+	}
+}
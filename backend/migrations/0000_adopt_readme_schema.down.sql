@@ -0,0 +1,2 @@
+-- Nothing to undo: the columns belong to the 0001 schema, and rolling back
+-- 0001 drops the tables.
@@ -0,0 +1,37 @@
+-- Databases created from the README snippets before migrations existed have
+-- users, products, orders and order_items without the columns later code
+-- relies on. 0001 creates tables only IF NOT EXISTS, so it would skip them;
+-- this step runs first and adds each missing column to a table that already
+-- exists. On a new database, or one migrated from 0001, every check finds
+-- nothing to do. Each ALTER is built only when information_schema shows the
+-- table without the column, otherwise a no-op DO 0 runs.
+
+SET @ddl = (SELECT IF(
+    EXISTS (SELECT 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users')
+    AND NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+                    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'password_hash'),
+    'ALTER TABLE users ADD COLUMN password_hash VARCHAR(255) NULL AFTER email',
+    'DO 0'));
+PREPARE adopt FROM @ddl;
+EXECUTE adopt;
+DEALLOCATE PREPARE adopt;
+
+SET @ddl = (SELECT IF(
+    EXISTS (SELECT 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users')
+    AND NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+                    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'role'),
+    'ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT ''customer'' AFTER is_member',
+    'DO 0'));
+PREPARE adopt FROM @ddl;
+EXECUTE adopt;
+DEALLOCATE PREPARE adopt;
+
+SET @ddl = (SELECT IF(
+    EXISTS (SELECT 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'orders')
+    AND NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+                    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'orders' AND COLUMN_NAME = 'balance_paid'),
+    'ALTER TABLE orders ADD COLUMN balance_paid INT NOT NULL DEFAULT 0 AFTER total',
+    'DO 0'));
+PREPARE adopt FROM @ddl;
+EXECUTE adopt;
+DEALLOCATE PREPARE adopt;
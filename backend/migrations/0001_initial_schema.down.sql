@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS order_events;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,4 @@
+DROP INDEX idx_products_created_at ON products;
+DROP INDEX idx_products_rating ON products;
+DROP INDEX idx_products_price ON products;
+DROP INDEX idx_products_category ON products;
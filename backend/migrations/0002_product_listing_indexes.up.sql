@@ -0,0 +1,5 @@
+-- Indexes for the filtered and sorted product listing
+CREATE INDEX idx_products_category ON products (category);
+CREATE INDEX idx_products_price ON products (price);
+CREATE INDEX idx_products_rating ON products (rating);
+CREATE INDEX idx_products_created_at ON products (created_at);
@@ -0,0 +1,6 @@
+ALTER TABLE order_items
+    DROP FOREIGN KEY fk_order_items_variant,
+    DROP COLUMN variant_label,
+    DROP COLUMN variant_id;
+
+DROP TABLE IF EXISTS product_variants;
@@ -0,0 +1,20 @@
+-- Variants of a product (color, storage, ...) with their own SKU and stock.
+-- price is NULL when the variant sells at the product's price.
+CREATE TABLE product_variants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id VARCHAR(50) NOT NULL,
+    sku VARCHAR(64) NOT NULL UNIQUE,
+    options JSON NOT NULL,
+    price INT NULL,
+    stock INT NOT NULL DEFAULT 0,
+    images JSON NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    INDEX idx_product_variants_product (product_id)
+);
+
+-- Order items remember the variant and its label at the time of the order
+ALTER TABLE order_items
+    ADD COLUMN variant_id INT NULL AFTER product_id,
+    ADD COLUMN variant_label VARCHAR(255) NULL AFTER variant_id,
+    ADD CONSTRAINT fk_order_items_variant FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE SET NULL;
@@ -0,0 +1,18 @@
+-- Uploaded product images. storage_key is the original file; thumbnails
+-- maps each thumbnail size name to its URL.
+CREATE TABLE product_images (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id VARCHAR(50) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    url VARCHAR(512) NOT NULL,
+    thumbnails JSON NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size_bytes INT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    INDEX idx_product_images_product (product_id, position)
+);
@@ -0,0 +1,8 @@
+DROP INDEX idx_products_brand ON products;
+
+ALTER TABLE products
+    DROP COLUMN tags,
+    DROP COLUMN specs,
+    DROP COLUMN features,
+    DROP COLUMN description,
+    DROP COLUMN brand;
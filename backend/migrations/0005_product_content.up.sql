@@ -0,0 +1,11 @@
+-- Content for the product details tabs and listing cards. features, specs
+-- and tags are JSON: a list of bullets, a list of {name, items: [{label,
+-- value}]} groups and a list of lowercase labels.
+ALTER TABLE products
+    ADD COLUMN brand VARCHAR(100) NOT NULL DEFAULT '' AFTER category,
+    ADD COLUMN description TEXT NULL AFTER brand,
+    ADD COLUMN features JSON NULL AFTER description,
+    ADD COLUMN specs JSON NULL AFTER features,
+    ADD COLUMN tags JSON NULL AFTER specs;
+
+CREATE INDEX idx_products_brand ON products (brand);
@@ -0,0 +1,13 @@
+ALTER TABLE products ADD COLUMN category VARCHAR(100) NULL AFTER stock;
+
+UPDATE products p
+JOIN categories c ON c.id = p.category_id
+SET p.category = c.name;
+
+CREATE INDEX idx_products_category ON products (category);
+
+ALTER TABLE products
+    DROP FOREIGN KEY fk_products_category,
+    DROP COLUMN category_id;
+
+DROP TABLE categories;
@@ -0,0 +1,31 @@
+-- Category tree. Products reference a category by ID instead of carrying
+-- its name; the existing names become top level categories.
+CREATE TABLE categories (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    parent_id INT NULL,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(120) NOT NULL UNIQUE,
+    image VARCHAR(500) NOT NULL DEFAULT '',
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (parent_id) REFERENCES categories(id),
+    INDEX idx_categories_parent (parent_id, sort_order)
+);
+
+INSERT INTO categories (name, slug)
+SELECT MIN(TRIM(category)), LOWER(REPLACE(TRIM(category), ' ', '-'))
+FROM products
+WHERE category IS NOT NULL AND TRIM(category) <> ''
+GROUP BY LOWER(REPLACE(TRIM(category), ' ', '-'));
+
+ALTER TABLE products
+    ADD COLUMN category_id INT NULL AFTER stock,
+    ADD CONSTRAINT fk_products_category FOREIGN KEY (category_id) REFERENCES categories(id);
+
+UPDATE products p
+JOIN categories c ON c.slug = LOWER(REPLACE(TRIM(p.category), ' ', '-'))
+SET p.category_id = c.id;
+
+DROP INDEX idx_products_category ON products;
+
+ALTER TABLE products DROP COLUMN category;
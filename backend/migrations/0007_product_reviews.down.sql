@@ -0,0 +1,5 @@
+ALTER TABLE products DROP COLUMN review_count;
+
+DROP TABLE review_votes;
+
+DROP TABLE product_reviews;
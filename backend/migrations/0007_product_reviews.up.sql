@@ -0,0 +1,31 @@
+-- Reviews by verified buyers, one per user and product, and their helpful
+-- votes. products.rating and review_count are now derived from the reviews,
+-- so ratings set by hand before are cleared. images is a JSON list of
+-- {key, url, thumbnails}.
+CREATE TABLE product_reviews (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id VARCHAR(50) NOT NULL,
+    user_id INT NOT NULL,
+    rating TINYINT NOT NULL,
+    body TEXT NOT NULL,
+    images JSON NOT NULL,
+    helpful_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uq_product_reviews_user (product_id, user_id),
+    INDEX idx_product_reviews_rating (product_id, rating)
+);
+
+CREATE TABLE review_votes (
+    review_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id),
+    FOREIGN KEY (review_id) REFERENCES product_reviews(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE products ADD COLUMN review_count INT NOT NULL DEFAULT 0 AFTER rating;
+
+UPDATE products SET rating = 0;
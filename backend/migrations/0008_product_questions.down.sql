@@ -0,0 +1,7 @@
+DROP TABLE answer_votes;
+
+DROP TABLE question_votes;
+
+DROP TABLE question_answers;
+
+DROP TABLE product_questions;
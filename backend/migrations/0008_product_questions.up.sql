@@ -0,0 +1,52 @@
+-- Product Q&A. Questions and answers wait in pending until a moderator
+-- approves them (staff posts start approved); hidden ones are kept for the
+-- record. upvotes and downvotes count the votes below, one per user and item.
+CREATE TABLE product_questions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id VARCHAR(50) NOT NULL,
+    user_id INT NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    upvotes INT NOT NULL DEFAULT 0,
+    downvotes INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_product_questions_product (product_id, status),
+    INDEX idx_product_questions_status (status, created_at)
+);
+
+CREATE TABLE question_answers (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    question_id INT NOT NULL,
+    user_id INT NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    is_staff BOOLEAN NOT NULL DEFAULT FALSE,
+    is_verified_buyer BOOLEAN NOT NULL DEFAULT FALSE,
+    upvotes INT NOT NULL DEFAULT 0,
+    downvotes INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (question_id) REFERENCES product_questions(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_question_answers_question (question_id, status),
+    INDEX idx_question_answers_status (status, created_at)
+);
+
+CREATE TABLE question_votes (
+    question_id INT NOT NULL,
+    user_id INT NOT NULL,
+    value TINYINT NOT NULL,
+    PRIMARY KEY (question_id, user_id),
+    FOREIGN KEY (question_id) REFERENCES product_questions(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE answer_votes (
+    answer_id INT NOT NULL,
+    user_id INT NOT NULL,
+    value TINYINT NOT NULL,
+    PRIMARY KEY (answer_id, user_id),
+    FOREIGN KEY (answer_id) REFERENCES question_answers(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
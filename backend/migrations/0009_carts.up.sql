@@ -0,0 +1,29 @@
+-- Server-side carts, one per user. cart_items.price is the price when the
+-- line was added or last changed, to flag repriced lines; the live price is
+-- always read from products and product_variants. There is one line per
+-- product and variant, kept so by locking the cart row while adding (a
+-- unique key would let lines without a variant repeat, as NULLs never
+-- collide).
+CREATE TABLE carts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uq_carts_user (user_id)
+);
+
+CREATE TABLE cart_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    cart_id INT NOT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    variant_id INT NULL,
+    quantity INT NOT NULL,
+    selected BOOLEAN NOT NULL DEFAULT TRUE,
+    price INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (cart_id) REFERENCES carts(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    INDEX idx_cart_items_line (cart_id, product_id, variant_id)
+);
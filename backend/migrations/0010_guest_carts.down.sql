@@ -0,0 +1,7 @@
+DELETE FROM carts WHERE user_id IS NULL;
+
+ALTER TABLE carts
+    DROP INDEX idx_carts_updated,
+    DROP INDEX uq_carts_token,
+    DROP COLUMN token_hash,
+    MODIFY user_id INT NOT NULL;
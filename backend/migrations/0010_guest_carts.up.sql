@@ -0,0 +1,8 @@
+-- Guest carts. A cart belongs to a user or, before login, to the holder of
+-- an opaque cart token; only the token's SHA-256 hash is stored. Guest carts
+-- untouched for CART_GUEST_TTL are deleted, so updated_at is indexed.
+ALTER TABLE carts
+    MODIFY user_id INT NULL,
+    ADD COLUMN token_hash CHAR(64) NULL AFTER user_id,
+    ADD UNIQUE KEY uq_carts_token (token_hash),
+    ADD INDEX idx_carts_updated (updated_at);
@@ -0,0 +1,16 @@
+-- Wishlists, one line per user, product and variant (variant_id is NULL for
+-- the product as a whole). saved_price is the price when the line was saved,
+-- to flag price drops against the live price. Like cart lines, duplicates
+-- are kept out by locking rather than a unique key, as NULLs never collide.
+CREATE TABLE wishlist_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    variant_id INT NULL,
+    saved_price INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    INDEX idx_wishlist_items_line (user_id, product_id, variant_id)
+);
@@ -0,0 +1,14 @@
+ALTER TABLE orders
+    DROP COLUMN voucher_code,
+    DROP COLUMN discount,
+    DROP COLUMN subtotal;
+
+ALTER TABLE carts
+    DROP FOREIGN KEY fk_carts_voucher,
+    DROP COLUMN voucher_id;
+
+DROP TABLE voucher_redemptions;
+
+DROP TABLE voucher_claims;
+
+DROP TABLE vouchers;
@@ -0,0 +1,66 @@
+-- Vouchers. value is rupiah for fixed vouchers, a percentage for percentage
+-- vouchers (capped by max_discount when set) and the most shipping covered
+-- by free_shipping vouchers (0 covers all of it). usage_limit and
+-- per_user_limit of 0 mean unlimited. used_count is changed only while the
+-- voucher row is locked, together with voucher_redemptions, so a code
+-- cannot be spent past its limits by concurrent checkouts.
+CREATE TABLE vouchers (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(32) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    value INT NOT NULL,
+    max_discount INT NOT NULL DEFAULT 0,
+    min_purchase INT NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    usage_limit INT NOT NULL DEFAULT 0,
+    per_user_limit INT NOT NULL DEFAULT 1,
+    used_count INT NOT NULL DEFAULT 0,
+    terms TEXT NULL,
+    is_public BOOLEAN NOT NULL DEFAULT FALSE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_vouchers_code (code),
+    INDEX idx_vouchers_listing (is_public, is_active, expires_at)
+);
+
+-- Vouchers saved to a customer's "My vouchers"
+CREATE TABLE voucher_claims (
+    voucher_id INT NOT NULL,
+    user_id INT NOT NULL,
+    claimed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (voucher_id, user_id),
+    FOREIGN KEY (voucher_id) REFERENCES vouchers(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_voucher_claims_user (user_id)
+);
+
+-- One row per order that used a voucher; removed again when the order is
+-- cancelled
+CREATE TABLE voucher_redemptions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    voucher_id INT NOT NULL,
+    user_id INT NOT NULL,
+    order_id VARCHAR(50) NOT NULL,
+    discount INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (voucher_id) REFERENCES vouchers(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    UNIQUE KEY uq_voucher_redemptions_order (order_id),
+    INDEX idx_voucher_redemptions_user (voucher_id, user_id)
+);
+
+-- The voucher applied to a cart, checked again on every read
+ALTER TABLE carts
+    ADD COLUMN voucher_id INT NULL AFTER token_hash,
+    ADD CONSTRAINT fk_carts_voucher FOREIGN KEY (voucher_id) REFERENCES vouchers(id) ON DELETE SET NULL;
+
+-- Orders keep the subtotal before the discount and a snapshot of the code
+ALTER TABLE orders
+    ADD COLUMN subtotal INT NOT NULL DEFAULT 0 AFTER customer_id,
+    ADD COLUMN discount INT NOT NULL DEFAULT 0 AFTER subtotal,
+    ADD COLUMN voucher_code VARCHAR(32) NULL AFTER discount;
+
+UPDATE orders SET subtotal = total;
@@ -0,0 +1,14 @@
+ALTER TABLE order_items
+    DROP COLUMN total,
+    DROP COLUMN tax,
+    DROP COLUMN voucher_discount,
+    DROP COLUMN member_discount;
+
+ALTER TABLE orders
+    DROP COLUMN tax,
+    DROP COLUMN tax_included,
+    DROP COLUMN tax_rate,
+    DROP COLUMN shipping_discount,
+    DROP COLUMN shipping,
+    DROP COLUMN member_discount,
+    CHANGE COLUMN voucher_discount discount INT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+-- Orders keep the full price breakdown: the member discount, the voucher
+-- discount (renamed from discount), shipping and tax at the rate charged
+ALTER TABLE orders
+    CHANGE COLUMN discount voucher_discount INT NOT NULL DEFAULT 0,
+    ADD COLUMN member_discount INT NOT NULL DEFAULT 0 AFTER subtotal,
+    ADD COLUMN shipping INT NOT NULL DEFAULT 0 AFTER voucher_code,
+    ADD COLUMN shipping_discount INT NOT NULL DEFAULT 0 AFTER shipping,
+    ADD COLUMN tax_rate INT NOT NULL DEFAULT 0 AFTER shipping_discount,
+    ADD COLUMN tax_included BOOLEAN NOT NULL DEFAULT FALSE AFTER tax_rate,
+    ADD COLUMN tax INT NOT NULL DEFAULT 0 AFTER tax_included;
+
+-- Each item keeps its share of the discounts and tax, so the items of an
+-- order add up to its totals
+ALTER TABLE order_items
+    ADD COLUMN member_discount INT NOT NULL DEFAULT 0 AFTER price,
+    ADD COLUMN voucher_discount INT NOT NULL DEFAULT 0 AFTER member_discount,
+    ADD COLUMN tax INT NOT NULL DEFAULT 0 AFTER voucher_discount,
+    ADD COLUMN total INT NOT NULL DEFAULT 0 AFTER tax;
+
+UPDATE order_items SET total = price * quantity;
@@ -0,0 +1,11 @@
+ALTER TABLE orders
+    DROP INDEX uq_orders_checkout,
+    DROP COLUMN terms_accepted_at,
+    DROP COLUMN payment_method,
+    DROP COLUMN shipping_method,
+    DROP COLUMN shipping_address,
+    DROP COLUMN checkout_id;
+
+DROP TABLE checkout_items;
+
+DROP TABLE checkout_sessions;
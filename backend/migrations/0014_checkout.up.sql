@@ -0,0 +1,47 @@
+-- Checkout sessions between the cart and an order. The address is a JSON
+-- snapshot of the shipping step. A user has one open session at a time;
+-- placed sessions keep the order they became and when the terms were
+-- accepted.
+CREATE TABLE checkout_sessions (
+    id VARCHAR(50) PRIMARY KEY,
+    user_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    address JSON NULL,
+    shipping_method VARCHAR(20) NULL,
+    payment_method VARCHAR(20) NULL,
+    voucher_code VARCHAR(32) NULL,
+    order_id VARCHAR(50) NULL,
+    terms_accepted_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    INDEX idx_checkout_sessions_user (user_id, status)
+);
+
+-- The cart lines a session was started from. price is the price the
+-- customer last saw; the live price is read from products and
+-- product_variants. cart_item_id names the cart line removed when the order
+-- is placed (no foreign key, the line may be gone by then).
+CREATE TABLE checkout_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    checkout_id VARCHAR(50) NOT NULL,
+    cart_item_id INT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    variant_id INT NULL,
+    quantity INT NOT NULL,
+    price INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (checkout_id) REFERENCES checkout_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE SET NULL
+);
+
+-- Orders placed through checkout keep its choices
+ALTER TABLE orders
+    ADD COLUMN checkout_id VARCHAR(50) NULL AFTER customer_id,
+    ADD COLUMN shipping_address JSON NULL AFTER checkout_id,
+    ADD COLUMN shipping_method VARCHAR(20) NULL AFTER shipping_address,
+    ADD COLUMN payment_method VARCHAR(20) NULL AFTER shipping_method,
+    ADD COLUMN terms_accepted_at TIMESTAMP NULL AFTER payment_method,
+    ADD UNIQUE KEY uq_orders_checkout (checkout_id);
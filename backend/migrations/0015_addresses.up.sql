@@ -0,0 +1,28 @@
+-- Saved delivery addresses. Region names are stored next to their codes so
+-- an address reads the same if the bundled region data changes. Changes
+-- lock the user row so each user keeps exactly one default;
+-- default_user_id is set only on the default row, so the unique key refuses
+-- a second default even outside that lock (NULLs never collide).
+CREATE TABLE addresses (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    label VARCHAR(20) NOT NULL,
+    recipient_name VARCHAR(100) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    street VARCHAR(255) NOT NULL,
+    province_code VARCHAR(13) NOT NULL,
+    province VARCHAR(100) NOT NULL,
+    city_code VARCHAR(13) NOT NULL,
+    city VARCHAR(100) NOT NULL,
+    district_code VARCHAR(13) NOT NULL,
+    district VARCHAR(100) NOT NULL,
+    postal_code CHAR(5) NOT NULL,
+    notes VARCHAR(255) NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    default_user_id INT AS (IF(is_default, user_id, NULL)) STORED,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uq_addresses_default (default_user_id),
+    INDEX idx_addresses_user (user_id)
+);
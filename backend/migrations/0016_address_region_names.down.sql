@@ -0,0 +1,3 @@
+ALTER TABLE addresses
+    ADD COLUMN city_code VARCHAR(13) NOT NULL DEFAULT '' AFTER province,
+    ADD COLUMN district_code VARCHAR(13) NOT NULL DEFAULT '' AFTER city;
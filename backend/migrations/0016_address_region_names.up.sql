@@ -0,0 +1,5 @@
+-- Only the province list is bundled with the app; cities and districts are
+-- typed in by the customer, so their codes have nothing to refer to.
+ALTER TABLE addresses
+    DROP COLUMN district_code,
+    DROP COLUMN city_code;
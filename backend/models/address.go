@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Address labels
+const (
+    AddressHome   = "home"
+    AddressOffice = "office"
+    AddressOther  = "other"
+)
+
+// AddressLabels - The labels an address can have
+var AddressLabels = []string{AddressHome, AddressOffice, AddressOther}
+
+// Address - A saved delivery address of a customer. The province name is
+// kept next to its code so the address reads the same if the region data
+// changes. Every customer with addresses has exactly one default.
+type Address struct {
+    ID            int       `json:"id"`
+    UserID        int       `json:"user_id"`
+    Label         string    `json:"label"`
+    RecipientName string    `json:"recipient_name"`
+    Phone         string    `json:"phone"`
+    Street        string    `json:"street"`
+    ProvinceCode  string    `json:"province_code"`
+    Province      string    `json:"province"`
+    City          string    `json:"city"`
+    District      string    `json:"district"`
+    PostalCode    string    `json:"postal_code"`
+    Notes         string    `json:"notes,omitempty"`
+    IsDefault     bool      `json:"is_default"`
+    CreatedAt     time.Time `json:"created_at"`
+    UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ShippingAddress - The address as it is copied onto a checkout
+func (a Address) ShippingAddress() ShippingAddress {
+    return ShippingAddress{
+        RecipientName: a.RecipientName,
+        Phone:         a.Phone,
+        Street:        a.Street,
+        District:      a.District,
+        City:          a.City,
+        Province:      a.Province,
+        PostalCode:    a.PostalCode,
+        Notes:         a.Notes,
+    }
+}
+
+// AddressRequest - Body to create or replace an address. The province is
+// picked by its code; the city and district are given by name.
+type AddressRequest struct {
+    Label         string `json:"label"`
+    RecipientName string `json:"recipient_name"`
+    Phone         string `json:"phone"`
+    Street        string `json:"street"`
+    ProvinceCode  string `json:"province_code"`
+    City          string `json:"city"`
+    District      string `json:"district"`
+    PostalCode    string `json:"postal_code"`
+    Notes         string `json:"notes"`
+    IsDefault     bool   `json:"is_default"`
+}
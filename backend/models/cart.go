@@ -0,0 +1,119 @@
+package models
+
+import (
+    "strconv"
+    "time"
+)
+
+// CartItem - A line of a user's cart, one per product and variant. Name,
+// price and stock are read live on every request. PreviousPrice is the price
+// when the line was added or last changed, so Repriced tells the customer
+// the price moved since. Unavailable lines have no variant while the product
+// now sells variants.
+type CartItem struct {
+    ID            int       `json:"id"`
+    ProductID     string    `json:"product_id"`
+    ProductName   string    `json:"product_name"`
+    Image         string    `json:"image,omitempty"`
+    VariantID     int       `json:"variant_id,omitempty"`
+    VariantLabel  string    `json:"variant,omitempty"`
+    Quantity      int       `json:"quantity"`
+    Selected      bool      `json:"selected"`
+    Price         int       `json:"price"`
+    PreviousPrice int       `json:"previous_price"`
+    Subtotal      int       `json:"subtotal"`
+    Stock         int       `json:"stock"`
+    OutOfStock    bool      `json:"out_of_stock"`
+    LowStock      bool      `json:"low_stock"`
+    Repriced      bool      `json:"repriced"`
+    Unavailable   bool      `json:"unavailable"`
+    Warning       string    `json:"warning,omitempty"`
+    AddedAt       time.Time `json:"added_at"`
+}
+
+// Purchasable - Whether the line can go into an order as it is
+func (i CartItem) Purchasable() bool {
+    return !i.Unavailable && !i.OutOfStock && !i.LowStock
+}
+
+// CartSummary - The order summary card. Counts are in units. The price
+// breakdown covers the selected lines that can be bought.
+type CartSummary struct {
+    ItemCount     int `json:"item_count"`
+    SelectedCount int `json:"selected_count"`
+    PriceBreakdown
+}
+
+// AppliedVoucher - A voucher as checked by the pricing engine. The one on a
+// cart is checked again on every read; when it no longer fits the cart it
+// stays on it with the reason and takes nothing off. Discount includes
+// shipping covered by free shipping vouchers.
+type AppliedVoucher struct {
+    ID       int    `json:"id"`
+    Code     string `json:"code"`
+    Name     string `json:"name"`
+    Type     string `json:"type"`
+    Valid    bool   `json:"valid"`
+    Reason   string `json:"reason,omitempty"`
+    Message  string `json:"message,omitempty"`
+    Discount int    `json:"discount"`
+}
+
+type Cart struct {
+    Items   []CartItem      `json:"items"`
+    Voucher *AppliedVoucher `json:"voucher"`
+    Summary CartSummary     `json:"summary"`
+}
+
+// NewCart - Flag stock and price problems on the lines and count them. The
+// summary amounts are left to the pricing engine.
+func NewCart(items []CartItem) Cart {
+    cart := Cart{Items: items}
+    if cart.Items == nil {
+        cart.Items = []CartItem{}
+    }
+
+    for i := range cart.Items {
+        item := &cart.Items[i]
+        item.OutOfStock = !item.Unavailable && item.Stock <= 0
+        item.LowStock = !item.Unavailable && !item.OutOfStock && item.Stock < item.Quantity
+        item.Repriced = item.Price != item.PreviousPrice
+        item.Subtotal = item.Price * item.Quantity
+        switch {
+        case item.Unavailable:
+            item.Warning = "Choose a variant of this product again"
+        case item.OutOfStock:
+            item.Warning = "Out of stock"
+        case item.LowStock:
+            item.Warning = "Only " + strconv.Itoa(item.Stock) + " left in stock"
+        }
+
+        cart.Summary.ItemCount += item.Quantity
+        if item.Selected && item.Purchasable() {
+            cart.Summary.SelectedCount += item.Quantity
+        }
+    }
+
+    return cart
+}
+
+// CartItemRequest - Body for adding a product to the cart. VariantID is
+// required for products that have variants.
+type CartItemRequest struct {
+    ProductID string `json:"product_id"`
+    VariantID int    `json:"variant_id,omitempty"`
+    Quantity  int    `json:"quantity"`
+}
+
+// CartItemUpdateRequest - Fields left out keep their value
+type CartItemUpdateRequest struct {
+    Quantity *int  `json:"quantity"`
+    Selected *bool `json:"selected"`
+}
+
+// CartBulkRequest - Lines for the bulk actions. An empty ItemIDs means every
+// line; Selected is only read by the select action.
+type CartBulkRequest struct {
+    ItemIDs  []int `json:"item_ids"`
+    Selected bool  `json:"selected"`
+}
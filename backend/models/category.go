@@ -0,0 +1,143 @@
+package models
+
+import (
+    "sort"
+    "strings"
+    "time"
+    "unicode"
+)
+
+// Category - A node of the category tree. ParentID is nil for top level
+// categories. Children is only filled in by the tree endpoint and Path by
+// the single category endpoint.
+type Category struct {
+    ID        int          `json:"id"`
+    ParentID  *int         `json:"parent_id"`
+    Name      string       `json:"name"`
+    Slug      string       `json:"slug"`
+    Image     string       `json:"image"`
+    SortOrder int          `json:"sort_order"`
+    CreatedAt time.Time    `json:"created_at"`
+    Path      []Breadcrumb `json:"path,omitempty"`
+    Children  []Category   `json:"children,omitempty"`
+}
+
+// Breadcrumb - One step of the path from the top of the tree to a category
+type Breadcrumb struct {
+    ID   int    `json:"id"`
+    Name string `json:"name"`
+    Slug string `json:"slug"`
+}
+
+// CategoryRequest - Body for creating or replacing a category. An empty
+// slug is derived from the name.
+type CategoryRequest struct {
+    ParentID  *int   `json:"parent_id"`
+    Name      string `json:"name"`
+    Slug      string `json:"slug"`
+    Image     string `json:"image"`
+    SortOrder int    `json:"sort_order"`
+}
+
+// Slugify - Lowercase letters and digits joined by single hyphens,
+// e.g. "Laptop & Gaming" becomes "laptop-gaming"
+func Slugify(s string) string {
+    var b strings.Builder
+    hyphen := false
+    for _, r := range strings.ToLower(s) {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            if hyphen && b.Len() > 0 {
+                b.WriteByte('-')
+            }
+            b.WriteRune(r)
+            hyphen = false
+        } else {
+            hyphen = true
+        }
+    }
+    return b.String()
+}
+
+// SortCategories - Sort order, then name, the order siblings are shown in
+func SortCategories(categories []Category) {
+    sort.SliceStable(categories, func(i, j int) bool {
+        a, b := categories[i], categories[j]
+        if a.SortOrder != b.SortOrder {
+            return a.SortOrder < b.SortOrder
+        }
+        return a.Name < b.Name
+    })
+}
+
+// CategoryTree - Nest a flat list of categories under their parents.
+// Categories whose parent is missing are treated as top level.
+func CategoryTree(categories []Category) []Category {
+    byID := make(map[int]bool, len(categories))
+    children := make(map[int][]Category)
+    roots := []Category{}
+    for _, c := range categories {
+        byID[c.ID] = true
+    }
+    for _, c := range categories {
+        if c.ParentID != nil && byID[*c.ParentID] {
+            children[*c.ParentID] = append(children[*c.ParentID], c)
+        } else {
+            roots = append(roots, c)
+        }
+    }
+
+    var attach func(nodes []Category) []Category
+    attach = func(nodes []Category) []Category {
+        SortCategories(nodes)
+        for i := range nodes {
+            if kids, ok := children[nodes[i].ID]; ok {
+                nodes[i].Children = attach(kids)
+            }
+        }
+        return nodes
+    }
+    return attach(roots)
+}
+
+// CategoryPath - Breadcrumbs from the top of the tree down to the category,
+// nil when it is not in the list
+func CategoryPath(categories []Category, id int) []Breadcrumb {
+    byID := make(map[int]Category, len(categories))
+    for _, c := range categories {
+        byID[c.ID] = c
+    }
+
+    var path []Breadcrumb
+    seen := make(map[int]bool)
+    for c, ok := byID[id]; ok && !seen[c.ID]; {
+        seen[c.ID] = true
+        path = append([]Breadcrumb{{ID: c.ID, Name: c.Name, Slug: c.Slug}}, path...)
+        if c.ParentID == nil {
+            break
+        }
+        c, ok = byID[*c.ParentID]
+    }
+    return path
+}
+
+// CategoryDescendants - The category and every category below it
+func CategoryDescendants(categories []Category, id int) []int {
+    children := make(map[int][]int)
+    for _, c := range categories {
+        if c.ParentID != nil {
+            children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+        }
+    }
+
+    ids := []int{id}
+    seen := map[int]bool{id: true}
+    for i := 0; i < len(ids); i++ {
+        for _, child := range children[ids[i]] {
+            if !seen[child] {
+                seen[child] = true
+                ids = append(ids, child)
+            }
+        }
+    }
+    return ids
+}
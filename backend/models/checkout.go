@@ -0,0 +1,152 @@
+package models
+
+import "time"
+
+// Checkout statuses
+const (
+    CheckoutOpen   = "open"
+    CheckoutPlaced = "placed"
+)
+
+// Checkout steps, in the order the checkout page shows them
+const (
+    CheckoutStepShipping = "shipping"
+    CheckoutStepPayment  = "payment"
+    CheckoutStepReview   = "review"
+)
+
+// ShippingAddress - Where an order is delivered
+type ShippingAddress struct {
+    RecipientName string `json:"recipient_name"`
+    Phone         string `json:"phone"`
+    Street        string `json:"street"`
+    District      string `json:"district,omitempty"`
+    City          string `json:"city"`
+    Province      string `json:"province"`
+    PostalCode    string `json:"postal_code"`
+    Notes         string `json:"notes,omitempty"`
+}
+
+// ShippingMethod - A delivery option with a flat fee and its delivery
+// estimate in days
+type ShippingMethod struct {
+    Code    string `json:"code"`
+    Name    string `json:"name"`
+    Fee     int    `json:"fee"`
+    MinDays int    `json:"min_days"`
+    MaxDays int    `json:"max_days"`
+}
+
+// ShippingMethods - Delivery options offered at checkout
+var ShippingMethods = []ShippingMethod{
+    {Code: "regular", Name: "Regular", Fee: 15000, MinDays: 3, MaxDays: 5},
+    {Code: "express", Name: "Express", Fee: 30000, MinDays: 1, MaxDays: 2},
+    {Code: "same_day", Name: "Same Day", Fee: 50000, MinDays: 0, MaxDays: 0},
+}
+
+// FindShippingMethod - The delivery option with the code
+func FindShippingMethod(code string) (ShippingMethod, bool) {
+    for _, m := range ShippingMethods {
+        if m.Code == code {
+            return m, true
+        }
+    }
+    return ShippingMethod{}, false
+}
+
+// PaymentBalance - Pays the whole order from the customer's balance when it
+// is placed
+const PaymentBalance = "balance"
+
+// PaymentMethod - A way to pay for an order
+type PaymentMethod struct {
+    Code string `json:"code"`
+    Name string `json:"name"`
+}
+
+// PaymentMethods - Ways to pay offered at checkout
+var PaymentMethods = []PaymentMethod{
+    {Code: "bank_transfer", Name: "Bank Transfer"},
+    {Code: "virtual_account", Name: "Virtual Account"},
+    {Code: "e_wallet", Name: "E-Wallet"},
+    {Code: "cod", Name: "Cash on Delivery"},
+    {Code: PaymentBalance, Name: "Balance"},
+}
+
+// FindPaymentMethod - The way to pay with the code
+func FindPaymentMethod(code string) (PaymentMethod, bool) {
+    for _, m := range PaymentMethods {
+        if m.Code == code {
+            return m, true
+        }
+    }
+    return PaymentMethod{}, false
+}
+
+// Checkout - A checkout session. Items are the selected cart lines frozen
+// when it started, with live name, price and stock; PreviousPrice is the
+// price the customer last saw, so Repriced lines must be reviewed before
+// the order is placed. Step is the first step still to do, and Ready tells
+// whether the order can be placed as it is.
+type Checkout struct {
+    ID              string           `json:"id"`
+    UserID          int              `json:"user_id"`
+    Status          string           `json:"status"`
+    Step            string           `json:"step"`
+    Ready           bool             `json:"ready"`
+    Items           []CartItem       `json:"items"`
+    Address         *ShippingAddress `json:"address"`
+    ShippingMethod  string           `json:"shipping_method,omitempty"`
+    PaymentMethod   string           `json:"payment_method,omitempty"`
+    VoucherCode     string           `json:"voucher_code,omitempty"`
+    Voucher         *AppliedVoucher  `json:"voucher"`
+    Summary         PriceBreakdown   `json:"summary"`
+    OrderID         string           `json:"order_id,omitempty"`
+    TermsAcceptedAt *time.Time       `json:"terms_accepted_at,omitempty"`
+    ExpiresAt       time.Time        `json:"expires_at"`
+    CreatedAt       time.Time        `json:"created_at"`
+}
+
+// NextStep - The first step the customer has not completed
+func (c Checkout) NextStep() string {
+    switch {
+    case c.Address == nil || c.ShippingMethod == "":
+        return CheckoutStepShipping
+    case c.PaymentMethod == "":
+        return CheckoutStepPayment
+    }
+    return CheckoutStepReview
+}
+
+// CheckoutSummary - The read-only review of what the order will be
+type CheckoutSummary struct {
+    CheckoutID     string           `json:"checkout_id"`
+    Ready          bool             `json:"ready"`
+    Items          []CartItem       `json:"items"`
+    Address        *ShippingAddress `json:"address"`
+    ShippingMethod *ShippingMethod  `json:"shipping_method"`
+    PaymentMethod  *PaymentMethod   `json:"payment_method"`
+    Voucher        *AppliedVoucher  `json:"voucher"`
+    Price          PriceBreakdown   `json:"price"`
+    ExpiresAt      time.Time        `json:"expires_at"`
+}
+
+// CheckoutShippingRequest - Body of the shipping step. AddressID picks a
+// saved address instead of sending one.
+type CheckoutShippingRequest struct {
+    AddressID      int             `json:"address_id"`
+    Address        ShippingAddress `json:"address"`
+    ShippingMethod string          `json:"shipping_method"`
+}
+
+// CheckoutPaymentRequest - Body of the payment step. VoucherCode, when
+// sent, replaces the voucher brought from the cart; empty removes it.
+type CheckoutPaymentRequest struct {
+    PaymentMethod string  `json:"payment_method"`
+    VoucherCode   *string `json:"voucher_code"`
+}
+
+// CheckoutPlaceRequest - Body of the place order action
+type CheckoutPlaceRequest struct {
+    AcceptTerms bool `json:"accept_terms"`
+}
@@ -2,27 +2,238 @@ package models
 
 import "time"
 
+// Order - The price breakdown of the order as charged (see PriceBreakdown):
+// Total is Subtotal less the member, voucher and shipping discounts plus
+// Shipping, plus Tax unless TaxIncluded. VoucherCode is a snapshot of the
+// code used, if any. Orders placed through a checkout session keep its ID,
+// the delivery and payment choices and when the terms were accepted.
 type Order struct {
-    ID         string      `json:"id"`
-    CustomerID int         `json:"customer_id"`
-    Items      []OrderItem `json:"items,omitempty"`
-    Total      int         `json:"total"`
-    Status     string      `json:"status"`
-    CreatedAt  time.Time   `json:"created_at"`
+    ID               string           `json:"id"`
+    CustomerID       int              `json:"customer_id"`
+    CheckoutID       string           `json:"checkout_id,omitempty"`
+    Items            []OrderItem      `json:"items,omitempty"`
+    ShippingAddress  *ShippingAddress `json:"shipping_address,omitempty"`
+    ShippingMethod   string           `json:"shipping_method,omitempty"`
+    PaymentMethod    string           `json:"payment_method,omitempty"`
+    TermsAcceptedAt  *time.Time       `json:"terms_accepted_at,omitempty"`
+    Subtotal         int              `json:"subtotal"`
+    MemberDiscount   int              `json:"member_discount"`
+    VoucherDiscount  int              `json:"voucher_discount"`
+    VoucherCode      string           `json:"voucher_code,omitempty"`
+    Shipping         int              `json:"shipping"`
+    ShippingDiscount int              `json:"shipping_discount"`
+    TaxRate          int              `json:"tax_rate"`
+    TaxIncluded      bool             `json:"tax_included"`
+    Tax              int              `json:"tax"`
+    Total            int              `json:"total"`
+    BalancePaid      int              `json:"balance_paid"`
+    Status           string           `json:"status"`
+    CreatedAt        time.Time        `json:"created_at"`
 }
 
+// Price - Take the amounts of a breakdown of the order's items, in the
+// same order
+func (o *Order) Price(b PriceBreakdown) {
+    o.Subtotal = b.Subtotal
+    o.MemberDiscount = b.MemberDiscount
+    o.VoucherDiscount = b.VoucherDiscount
+    o.Shipping = b.Shipping
+    o.ShippingDiscount = b.ShippingDiscount
+    o.TaxRate = b.TaxRate
+    o.TaxIncluded = b.TaxIncluded
+    o.Tax = b.Tax
+    o.Total = b.Total
+    for i, line := range b.Lines {
+        item := &o.Items[i]
+        item.MemberDiscount = line.MemberDiscount
+        item.VoucherDiscount = line.VoucherDiscount
+        item.Tax = line.Tax
+        item.Total = line.Total
+    }
+}
+
+// OrderItem - VariantLabel is a snapshot, so the item still reads right
+// after the variant is changed or deleted. The discounts, tax and total are
+// the item's share of the order's.
 type OrderItem struct {
-    ID        int    `json:"id"`
-    OrderID   string `json:"order_id"`
+    ID              int    `json:"id"`
+    OrderID         string `json:"order_id"`
+    ProductID       string `json:"product_id"`
+    ProductName     string `json:"product_name,omitempty"`
+    VariantID       int    `json:"variant_id,omitempty"`
+    VariantLabel    string `json:"variant,omitempty"`
+    Quantity        int    `json:"quantity"`
+    Price           int    `json:"price"`
+    MemberDiscount  int    `json:"member_discount"`
+    VoucherDiscount int    `json:"voucher_discount"`
+    Tax             int    `json:"tax"`
+    Total           int    `json:"total"`
+    // AcceptedPrice - The unit price the customer agreed to at checkout;
+    // zero when there is none to hold the order to
+    AcceptedPrice int `json:"-"`
+}
+
+// OrderItemRequest - VariantID is required for products that have variants
+type OrderItemRequest struct {
     ProductID string `json:"product_id"`
+    VariantID int    `json:"variant_id,omitempty"`
     Quantity  int    `json:"quantity"`
-    Price     int    `json:"price"`
 }
 
+// OrderCreateRequest - CustomerID defaults to the authenticated user.
+// VoucherCode is optional and checked for the customer.
 type OrderCreateRequest struct {
-    CustomerID int `json:"customer_id"`
-    Items      []struct {
-        ProductID string `json:"product_id"`
-        Quantity  int    `json:"quantity"`
-    } `json:"items"`
-}
\ No newline at end of file
+    CustomerID    int                `json:"customer_id"`
+    Items         []OrderItemRequest `json:"items"`
+    VoucherCode   string             `json:"voucher_code"`
+    PaymentMethod string             `json:"payment_method"`
+}
+
+// StockShortage - Item that cannot be fulfilled with the current stock
+type StockShortage struct {
+    ProductID string `json:"product_id"`
+    VariantID int    `json:"variant_id,omitempty"`
+    Requested int    `json:"requested"`
+    Available int    `json:"available"`
+}
+
+
+// Order lifecycle statuses
+const (
+    OrderStatusPendingPayment = "pending_payment"
+    OrderStatusPaid           = "paid"
+    OrderStatusProcessing     = "processing"
+    OrderStatusShipped        = "shipped"
+    OrderStatusDelivered      = "delivered"
+    OrderStatusCompleted      = "completed"
+    OrderStatusCancelled      = "cancelled"
+    OrderStatusRefunded       = "refunded"
+
+    // Legacy default of the orders.status column, treated as pending_payment
+    OrderStatusLegacyPending = "pending"
+)
+
+// OrderStatusFlow - Happy path of an order, in the order it is shown on the timeline
+var OrderStatusFlow = []string{
+    OrderStatusPendingPayment,
+    OrderStatusPaid,
+    OrderStatusProcessing,
+    OrderStatusShipped,
+    OrderStatusDelivered,
+    OrderStatusCompleted,
+}
+
+// OrderStatusTransitions - Allowed next statuses for each status
+var OrderStatusTransitions = map[string][]string{
+    OrderStatusPendingPayment: {OrderStatusPaid, OrderStatusCancelled},
+    OrderStatusPaid:           {OrderStatusProcessing, OrderStatusCancelled, OrderStatusRefunded},
+    OrderStatusProcessing:     {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+    OrderStatusShipped:        {OrderStatusDelivered},
+    OrderStatusDelivered:      {OrderStatusCompleted, OrderStatusRefunded},
+    OrderStatusCompleted:      {},
+    OrderStatusCancelled:      {},
+    OrderStatusRefunded:       {},
+}
+
+// OrderStatusLabels - Human readable status names for the timeline
+var OrderStatusLabels = map[string]string{
+    OrderStatusPendingPayment: "Waiting for Payment",
+    OrderStatusPaid:           "Payment Confirmed",
+    OrderStatusProcessing:     "Being Packed",
+    OrderStatusShipped:        "Shipped",
+    OrderStatusDelivered:      "Delivered",
+    OrderStatusCompleted:      "Completed",
+    OrderStatusCancelled:      "Cancelled",
+    OrderStatusRefunded:       "Refunded",
+}
+
+// NormalizeOrderStatus - Map legacy statuses onto the current lifecycle
+func NormalizeOrderStatus(status string) string {
+    if status == OrderStatusLegacyPending {
+        return OrderStatusPendingPayment
+    }
+    return status
+}
+
+// IsValidOrderStatus - Check whether a status is part of the lifecycle
+func IsValidOrderStatus(status string) bool {
+    _, ok := OrderStatusTransitions[status]
+    return ok
+}
+
+// CanTransitionOrder - Check whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+    for _, next := range OrderStatusTransitions[NormalizeOrderStatus(from)] {
+        if next == to {
+            return true
+        }
+    }
+    return false
+}
+
+// OrderStatusTabs - Order history tabs and the statuses each one groups
+var OrderStatusTabs = map[string][]string{
+    "to_pay":     {OrderStatusPendingPayment, OrderStatusLegacyPending},
+    "to_ship":    {OrderStatusPaid, OrderStatusProcessing},
+    "to_receive": {OrderStatusShipped, OrderStatusDelivered},
+    "completed":  {OrderStatusCompleted},
+    "cancelled":  {OrderStatusCancelled, OrderStatusRefunded},
+}
+
+// OrderListResponse - Order list with per-tab badge counts
+type OrderListResponse struct {
+    Orders []Order        `json:"orders"`
+    Counts map[string]int `json:"counts"`
+}
+
+// OrderEvent - One recorded status change of an order
+type OrderEvent struct {
+    ID         int       `json:"id"`
+    OrderID    string    `json:"order_id"`
+    FromStatus string    `json:"from_status,omitempty"`
+    ToStatus   string    `json:"to_status"`
+    Actor      string    `json:"actor"`
+    Note       string    `json:"note,omitempty"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+type OrderStatusUpdateRequest struct {
+    Status string `json:"status"`
+    Note   string `json:"note"`
+}
+
+// OrderTimelineStep - One step of the order details timeline
+type OrderTimelineStep struct {
+    Status    string     `json:"status"`
+    Label     string     `json:"label"`
+    Completed bool       `json:"completed"`
+    Current   bool       `json:"current"`
+    At        *time.Time `json:"at,omitempty"`
+}
+
+type OrderTimeline struct {
+    OrderID string              `json:"order_id"`
+    Status  string              `json:"status"`
+    Steps   []OrderTimelineStep `json:"steps"`
+    Events  []OrderEvent        `json:"events"`
+}
+
+// OrderCancelRequest - Optional body of the cancel action
+type OrderCancelRequest struct {
+    Reason string `json:"reason"`
+}
+
+// ReorderLine - An item of a past order priced at today's price
+type ReorderLine struct {
+    ProductID     string `json:"product_id"`
+    ProductName   string `json:"product_name"`
+    VariantID     int    `json:"variant_id,omitempty"`
+    VariantLabel  string `json:"variant,omitempty"`
+    Quantity      int    `json:"quantity"`
+    Price         int    `json:"price"`
+    PreviousPrice int    `json:"previous_price"`
+    Stock         int    `json:"stock"`
+    OutOfStock    bool   `json:"out_of_stock"`
+    LowStock      bool   `json:"low_stock"`
+    Repriced      bool   `json:"repriced"`
+}
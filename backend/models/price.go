@@ -0,0 +1,35 @@
+package models
+
+// PriceLine - One line of a price breakdown. ProductID, VariantID, Quantity
+// and UnitPrice go in; the rest is filled in by the pricing engine. Total is
+// what the line costs after its discounts, with its share of the tax added
+// unless prices include tax.
+type PriceLine struct {
+    ProductID       string `json:"product_id"`
+    VariantID       int    `json:"variant_id,omitempty"`
+    Quantity        int    `json:"quantity"`
+    UnitPrice       int    `json:"unit_price"`
+    Subtotal        int    `json:"subtotal"`
+    MemberDiscount  int    `json:"member_discount"`
+    VoucherDiscount int    `json:"voucher_discount"`
+    Tax             int    `json:"tax"`
+    Total           int    `json:"total"`
+}
+
+// PriceBreakdown - What a customer pays, in whole rupiah. Discount adds up
+// the member, voucher and shipping discounts. Total is Subtotal less
+// Discount plus Shipping, plus Tax unless TaxIncluded (prices already
+// contain it, so it is only shown).
+type PriceBreakdown struct {
+    Lines            []PriceLine `json:"lines"`
+    Subtotal         int         `json:"subtotal"`
+    MemberDiscount   int         `json:"member_discount"`
+    VoucherDiscount  int         `json:"voucher_discount"`
+    Shipping         int         `json:"shipping"`
+    ShippingDiscount int         `json:"shipping_discount"`
+    Discount         int         `json:"discount"`
+    TaxRate          int         `json:"tax_rate"`
+    TaxIncluded      bool        `json:"tax_included"`
+    Tax              int         `json:"tax"`
+    Total            int         `json:"total"`
+}
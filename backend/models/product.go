@@ -1,30 +1,243 @@
 package models
 
-import "time"
+import (
+    "sort"
+    "strings"
+    "time"
+)
 
+// Product - Stock is the product's own stock. Products with variants sell
+// their variants instead; details responses then report the variants' total.
+// Image is the primary image's medium thumbnail, for product cards.
+// Category is the name of the category CategoryID refers to. Rating and
+// ReviewCount are kept up to date from the reviews. SoldCount counts units
+// on completed orders. Description, Features, Specs and
+// Breadcrumbs are only loaded for the details page.
 type Product struct {
-    ID        string    `json:"id"`
-    Name      string    `json:"name"`
-    Price     int       `json:"price"`
-    Stock     int       `json:"stock"`
-    Category  string    `json:"category"`
-    Rating    float64   `json:"rating"`
-    CreatedAt time.Time `json:"created_at"`
+    ID          string           `json:"id"`
+    Name        string           `json:"name"`
+    Price       int              `json:"price"`
+    Stock       int              `json:"stock"`
+    CategoryID  *int             `json:"category_id"`
+    Category    string           `json:"category"`
+    Breadcrumbs []Breadcrumb     `json:"breadcrumbs,omitempty"`
+    Brand       string           `json:"brand"`
+    Tags        []string         `json:"tags"`
+    Rating      float64          `json:"rating"`
+    ReviewCount int              `json:"review_count"`
+    SoldCount   int              `json:"sold_count"`
+    Image       string           `json:"image,omitempty"`
+    Description string           `json:"description,omitempty"`
+    Features    []string         `json:"features,omitempty"`
+    Specs       []SpecGroup      `json:"specs,omitempty"`
+    Images      []ProductImage   `json:"images,omitempty"`
+    Options     []ProductOption  `json:"options,omitempty"`
+    Variants    []ProductVariant `json:"variants,omitempty"`
+    CreatedAt   time.Time        `json:"created_at"`
+}
+
+// SpecGroup - A titled section of the specifications table, e.g. "Display"
+type SpecGroup struct {
+    Name  string     `json:"name"`
+    Items []SpecItem `json:"items"`
+}
+
+// SpecItem - One row of the specifications table
+type SpecItem struct {
+    Label string `json:"label"`
+    Value string `json:"value"`
+}
+
+// FacetCount - A filter value with the number of matching products
+type FacetCount struct {
+    Value string `json:"value"`
+    Count int    `json:"count"`
+}
+
+// ProductFacets - Filter values for the listing sidebar
+type ProductFacets struct {
+    Brands []FacetCount `json:"brands"`
+}
+
+// ProductImage - An uploaded image in a product's gallery. Galleries are
+// ordered by Position and the primary image is the product's cover.
+type ProductImage struct {
+    ID          int               `json:"id"`
+    ProductID   string            `json:"product_id"`
+    Key         string            `json:"-"`
+    URL         string            `json:"url"`
+    Thumbnails  map[string]string `json:"thumbnails"`
+    ContentType string            `json:"content_type"`
+    Width       int               `json:"width"`
+    Height      int               `json:"height"`
+    Size        int64             `json:"size"`
+    Position    int               `json:"position"`
+    IsPrimary   bool              `json:"is_primary"`
+    CreatedAt   time.Time         `json:"created_at"`
+}
+
+// CardThumbnail - Thumbnail size used for Product.Image
+const CardThumbnail = "medium"
+
+// Cover - URL for product cards: the primary image's card thumbnail
+func Cover(images []ProductImage) string {
+    for _, image := range images {
+        if image.IsPrimary {
+            return image.Thumbnails[CardThumbnail]
+        }
+    }
+    return ""
+}
+
+// ProductImageOrderRequest - Every image ID of the product, in the new order
+type ProductImageOrderRequest struct {
+    ImageIDs []int `json:"image_ids"`
+}
+
+// VariantOption - One option of a variant, e.g. color = Black
+type VariantOption struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+// ProductVariant - A purchasable combination of options with its own SKU,
+// stock and optionally its own price
+type ProductVariant struct {
+    ID            int             `json:"id"`
+    ProductID     string          `json:"product_id"`
+    SKU           string          `json:"sku"`
+    Options       []VariantOption `json:"options"`
+    PriceOverride *int            `json:"price_override,omitempty"`
+    Price         int             `json:"price"`
+    Stock         int             `json:"stock"`
+    InStock       bool            `json:"in_stock"`
+    Images        []string        `json:"images,omitempty"`
+}
+
+// Label - Option values joined for display, e.g. "Black / 256GB"
+func (v ProductVariant) Label() string {
+    values := make([]string, len(v.Options))
+    for i, o := range v.Options {
+        values[i] = o.Value
+    }
+    return strings.Join(values, " / ")
+}
+
+// Key - Normalized option combination, used to reject duplicate variants
+func (v ProductVariant) Key() string {
+    pairs := make([]string, len(v.Options))
+    for i, o := range v.Options {
+        pairs[i] = strings.ToLower(o.Name) + "=" + strings.ToLower(o.Value)
+    }
+    sort.Strings(pairs)
+    return strings.Join(pairs, ";")
+}
+
+// ProductOption - Option with every value offered, for swatches and chips
+type ProductOption struct {
+    Name   string               `json:"name"`
+    Values []ProductOptionValue `json:"values"`
+}
+
+// ProductOptionValue - InStock is true when any variant with this value has stock
+type ProductOptionValue struct {
+    Value   string `json:"value"`
+    InStock bool   `json:"in_stock"`
+}
+
+// ApplyVariants - Attach variants to the product: resolve their prices,
+// build the option matrix and report the variants' total stock
+func (p *Product) ApplyVariants(variants []ProductVariant) {
+    if len(variants) == 0 {
+        return
+    }
+
+    p.Variants = variants
+    p.Options = nil
+    p.Stock = 0
+
+    optionIndex := make(map[string]int)
+    valueIndex := make(map[string]int)
+    for i := range p.Variants {
+        v := &p.Variants[i]
+        v.Price = p.Price
+        if v.PriceOverride != nil {
+            v.Price = *v.PriceOverride
+        }
+        v.InStock = v.Stock > 0
+        p.Stock += v.Stock
+
+        for _, o := range v.Options {
+            oi, ok := optionIndex[o.Name]
+            if !ok {
+                oi = len(p.Options)
+                optionIndex[o.Name] = oi
+                p.Options = append(p.Options, ProductOption{Name: o.Name})
+            }
+
+            key := o.Name + "=" + o.Value
+            vi, ok := valueIndex[key]
+            if !ok {
+                vi = len(p.Options[oi].Values)
+                valueIndex[key] = vi
+                p.Options[oi].Values = append(p.Options[oi].Values, ProductOptionValue{Value: o.Value})
+            }
+            if v.InStock {
+                p.Options[oi].Values[vi].InStock = true
+            }
+        }
+    }
+}
+
+// ProductVariantRequest - Body for creating or replacing a variant. A nil
+// price uses the product's price.
+type ProductVariantRequest struct {
+    SKU     string          `json:"sku"`
+    Options []VariantOption `json:"options"`
+    Price   *int            `json:"price"`
+    Stock   int             `json:"stock"`
+    Images  []string        `json:"images"`
+}
+
+// ProductContent - Descriptive fields shared by the create and update
+// requests. Tags are labels for product cards such as "new", "hot" or "sale".
+type ProductContent struct {
+    Brand       string      `json:"brand"`
+    Description string      `json:"description"`
+    Features    []string    `json:"features"`
+    Specs       []SpecGroup `json:"specs"`
+    Tags        []string    `json:"tags"`
+}
+
+// Apply - Copy the content onto a product
+func (c ProductContent) Apply(p *Product) {
+    p.Brand = c.Brand
+    p.Description = c.Description
+    p.Features = c.Features
+    p.Specs = c.Specs
+    p.Tags = c.Tags
 }
 
 type ProductCreateRequest struct {
-    ID       string  `json:"id"`
-    Name     string  `json:"name"`
-    Price    int     `json:"price"`
-    Stock    int     `json:"stock"`
-    Category string  `json:"category"`
-    Rating   float64 `json:"rating"`
+    ID         string `json:"id"`
+    Name       string `json:"name"`
+    Price      int    `json:"price"`
+    Stock      int    `json:"stock"`
+    CategoryID *int   `json:"category_id"`
+    ProductContent
 }
 
 type ProductUpdateRequest struct {
-    Name     string  `json:"name,omitempty"`
-    Price    int     `json:"price,omitempty"`
-    Stock    int     `json:"stock,omitempty"`
-    Category string  `json:"category,omitempty"`
-    Rating   float64 `json:"rating,omitempty"`
-}
\ No newline at end of file
+    Name       string `json:"name,omitempty"`
+    Price      int    `json:"price,omitempty"`
+    Stock      int    `json:"stock,omitempty"`
+    CategoryID *int   `json:"category_id,omitempty"`
+    ProductContent
+}
+// ProductSearchResult - Product with its search relevance and the name with
+// matched words wrapped in <mark> tags
+type ProductSearchResult struct {
+    Product
+    Score     float64 `json:"score"`
+    Highlight string  `json:"highlight"`
+}
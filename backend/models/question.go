@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Moderation states of questions and answers. Customers' posts wait in
+// pending until a moderator approves them; only approved posts are public.
+const (
+    ModerationPending  = "pending"
+    ModerationApproved = "approved"
+    ModerationHidden   = "hidden"
+)
+
+// ModerationStatuses - Every moderation state
+var ModerationStatuses = []string{ModerationPending, ModerationApproved, ModerationHidden}
+
+// Question - A question on a product's Q&A tab. Score is upvotes minus
+// downvotes.
+type Question struct {
+    ID        int       `json:"id"`
+    ProductID string    `json:"product_id"`
+    UserID    int       `json:"user_id"`
+    UserName  string    `json:"user_name"`
+    Body      string    `json:"body"`
+    Status    string    `json:"status"`
+    Upvotes   int       `json:"upvotes"`
+    Downvotes int       `json:"downvotes"`
+    Score     int       `json:"score"`
+    Answers   []Answer  `json:"answers"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Answer - An answer to a question. IsStaff and IsVerifiedBuyer are decided
+// when the answer is written.
+type Answer struct {
+    ID              int       `json:"id"`
+    QuestionID      int       `json:"question_id"`
+    ProductID       string    `json:"product_id"`
+    UserID          int       `json:"user_id"`
+    UserName        string    `json:"user_name"`
+    Body            string    `json:"body"`
+    Status          string    `json:"status"`
+    IsStaff         bool      `json:"is_staff"`
+    IsVerifiedBuyer bool      `json:"is_verified_buyer"`
+    Upvotes         int       `json:"upvotes"`
+    Downvotes       int       `json:"downvotes"`
+    Score           int       `json:"score"`
+    CreatedAt       time.Time `json:"created_at"`
+}
+
+// QuestionRequest - Body for asking a question or writing an answer
+type QuestionRequest struct {
+    Body string `json:"body"`
+}
+
+// VoteRequest - 1 for an upvote, -1 for a downvote, 0 takes the vote back
+type VoteRequest struct {
+    Value int `json:"value"`
+}
+
+// VoteTally - Votes on a question or answer after a vote
+type VoteTally struct {
+    ID        int `json:"id"`
+    Upvotes   int `json:"upvotes"`
+    Downvotes int `json:"downvotes"`
+    Score     int `json:"score"`
+    Vote      int `json:"vote"`
+}
+
+// ModerationRequest - Body for changing a question's or answer's status
+type ModerationRequest struct {
+    Status string `json:"status"`
+}
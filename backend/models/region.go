@@ -0,0 +1,8 @@
+package models
+
+// Province - A first level region. Codes follow the Ministry of Home
+// Affairs numbering, e.g. 32 for Jawa Barat.
+type Province struct {
+    Code string `json:"code"`
+    Name string `json:"name"`
+}
@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// Review - A verified buyer's review of a product. Only customers with a
+// completed order containing the product can write one, once per product.
+type Review struct {
+    ID           int           `json:"id"`
+    ProductID    string        `json:"product_id"`
+    UserID       int           `json:"user_id"`
+    UserName     string        `json:"user_name"`
+    Rating       int           `json:"rating"`
+    Body         string        `json:"body"`
+    Images       []ReviewImage `json:"images"`
+    HelpfulCount int           `json:"helpful_count"`
+    CreatedAt    time.Time     `json:"created_at"`
+}
+
+// ReviewImage - A photo attached to a review, with the same thumbnails as
+// product images
+type ReviewImage struct {
+    Key        string            `json:"-"`
+    URL        string            `json:"url"`
+    Thumbnails map[string]string `json:"thumbnails"`
+}
+
+// Review star limits
+const (
+    MinReviewRating = 1
+    MaxReviewRating = 5
+)
+
+// StarCount - Reviews with a star rating, for the rating bar chart
+type StarCount struct {
+    Stars   int `json:"stars"`
+    Count   int `json:"count"`
+    Percent int `json:"percent"`
+}
+
+// RatingSummary - Average rating and the per-star breakdown, five stars first
+type RatingSummary struct {
+    Average   float64     `json:"average"`
+    Count     int         `json:"count"`
+    Breakdown []StarCount `json:"breakdown"`
+}
+
+// NewRatingSummary - Summary from the number of reviews per star
+func NewRatingSummary(counts map[int]int) RatingSummary {
+    summary := RatingSummary{Breakdown: []StarCount{}}
+    total := 0
+    for stars := MaxReviewRating; stars >= MinReviewRating; stars-- {
+        summary.Count += counts[stars]
+        total += stars * counts[stars]
+    }
+    for stars := MaxReviewRating; stars >= MinReviewRating; stars-- {
+        star := StarCount{Stars: stars, Count: counts[stars]}
+        if summary.Count > 0 {
+            star.Percent = (star.Count*100 + summary.Count/2) / summary.Count
+        }
+        summary.Breakdown = append(summary.Breakdown, star)
+    }
+    if summary.Count > 0 {
+        summary.Average = RoundRating(float64(total) / float64(summary.Count))
+    }
+    return summary
+}
+
+// RoundRating - Ratings are kept with two decimals, like products.rating
+func RoundRating(rating float64) float64 {
+    return float64(int(rating*100+0.5)) / 100
+}
+
+// ReviewHelpfulResponse - Helpful votes after a vote or its removal
+type ReviewHelpfulResponse struct {
+    ReviewID     int  `json:"review_id"`
+    Helpful      bool `json:"helpful"`
+    HelpfulCount int  `json:"helpful_count"`
+}
+
+// ReviewRequest - Body for writing a review, sent as JSON or, with photos,
+// as multipart/form-data with the same fields plus files in "images"
+type ReviewRequest struct {
+    Rating int    `json:"rating"`
+    Body   string `json:"body"`
+}
@@ -2,14 +2,54 @@ package models
 
 import "time"
 
+// User roles
+const (
+    RoleCustomer = "customer"
+    RoleStaff    = "staff"
+    RoleAdmin    = "admin"
+)
+
+// Permissions checked by the route-level permission middleware
+const (
+    PermManageProducts = "products:manage"
+    PermManageUsers    = "users:manage"
+    PermManageOrders   = "orders:manage"
+    PermModerate       = "content:moderate"
+    PermManageVouchers = "vouchers:manage"
+)
+
+// RolePermissions - Permissions granted to each role
+var RolePermissions = map[string][]string{
+    RoleCustomer: {},
+    RoleStaff:    {PermManageOrders, PermModerate},
+    RoleAdmin:    {PermManageProducts, PermManageUsers, PermManageOrders, PermModerate, PermManageVouchers},
+}
+
+// IsValidRole - Check whether a role exists
+func IsValidRole(role string) bool {
+    _, ok := RolePermissions[role]
+    return ok
+}
+
+// HasPermission - Check whether a role grants a permission
+func HasPermission(role, permission string) bool {
+    for _, p := range RolePermissions[role] {
+        if p == permission {
+            return true
+        }
+    }
+    return false
+}
+
 type User struct {
-    ID        int       `json:"id"`
-    Name      string    `json:"name"`
-    Email     string    `json:"email"`
-    Password  string    `json:"password,omitempty"`
-    Balance   int       `json:"balance"`
-    IsMember  bool      `json:"is_member"`
-    CreatedAt time.Time `json:"created_at"`
+    ID           int       `json:"id"`
+    Name         string    `json:"name"`
+    Email        string    `json:"email"`
+    PasswordHash string    `json:"-"`
+    Balance      int       `json:"balance"`
+    IsMember     bool      `json:"is_member"`
+    Role         string    `json:"role"`
+    CreatedAt    time.Time `json:"created_at"`
 }
 
 type UserCreateRequest struct {
@@ -18,10 +58,54 @@ type UserCreateRequest struct {
     Password string `json:"password"`
     Balance  int    `json:"balance"`
     IsMember bool   `json:"is_member"`
+    Role     string `json:"role"`
 }
 
+// UserUpdateRequest - Fields customers may change on their own record
 type UserUpdateRequest struct {
-    Name     string `json:"name,omitempty"`
-    Balance  int    `json:"balance,omitempty"`
-    IsMember bool   `json:"is_member,omitempty"`
-}
\ No newline at end of file
+    Name string `json:"name,omitempty"`
+}
+
+// AdminUserUpdateRequest - Fields admins may change on any user. Fields
+// left out (nil) keep their current value.
+type AdminUserUpdateRequest struct {
+    Name     *string `json:"name"`
+    Balance  *int    `json:"balance"`
+    IsMember *bool   `json:"is_member"`
+    Role     *string `json:"role"`
+}
+
+type RegisterRequest struct {
+    Name     string `json:"name"`
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+type LoginRequest struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token"`
+}
+
+// AuthResponse - Logged in user with a fresh token pair
+type AuthResponse struct {
+    User         User   `json:"user"`
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    TokenType    string `json:"token_type"`
+    ExpiresIn    int    `json:"expires_in"`
+}
+
+// RefreshToken - Stored refresh token, only its SHA-256 hash is kept
+type RefreshToken struct {
+    ID        int        `json:"id"`
+    UserID    int        `json:"user_id"`
+    TokenHash string     `json:"-"`
+    FamilyID  string     `json:"family_id"`
+    ExpiresAt time.Time  `json:"expires_at"`
+    RevokedAt *time.Time `json:"revoked_at,omitempty"`
+    CreatedAt time.Time  `json:"created_at"`
+}
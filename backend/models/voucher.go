@@ -0,0 +1,185 @@
+package models
+
+import (
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Voucher types
+const (
+    VoucherFixed        = "fixed"
+    VoucherPercentage   = "percentage"
+    VoucherFreeShipping = "free_shipping"
+)
+
+// VoucherTypes - Whitelist of voucher types
+var VoucherTypes = []string{VoucherFixed, VoucherPercentage, VoucherFreeShipping}
+
+// Reasons a voucher cannot be used, returned to the client as is
+const (
+    VoucherReasonNotFound    = "not_found"
+    VoucherReasonInactive    = "inactive"
+    VoucherReasonNotStarted  = "not_started"
+    VoucherReasonExpired     = "expired"
+    VoucherReasonUsageLimit  = "usage_limit_reached"
+    VoucherReasonAlreadyUsed = "already_used"
+    VoucherReasonNoItems     = "no_items_selected"
+    VoucherReasonMinPurchase = "min_purchase_not_met"
+)
+
+// Voucher - A discount code. Value is rupiah off for fixed vouchers, a
+// percentage for percentage vouchers (capped at MaxDiscount when set) and
+// the most shipping covered for free shipping vouchers (0 covers all of
+// it). UsageLimit and PerUserLimit of 0 mean unlimited. Claimed and
+// UserUses describe the voucher for the user it was loaded for.
+type Voucher struct {
+    ID           int       `json:"id"`
+    Code         string    `json:"code"`
+    Name         string    `json:"name"`
+    Type         string    `json:"type"`
+    Value        int       `json:"value"`
+    MaxDiscount  int       `json:"max_discount"`
+    MinPurchase  int       `json:"min_purchase"`
+    StartsAt     time.Time `json:"starts_at"`
+    ExpiresAt    time.Time `json:"expires_at"`
+    UsageLimit   int       `json:"usage_limit"`
+    PerUserLimit int       `json:"per_user_limit"`
+    UsedCount    int       `json:"used_count"`
+    Terms        string    `json:"terms"`
+    IsPublic     bool      `json:"is_public"`
+    IsActive     bool      `json:"is_active"`
+    CreatedAt    time.Time `json:"created_at"`
+    Claimed      bool      `json:"claimed"`
+    UserUses     int       `json:"user_uses"`
+}
+
+// Check - Why the voucher cannot be used now on a purchase of subtotal by
+// a user who used it userUses times before, or "" when it can
+func (v Voucher) Check(now time.Time, subtotal, userUses int) string {
+    switch {
+    case !v.IsActive:
+        return VoucherReasonInactive
+    case now.Before(v.StartsAt):
+        return VoucherReasonNotStarted
+    case !now.Before(v.ExpiresAt):
+        return VoucherReasonExpired
+    case v.UsageLimit > 0 && v.UsedCount >= v.UsageLimit:
+        return VoucherReasonUsageLimit
+    case v.PerUserLimit > 0 && userUses >= v.PerUserLimit:
+        return VoucherReasonAlreadyUsed
+    case subtotal <= 0:
+        return VoucherReasonNoItems
+    case subtotal < v.MinPurchase:
+        return VoucherReasonMinPurchase
+    }
+    return ""
+}
+
+// Discount - Rupiah off a purchase of subtotal with the given shipping
+// cost, rounded down and never more than what it applies to
+func (v Voucher) Discount(subtotal, shipping int) int {
+    switch v.Type {
+    case VoucherFixed:
+        return min(v.Value, subtotal)
+    case VoucherPercentage:
+        discount := subtotal * v.Value / 100
+        if v.MaxDiscount > 0 {
+            discount = min(discount, v.MaxDiscount)
+        }
+        return discount
+    case VoucherFreeShipping:
+        if v.Value == 0 {
+            return shipping
+        }
+        return min(v.Value, shipping)
+    }
+    return 0
+}
+
+// RejectionMessage - What to tell the customer about a reason from Check
+func (v Voucher) RejectionMessage(reason string, subtotal int) string {
+    switch reason {
+    case VoucherReasonNotFound:
+        return "Voucher not found"
+    case VoucherReasonInactive:
+        return "This voucher is no longer available"
+    case VoucherReasonNotStarted:
+        return "This voucher can be used from " + v.StartsAt.Format("2 Jan 2006 15:04")
+    case VoucherReasonExpired:
+        return "This voucher expired on " + v.ExpiresAt.Format("2 Jan 2006 15:04")
+    case VoucherReasonUsageLimit:
+        return "This voucher has run out"
+    case VoucherReasonAlreadyUsed:
+        return "You have already used this voucher"
+    case VoucherReasonNoItems:
+        return "Select items to use this voucher"
+    case VoucherReasonMinPurchase:
+        return "Minimum purchase is " + formatRupiah(v.MinPurchase) + ", add " +
+            formatRupiah(v.MinPurchase-subtotal) + " more to use this voucher"
+    }
+    return "This voucher cannot be used"
+}
+
+// NormalizeVoucherCode - Codes are matched without surrounding spaces and
+// case
+func NormalizeVoucherCode(code string) string {
+    return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// formatRupiah - e.g. 1250000 becomes "Rp 1.250.000"
+func formatRupiah(amount int) string {
+    digits := strconv.Itoa(amount)
+    var b strings.Builder
+    for i, d := range digits {
+        if i > 0 && (len(digits)-i)%3 == 0 {
+            b.WriteByte('.')
+        }
+        b.WriteRune(d)
+    }
+    return "Rp " + b.String()
+}
+
+// VoucherOffer - A voucher in the customer's lists, checked against the
+// selected items of their cart. Discount is what it would take off now.
+type VoucherOffer struct {
+    Voucher
+    Eligible bool   `json:"eligible"`
+    Reason   string `json:"reason,omitempty"`
+    Message  string `json:"message,omitempty"`
+    Discount int    `json:"discount"`
+}
+
+// NewVoucherOffer - The voucher with the outcome of pricing the cart with it
+func NewVoucherOffer(v Voucher, applied AppliedVoucher) VoucherOffer {
+    return VoucherOffer{
+        Voucher:  v,
+        Eligible: applied.Valid,
+        Reason:   applied.Reason,
+        Message:  applied.Message,
+        Discount: applied.Discount,
+    }
+}
+
+// VoucherRequest - Body for creating or replacing a voucher. StartsAt
+// defaults to now, PerUserLimit to 1 and IsActive to true.
+type VoucherRequest struct {
+    Code         string     `json:"code"`
+    Name         string     `json:"name"`
+    Type         string     `json:"type"`
+    Value        int        `json:"value"`
+    MaxDiscount  int        `json:"max_discount"`
+    MinPurchase  int        `json:"min_purchase"`
+    StartsAt     *time.Time `json:"starts_at"`
+    ExpiresAt    time.Time  `json:"expires_at"`
+    UsageLimit   int        `json:"usage_limit"`
+    PerUserLimit *int       `json:"per_user_limit"`
+    Terms        string     `json:"terms"`
+    IsPublic     bool       `json:"is_public"`
+    IsActive     *bool      `json:"is_active"`
+}
+
+// VoucherApplyRequest - Body for putting a voucher on the cart
+type VoucherApplyRequest struct {
+    Code string `json:"code"`
+}
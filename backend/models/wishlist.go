@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// WishlistItem - A product saved for later, one line per product and
+// variant (VariantID is 0 for the product as a whole). SavedPrice is the
+// price when it was saved; name, price and stock are read live, so
+// PriceDropped tells the customer it got cheaper since. NeedsVariant lines
+// must get a variant before they can go into the cart.
+type WishlistItem struct {
+    ID               int       `json:"id"`
+    ProductID        string    `json:"product_id"`
+    ProductName      string    `json:"product_name"`
+    Image            string    `json:"image,omitempty"`
+    VariantID        int       `json:"variant_id,omitempty"`
+    VariantLabel     string    `json:"variant,omitempty"`
+    SavedPrice       int       `json:"saved_price"`
+    Price            int       `json:"price"`
+    PriceDropped     bool      `json:"price_dropped"`
+    PriceDrop        int       `json:"price_drop"`
+    PriceDropPercent int       `json:"price_drop_percent"`
+    Stock            int       `json:"stock"`
+    InStock          bool      `json:"in_stock"`
+    NeedsVariant     bool      `json:"needs_variant"`
+    AddedAt          time.Time `json:"added_at"`
+}
+
+// NewWishlist - Set the price drop and stock flags of the lines
+func NewWishlist(items []WishlistItem) []WishlistItem {
+    if items == nil {
+        return []WishlistItem{}
+    }
+
+    for i := range items {
+        item := &items[i]
+        item.InStock = item.Stock > 0
+        if item.Price < item.SavedPrice {
+            item.PriceDropped = true
+            item.PriceDrop = item.SavedPrice - item.Price
+            item.PriceDropPercent = item.PriceDrop * 100 / item.SavedPrice
+        }
+    }
+    return items
+}
+
+// WishlistItemRequest - Body for saving a product, optionally one variant
+type WishlistItemRequest struct {
+    ProductID string `json:"product_id"`
+    VariantID int    `json:"variant_id,omitempty"`
+}
+
+// WishlistMoveRequest - Lines to move between the cart and the wishlist
+type WishlistMoveRequest struct {
+    ItemIDs []int `json:"item_ids"`
+}
@@ -0,0 +1,184 @@
+// Package pricing - Works out what a customer pays for a set of lines.
+//
+// The cart, the voucher list and order creation all price through
+// Rules.Quote, so the amount shown is the amount charged. Amounts are whole
+// rupiah, applied in this order:
+//
+//  1. Subtotal: unit price × quantity of each line.
+//  2. Member discount: MemberDiscount percent of each line for members,
+//     rounded down.
+//  3. Voucher: checked against the subtotal before any discount (what the
+//     customer reads as the minimum purchase), then taken off the goods
+//     left after the member discount. Fixed and percentage discounts are
+//     rounded down and never exceed the goods; free shipping vouchers apply
+//     in step 4.
+//  4. Shipping: the fee, less a free shipping voucher.
+//  5. Tax: TaxRate percent of the goods after discounts, rounded half up
+//     once for the whole order. Shipping is not taxed. With TaxInclusive
+//     prices already contain the tax, so its part of the goods
+//     (net × rate / (100 + rate), rounded half up) is shown but not added.
+//
+// Order level amounts (voucher discount and tax) are spread over the lines
+// in proportion to what each line has left, largest remainder first, so the
+// lines always add up to the totals exactly.
+package pricing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// Rules - The configurable parts of the calculation, in percent
+type Rules struct {
+	TaxRate        int
+	TaxInclusive   bool
+	MemberDiscount int
+}
+
+// Input - What to price. Lines need ProductID, VariantID, Quantity and
+// UnitPrice. Voucher is nil for none; it is checked at Now for the customer
+// it was loaded for.
+type Input struct {
+	Lines    []models.PriceLine
+	Member   bool
+	Voucher  *models.Voucher
+	Shipping int
+	Now      time.Time
+}
+
+// Quote - Price the input. The voucher comes back checked: one that cannot
+// be used carries the reason and takes nothing off.
+func (r Rules) Quote(in Input) (models.PriceBreakdown, *models.AppliedVoucher) {
+	b := models.PriceBreakdown{
+		Lines:       make([]models.PriceLine, len(in.Lines)),
+		Shipping:    in.Shipping,
+		TaxRate:     r.TaxRate,
+		TaxIncluded: r.TaxInclusive,
+	}
+	copy(b.Lines, in.Lines)
+
+	// 1-2. Subtotals and member discount, per line
+	net := make([]int, len(b.Lines))
+	goods := 0
+	for i := range b.Lines {
+		line := &b.Lines[i]
+		line.Subtotal = line.UnitPrice * line.Quantity
+		if in.Member {
+			line.MemberDiscount = line.Subtotal * r.MemberDiscount / 100
+		}
+		net[i] = line.Subtotal - line.MemberDiscount
+		b.Subtotal += line.Subtotal
+		b.MemberDiscount += line.MemberDiscount
+		goods += net[i]
+	}
+
+	// 3-4. Voucher and shipping
+	var applied *models.AppliedVoucher
+	if v := in.Voucher; v != nil {
+		applied = &models.AppliedVoucher{ID: v.ID, Code: v.Code, Name: v.Name, Type: v.Type}
+		applied.Reason = v.Check(in.Now, b.Subtotal, v.UserUses)
+		applied.Valid = applied.Reason == ""
+		switch {
+		case !applied.Valid:
+			applied.Message = v.RejectionMessage(applied.Reason, b.Subtotal)
+		case v.Type == models.VoucherFreeShipping:
+			b.ShippingDiscount = v.Discount(goods, in.Shipping)
+		default:
+			b.VoucherDiscount = v.Discount(goods, in.Shipping)
+		}
+		applied.Discount = b.VoucherDiscount + b.ShippingDiscount
+	}
+	for i, share := range allocate(b.VoucherDiscount, net) {
+		b.Lines[i].VoucherDiscount = share
+		net[i] -= share
+	}
+	goods -= b.VoucherDiscount
+
+	// 5. Tax
+	if r.TaxInclusive {
+		b.Tax = divRound(goods*r.TaxRate, 100+r.TaxRate)
+	} else {
+		b.Tax = divRound(goods*r.TaxRate, 100)
+	}
+	for i, share := range allocate(b.Tax, net) {
+		line := &b.Lines[i]
+		line.Tax = share
+		line.Total = net[i]
+		if !r.TaxInclusive {
+			line.Total += share
+		}
+	}
+
+	b.Discount = b.MemberDiscount + b.VoucherDiscount + b.ShippingDiscount
+	b.Total = goods + b.Shipping - b.ShippingDiscount
+	if !r.TaxInclusive {
+		b.Total += b.Tax
+	}
+	return b, applied
+}
+
+// CartLines - The selected cart lines that can be bought, to price
+func CartLines(items []models.CartItem) []models.PriceLine {
+	lines := []models.PriceLine{}
+	for _, item := range items {
+		if item.Selected && item.Purchasable() {
+			lines = append(lines, models.PriceLine{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Quantity:  item.Quantity,
+				UnitPrice: item.Price,
+			})
+		}
+	}
+	return lines
+}
+
+// OrderLines - The priced items of an order, to price
+func OrderLines(items []models.OrderItem) []models.PriceLine {
+	lines := make([]models.PriceLine, len(items))
+	for i, item := range items {
+		lines[i] = models.PriceLine{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.Price,
+		}
+	}
+	return lines
+}
+
+// allocate - Split amount over weights in proportion: every share is
+// rounded down, then the rupiah left over go one each to the largest
+// remainders, earlier lines first on ties
+func allocate(amount int, weights []int) []int {
+	shares := make([]int, len(weights))
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	if amount == 0 || total == 0 {
+		return shares
+	}
+
+	remainders := make([]int, len(weights))
+	order := make([]int, len(weights))
+	left := amount
+	for i, w := range weights {
+		shares[i] = amount * w / total
+		remainders[i] = amount * w % total
+		order[i] = i
+		left -= shares[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:left] {
+		shares[i]++
+	}
+	return shares
+}
+
+// divRound - n / d rounded half up, for n >= 0 and d > 0
+func divRound(n, d int) int {
+	return (2*n + d) / (2 * d)
+}
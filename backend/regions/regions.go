@@ -0,0 +1,41 @@
+// Package regions - Indonesian provinces for address forms, read from a
+// list embedded in the binary so no external service is needed.
+//
+// provinces.json holds every province with its Ministry of Home Affairs
+// code. Cities and districts are not bundled; addresses take them by name.
+package regions
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+//go:embed provinces.json
+var dataset []byte
+
+var (
+	provinces      []models.Province
+	provinceByCode = map[string]models.Province{}
+)
+
+func init() {
+	if err := json.Unmarshal(dataset, &provinces); err != nil {
+		panic("regions: invalid provinces.json: " + err.Error())
+	}
+	for _, p := range provinces {
+		provinceByCode[p.Code] = p
+	}
+}
+
+// Provinces - Every province, in code order
+func Provinces() []models.Province {
+	return provinces
+}
+
+// FindProvince - The province with the code
+func FindProvince(code string) (models.Province, bool) {
+	prov, ok := provinceByCode[code]
+	return prov, ok
+}
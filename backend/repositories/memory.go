@@ -0,0 +1,2342 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+)
+
+// memoryStore - Tables shared by the in-memory repositories, guarded by one
+// mutex so multi-table operations (orders, cancellations) stay atomic
+type memoryStore struct {
+	mu            sync.RWMutex
+	users         map[int]models.User
+	products      map[string]models.Product
+	categories    map[int]models.Category
+	variants      map[int]models.ProductVariant
+	images        map[int]models.ProductImage
+	reviews       map[int]models.Review
+	votes         map[int]map[int]bool
+	questions     map[int]models.Question
+	answers       map[int]models.Answer
+	qaVotes       map[qaItem]map[int]int
+	orders        map[string]models.Order
+	events        map[string][]models.OrderEvent
+	cart          map[int]cartLine
+	guestCarts    map[string]time.Time
+	wishlist      map[int]wishlistLine
+	vouchers      map[int]models.Voucher
+	claims        map[voucherUse]bool
+	redeemed      map[string]voucherUse
+	cartCodes     map[CartOwner]int
+	checkouts     map[string]models.Checkout
+	checkoutLines map[int]checkoutLine
+	addresses     map[int]models.Address
+	tokens        map[string]models.RefreshToken
+	nextUserID    int
+	nextID        int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:         make(map[int]models.User),
+		products:      make(map[string]models.Product),
+		categories:    make(map[int]models.Category),
+		variants:      make(map[int]models.ProductVariant),
+		images:        make(map[int]models.ProductImage),
+		reviews:       make(map[int]models.Review),
+		votes:         make(map[int]map[int]bool),
+		questions:     make(map[int]models.Question),
+		answers:       make(map[int]models.Answer),
+		qaVotes:       make(map[qaItem]map[int]int),
+		orders:        make(map[string]models.Order),
+		events:        make(map[string][]models.OrderEvent),
+		cart:          make(map[int]cartLine),
+		guestCarts:    make(map[string]time.Time),
+		wishlist:      make(map[int]wishlistLine),
+		vouchers:      make(map[int]models.Voucher),
+		claims:        make(map[voucherUse]bool),
+		redeemed:      make(map[string]voucherUse),
+		cartCodes:     make(map[CartOwner]int),
+		checkouts:     make(map[string]models.Checkout),
+		checkoutLines: make(map[int]checkoutLine),
+		addresses:     make(map[int]models.Address),
+		tokens:        make(map[string]models.RefreshToken),
+		nextUserID:    1,
+		nextID:        1,
+	}
+}
+
+// id - Next value for auto increment style IDs (items, events, tokens)
+func (s *memoryStore) id() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// unitsSold - Units per product on completed orders; the caller holds the
+// lock
+func (s *memoryStore) unitsSold() map[string]int {
+	sold := make(map[string]int)
+	for _, order := range s.orders {
+		if order.Status != models.OrderStatusCompleted {
+			continue
+		}
+		for _, item := range order.Items {
+			sold[item.ProductID] += item.Quantity
+		}
+	}
+	return sold
+}
+
+// productVariants - Variants of a product in creation order; the caller
+// holds the lock
+func (s *memoryStore) productVariants(productID string) []models.ProductVariant {
+	var variants []models.ProductVariant
+	for _, v := range s.variants {
+		if v.ProductID == productID {
+			variants = append(variants, v)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].ID < variants[j].ID })
+	return variants
+}
+
+// categoryList - Every category in display order; the caller holds the lock
+func (s *memoryStore) categoryList() []models.Category {
+	categories := []models.Category{}
+	for _, c := range s.categories {
+		categories = append(categories, c)
+	}
+	models.SortCategories(categories)
+	return categories
+}
+
+// categoryName - Name of the category, empty for nil; the caller holds the
+// lock
+func (s *memoryStore) categoryName(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return s.categories[*id].Name
+}
+
+// gallery - Images of a product in display order; the caller holds the lock
+func (s *memoryStore) gallery(productID string) []models.ProductImage {
+	images := []models.ProductImage{}
+	for _, image := range s.images {
+		if image.ProductID == productID {
+			images = append(images, image)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+	return images
+}
+
+// paginate - The slice of items for offset and limit
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// MemoryUserRepository - UserRepository kept in process memory
+type MemoryUserRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range r.store.users {
+		user.PasswordHash = ""
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	user.PasswordHash = ""
+	return user, nil
+}
+
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.users {
+		if existing.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+
+	user.ID = r.store.nextUserID
+	r.store.nextUserID++
+	user.CreatedAt = time.Now()
+	if user.Role == "" {
+		user.Role = models.RoleCustomer
+	}
+	r.store.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) UpdateName(ctx context.Context, id int, name string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Name = name
+	r.store.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) AdminUpdate(ctx context.Context, id int, req models.AdminUserUpdateRequest) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Balance != nil {
+		user.Balance = *req.Balance
+	}
+	if req.IsMember != nil {
+		user.IsMember = *req.IsMember
+	}
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+	r.store.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.users, id)
+	return nil
+}
+
+// MemoryProductRepository - ProductRepository kept in process memory
+type MemoryProductRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryProductRepository) List(ctx context.Context, filter ProductFilter) ([]models.Product, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	sold := r.store.unitsSold()
+	products := []models.Product{}
+	for _, p := range r.store.products {
+		p = r.listed(p, sold)
+		if productMatches(p, filter, true) {
+			products = append(products, p)
+		}
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		switch filter.Sort {
+		case SortPriceAsc:
+			if a.Price != b.Price {
+				return a.Price < b.Price
+			}
+		case SortPriceDesc:
+			if a.Price != b.Price {
+				return a.Price > b.Price
+			}
+		case SortPopular:
+			if a.SoldCount != b.SoldCount {
+				return a.SoldCount > b.SoldCount
+			}
+		case SortRating:
+			if a.Rating != b.Rating {
+				return a.Rating > b.Rating
+			}
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+		}
+		return a.ID < b.ID
+	})
+
+	total := len(products)
+	return paginate(products, filter.Offset, filter.Limit), total, nil
+}
+
+func (r *MemoryProductRepository) Facets(ctx context.Context, filter ProductFilter) (models.ProductFacets, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, p := range r.store.products {
+		p = r.listed(p, nil)
+		if p.Brand != "" && productMatches(p, filter, false) {
+			counts[p.Brand]++
+		}
+	}
+
+	facets := models.ProductFacets{Brands: []models.FacetCount{}}
+	for brand, n := range counts {
+		facets.Brands = append(facets.Brands, models.FacetCount{Value: brand, Count: n})
+	}
+	sort.Slice(facets.Brands, func(i, j int) bool {
+		a, b := facets.Brands[i], facets.Brands[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Value < b.Value
+	})
+	return facets, nil
+}
+
+func (r *MemoryProductRepository) GetByID(ctx context.Context, id string) (models.Product, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	p, ok := r.store.products[id]
+	if !ok {
+		return models.Product{}, ErrNotFound
+	}
+	p.SoldCount = r.store.unitsSold()[id]
+	p.Category = r.store.categoryName(p.CategoryID)
+	if p.CategoryID != nil {
+		p.Breadcrumbs = models.CategoryPath(r.store.categoryList(), *p.CategoryID)
+	}
+	p.Images = r.store.gallery(id)
+	p.Image = models.Cover(p.Images)
+	p.ApplyVariants(r.store.productVariants(id))
+	return p, nil
+}
+
+func (r *MemoryProductRepository) GetMany(ctx context.Context, ids []string) ([]models.Product, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	sold := r.store.unitsSold()
+	products := []models.Product{}
+	for _, id := range ids {
+		if p, ok := r.store.products[id]; ok {
+			products = append(products, r.listed(p, sold))
+		}
+	}
+	return products, nil
+}
+
+func (r *MemoryProductRepository) Create(ctx context.Context, product *models.Product) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[product.ID]; ok {
+		return ErrDuplicate
+	}
+	if !r.categoryExists(product.CategoryID) {
+		return ErrNotFound
+	}
+	product.CreatedAt = time.Now()
+	r.store.products[product.ID] = *product
+	return nil
+}
+
+func (r *MemoryProductRepository) Update(ctx context.Context, id string, req models.ProductUpdateRequest) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	p, ok := r.store.products[id]
+	if !ok || !r.categoryExists(req.CategoryID) {
+		return ErrNotFound
+	}
+	p.Name = req.Name
+	p.Price = req.Price
+	p.Stock = req.Stock
+	p.CategoryID = req.CategoryID
+	req.ProductContent.Apply(&p)
+	r.store.products[id] = p
+	return nil
+}
+
+func (r *MemoryProductRepository) Delete(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[id]; !ok {
+		return ErrNotFound
+	}
+	for _, order := range r.store.orders {
+		for _, item := range order.Items {
+			if item.ProductID == id {
+				return ErrInUse
+			}
+		}
+	}
+	delete(r.store.products, id)
+	for _, v := range r.store.productVariants(id) {
+		delete(r.store.variants, v.ID)
+	}
+	for _, image := range r.store.gallery(id) {
+		delete(r.store.images, image.ID)
+	}
+	for reviewID, review := range r.store.reviews {
+		if review.ProductID == id {
+			delete(r.store.reviews, reviewID)
+			delete(r.store.votes, reviewID)
+		}
+	}
+	for questionID, question := range r.store.questions {
+		if question.ProductID == id {
+			r.store.deleteQuestion(questionID)
+		}
+	}
+	for lineID, line := range r.store.cart {
+		if line.item.ProductID == id {
+			delete(r.store.cart, lineID)
+		}
+	}
+	for lineID, line := range r.store.checkoutLines {
+		if line.item.ProductID == id {
+			delete(r.store.checkoutLines, lineID)
+		}
+	}
+	for lineID, line := range r.store.wishlist {
+		if line.item.ProductID == id {
+			delete(r.store.wishlist, lineID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryProductRepository) CreateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[variant.ProductID]; !ok {
+		return ErrNotFound
+	}
+	if r.skuTaken(variant.SKU, 0) {
+		return ErrDuplicate
+	}
+	variant.ID = r.store.id()
+	r.store.variants[variant.ID] = *variant
+	return nil
+}
+
+func (r *MemoryProductRepository) UpdateVariant(ctx context.Context, variant models.ProductVariant) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.variants[variant.ID]
+	if !ok || existing.ProductID != variant.ProductID {
+		return ErrNotFound
+	}
+	if r.skuTaken(variant.SKU, variant.ID) {
+		return ErrDuplicate
+	}
+	r.store.variants[variant.ID] = variant
+	return nil
+}
+
+func (r *MemoryProductRepository) DeleteVariant(ctx context.Context, productID string, variantID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	v, ok := r.store.variants[variantID]
+	if !ok || v.ProductID != productID {
+		return ErrNotFound
+	}
+	delete(r.store.variants, variantID)
+	for lineID, line := range r.store.cart {
+		if line.item.VariantID == variantID {
+			delete(r.store.cart, lineID)
+		}
+	}
+	// Checkout lines lose the variant and show as unavailable
+	for lineID, line := range r.store.checkoutLines {
+		if line.item.VariantID == variantID {
+			line.item.VariantID = 0
+			r.store.checkoutLines[lineID] = line
+		}
+	}
+	for lineID, line := range r.store.wishlist {
+		if line.item.VariantID == variantID {
+			delete(r.store.wishlist, lineID)
+		}
+	}
+	return nil
+}
+
+// skuTaken - Whether another variant already uses the SKU; the caller holds
+// the lock
+func (r *MemoryProductRepository) skuTaken(sku string, exceptID int) bool {
+	for _, v := range r.store.variants {
+		if v.SKU == sku && v.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryExists - Whether a product may reference the category, nil
+// included; the caller holds the lock
+func (r *MemoryProductRepository) categoryExists(id *int) bool {
+	if id == nil {
+		return true
+	}
+	_, ok := r.store.categories[*id]
+	return ok
+}
+
+// listed - The product as lists show it: without the details page content,
+// with its category name, units sold, cover image and the total stock of its
+// variants when it has any; the caller holds the lock
+func (r *MemoryProductRepository) listed(p models.Product, sold map[string]int) models.Product {
+	p.Description, p.Features, p.Specs = "", nil, nil
+	p.Category = r.store.categoryName(p.CategoryID)
+	p.SoldCount = sold[p.ID]
+	p.Image = models.Cover(r.store.gallery(p.ID))
+	variants := r.store.productVariants(p.ID)
+	if len(variants) == 0 {
+		return p
+	}
+	p.Stock = 0
+	for _, v := range variants {
+		p.Stock += v.Stock
+	}
+	return p
+}
+
+// productMatches - Whether the product passes the filter, with or without
+// its brands
+func productMatches(p models.Product, filter ProductFilter, withBrands bool) bool {
+	switch {
+	case len(filter.CategoryIDs) > 0 && (p.CategoryID == nil || !containsInt(filter.CategoryIDs, *p.CategoryID)),
+		withBrands && len(filter.Brands) > 0 && !containsFold(filter.Brands, p.Brand),
+		filter.MinPrice > 0 && p.Price < filter.MinPrice,
+		filter.MaxPrice > 0 && p.Price > filter.MaxPrice,
+		filter.MinRating > 0 && p.Rating < filter.MinRating,
+		filter.InStock && p.Stock <= 0:
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, n int) bool {
+	for _, v := range values {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryCategoryRepository - CategoryRepository kept in process memory
+type MemoryCategoryRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.categoryList(), nil
+}
+
+func (r *MemoryCategoryRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	c, ok := r.store.categories[id]
+	if !ok {
+		return models.Category{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (r *MemoryCategoryRepository) GetBySlug(ctx context.Context, slug string) (models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, c := range r.store.categories {
+		if c.Slug == slug {
+			return c, nil
+		}
+	}
+	return models.Category{}, ErrNotFound
+}
+
+func (r *MemoryCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if err := r.check(*category); err != nil {
+		return err
+	}
+	category.ID = r.store.id()
+	category.CreatedAt = time.Now()
+	r.store.categories[category.ID] = *category
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Update(ctx context.Context, category models.Category) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.categories[category.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := r.check(category); err != nil {
+		return err
+	}
+	category.CreatedAt = existing.CreatedAt
+	r.store.categories[category.ID] = category
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Delete(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.categories[id]; !ok {
+		return ErrNotFound
+	}
+	for _, c := range r.store.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			return ErrInUse
+		}
+	}
+	for _, p := range r.store.products {
+		if p.CategoryID != nil && *p.CategoryID == id {
+			return ErrInUse
+		}
+	}
+	delete(r.store.categories, id)
+	return nil
+}
+
+// check - The constraints MySQL enforces: a unique slug and an existing
+// parent; the caller holds the lock
+func (r *MemoryCategoryRepository) check(category models.Category) error {
+	for _, c := range r.store.categories {
+		if c.Slug == category.Slug && c.ID != category.ID {
+			return ErrDuplicate
+		}
+	}
+	if category.ParentID != nil {
+		if _, ok := r.store.categories[*category.ParentID]; !ok {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// MemoryReviewRepository - ReviewRepository kept in process memory
+type MemoryReviewRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryReviewRepository) List(ctx context.Context, filter ReviewFilter) ([]models.Review, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	reviews := []models.Review{}
+	for _, review := range r.store.reviews {
+		switch {
+		case review.ProductID != filter.ProductID,
+			filter.Stars > 0 && review.Rating != filter.Stars,
+			filter.WithImages && len(review.Images) == 0:
+			continue
+		}
+		reviews = append(reviews, r.withAuthor(review))
+	}
+
+	sort.Slice(reviews, func(i, j int) bool {
+		a, b := reviews[i], reviews[j]
+		switch filter.Sort {
+		case ReviewSortHelpful:
+			if a.HelpfulCount != b.HelpfulCount {
+				return a.HelpfulCount > b.HelpfulCount
+			}
+		case ReviewSortHighest:
+			if a.Rating != b.Rating {
+				return a.Rating > b.Rating
+			}
+		case ReviewSortLowest:
+			if a.Rating != b.Rating {
+				return a.Rating < b.Rating
+			}
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	total := len(reviews)
+	return paginate(reviews, filter.Offset, filter.Limit), total, nil
+}
+
+func (r *MemoryReviewRepository) Summary(ctx context.Context, productID string) (models.RatingSummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return models.NewRatingSummary(r.starCounts(productID)), nil
+}
+
+func (r *MemoryReviewRepository) GetByID(ctx context.Context, productID string, id int) (models.Review, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	review, ok := r.store.reviews[id]
+	if !ok || review.ProductID != productID {
+		return models.Review{}, ErrNotFound
+	}
+	return r.withAuthor(review), nil
+}
+
+func (r *MemoryReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[review.ProductID]; !ok {
+		return ErrNotFound
+	}
+	for _, other := range r.store.reviews {
+		if other.ProductID == review.ProductID && other.UserID == review.UserID {
+			return ErrDuplicate
+		}
+	}
+	review.ID = r.store.id()
+	review.CreatedAt = time.Now()
+	r.store.reviews[review.ID] = *review
+	r.updateProductRating(review.ProductID)
+	return nil
+}
+
+func (r *MemoryReviewRepository) Delete(ctx context.Context, productID string, id int) (models.Review, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	review, ok := r.store.reviews[id]
+	if !ok || review.ProductID != productID {
+		return models.Review{}, ErrNotFound
+	}
+	delete(r.store.reviews, id)
+	delete(r.store.votes, id)
+	r.updateProductRating(productID)
+	return r.withAuthor(review), nil
+}
+
+func (r *MemoryReviewRepository) SetHelpful(ctx context.Context, reviewID, userID int, helpful bool) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	review, ok := r.store.reviews[reviewID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	votes := r.store.votes[reviewID]
+	if votes == nil {
+		votes = make(map[int]bool)
+		r.store.votes[reviewID] = votes
+	}
+	if helpful {
+		votes[userID] = true
+	} else {
+		delete(votes, userID)
+	}
+	review.HelpfulCount = len(votes)
+	r.store.reviews[reviewID] = review
+	return review.HelpfulCount, nil
+}
+
+// withAuthor - The review with its author's current name; the caller holds
+// the lock
+func (r *MemoryReviewRepository) withAuthor(review models.Review) models.Review {
+	review.UserName = r.store.users[review.UserID].Name
+	return review
+}
+
+// starCounts - Reviews of the product per star; the caller holds the lock
+func (r *MemoryReviewRepository) starCounts(productID string) map[int]int {
+	counts := make(map[int]int)
+	for _, review := range r.store.reviews {
+		if review.ProductID == productID {
+			counts[review.Rating]++
+		}
+	}
+	return counts
+}
+
+// updateProductRating - Recompute the product's rating and review count;
+// the caller holds the write lock
+func (r *MemoryReviewRepository) updateProductRating(productID string) {
+	p, ok := r.store.products[productID]
+	if !ok {
+		return
+	}
+	summary := models.NewRatingSummary(r.starCounts(productID))
+	p.Rating, p.ReviewCount = summary.Average, summary.Count
+	r.store.products[productID] = p
+}
+
+// qaItem - Key of a question's or answer's votes in memoryStore.qaVotes
+type qaItem struct {
+	answer bool
+	id     int
+}
+
+// deleteQuestion - Remove the question with its answers and votes; the
+// caller holds the write lock
+func (s *memoryStore) deleteQuestion(id int) {
+	for answerID, answer := range s.answers {
+		if answer.QuestionID == id {
+			delete(s.answers, answerID)
+			delete(s.qaVotes, qaItem{answer: true, id: answerID})
+		}
+	}
+	delete(s.questions, id)
+	delete(s.qaVotes, qaItem{id: id})
+}
+
+// MemoryQuestionRepository - QuestionRepository kept in process memory
+type MemoryQuestionRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryQuestionRepository) ListQuestions(ctx context.Context, filter QuestionFilter) ([]models.Question, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	questions := []models.Question{}
+	for _, question := range r.store.questions {
+		switch {
+		case filter.ProductID != "" && question.ProductID != filter.ProductID,
+			filter.Status != "" && question.Status != filter.Status:
+			continue
+		}
+		questions = append(questions, r.withAuthor(question))
+	}
+
+	sort.Slice(questions, func(i, j int) bool {
+		a, b := questions[i], questions[j]
+		if filter.Sort != QuestionSortNewest && a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	total := len(questions)
+	questions = paginate(questions, filter.Offset, filter.Limit)
+	for i := range questions {
+		questions[i].Answers = r.questionAnswers(questions[i].ID, filter.AnswerStatus)
+	}
+	return questions, total, nil
+}
+
+func (r *MemoryQuestionRepository) GetQuestion(ctx context.Context, productID string, id int) (models.Question, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	question, ok := r.store.questions[id]
+	if !ok || question.ProductID != productID {
+		return models.Question{}, ErrNotFound
+	}
+	return r.withAuthor(question), nil
+}
+
+func (r *MemoryQuestionRepository) CreateQuestion(ctx context.Context, question *models.Question) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[question.ProductID]; !ok {
+		return ErrNotFound
+	}
+	question.ID = r.store.id()
+	question.CreatedAt = time.Now()
+	r.store.questions[question.ID] = *question
+	return nil
+}
+
+func (r *MemoryQuestionRepository) SetQuestionStatus(ctx context.Context, id int, status string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	question, ok := r.store.questions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	question.Status = status
+	r.store.questions[id] = question
+	return nil
+}
+
+func (r *MemoryQuestionRepository) VoteQuestion(ctx context.Context, id, userID, value int) (models.VoteTally, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	question, ok := r.store.questions[id]
+	if !ok {
+		return models.VoteTally{}, ErrNotFound
+	}
+	tally := r.vote(qaItem{id: id}, userID, value)
+	question.Upvotes, question.Downvotes, question.Score = tally.Upvotes, tally.Downvotes, tally.Score
+	r.store.questions[id] = question
+	return tally, nil
+}
+
+func (r *MemoryQuestionRepository) ListAnswers(ctx context.Context, filter AnswerFilter) ([]models.Answer, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	answers := []models.Answer{}
+	for _, answer := range r.store.answers {
+		if filter.Status == "" || answer.Status == filter.Status {
+			answers = append(answers, r.answerWithAuthor(answer))
+		}
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		a, b := answers[i], answers[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	total := len(answers)
+	return paginate(answers, filter.Offset, filter.Limit), total, nil
+}
+
+func (r *MemoryQuestionRepository) GetAnswer(ctx context.Context, questionID, id int) (models.Answer, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	answer, ok := r.store.answers[id]
+	if !ok || answer.QuestionID != questionID {
+		return models.Answer{}, ErrNotFound
+	}
+	return r.answerWithAuthor(answer), nil
+}
+
+func (r *MemoryQuestionRepository) CreateAnswer(ctx context.Context, answer *models.Answer) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	question, ok := r.store.questions[answer.QuestionID]
+	if !ok {
+		return ErrNotFound
+	}
+	answer.ProductID = question.ProductID
+	answer.ID = r.store.id()
+	answer.CreatedAt = time.Now()
+	r.store.answers[answer.ID] = *answer
+	return nil
+}
+
+func (r *MemoryQuestionRepository) SetAnswerStatus(ctx context.Context, id int, status string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	answer, ok := r.store.answers[id]
+	if !ok {
+		return ErrNotFound
+	}
+	answer.Status = status
+	r.store.answers[id] = answer
+	return nil
+}
+
+func (r *MemoryQuestionRepository) VoteAnswer(ctx context.Context, id, userID, value int) (models.VoteTally, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	answer, ok := r.store.answers[id]
+	if !ok {
+		return models.VoteTally{}, ErrNotFound
+	}
+	tally := r.vote(qaItem{answer: true, id: id}, userID, value)
+	answer.Upvotes, answer.Downvotes, answer.Score = tally.Upvotes, tally.Downvotes, tally.Score
+	r.store.answers[id] = answer
+	return tally, nil
+}
+
+// questionAnswers - Answers of the question with the status (any when
+// empty), staff answers first, then by score; the caller holds the lock
+func (r *MemoryQuestionRepository) questionAnswers(questionID int, status string) []models.Answer {
+	answers := []models.Answer{}
+	for _, answer := range r.store.answers {
+		if answer.QuestionID == questionID && (status == "" || answer.Status == status) {
+			answers = append(answers, r.answerWithAuthor(answer))
+		}
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		a, b := answers[i], answers[j]
+		if a.IsStaff != b.IsStaff {
+			return a.IsStaff
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return answers
+}
+
+// vote - Record the user's vote on the item and count its votes again; the
+// caller holds the write lock
+func (r *MemoryQuestionRepository) vote(item qaItem, userID, value int) models.VoteTally {
+	votes := r.store.qaVotes[item]
+	if votes == nil {
+		votes = make(map[int]int)
+		r.store.qaVotes[item] = votes
+	}
+	if value == 0 {
+		delete(votes, userID)
+	} else {
+		votes[userID] = value
+	}
+
+	tally := models.VoteTally{ID: item.id, Vote: value}
+	for _, v := range votes {
+		countVote(&tally, v, 1)
+	}
+	return tally
+}
+
+// withAuthor - The question with its author's current name; the caller
+// holds the lock
+func (r *MemoryQuestionRepository) withAuthor(question models.Question) models.Question {
+	question.UserName = r.store.users[question.UserID].Name
+	question.Answers = []models.Answer{}
+	return question
+}
+
+// answerWithAuthor - The answer with its author's current name; the caller
+// holds the lock
+func (r *MemoryQuestionRepository) answerWithAuthor(answer models.Answer) models.Answer {
+	answer.UserName = r.store.users[answer.UserID].Name
+	return answer
+}
+
+// MemoryProductImageRepository - ProductImageRepository kept in process memory
+type MemoryProductImageRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryProductImageRepository) List(ctx context.Context, productID string) ([]models.ProductImage, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.gallery(productID), nil
+}
+
+func (r *MemoryProductImageRepository) Add(ctx context.Context, image *models.ProductImage) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[image.ProductID]; !ok {
+		return ErrNotFound
+	}
+	count := len(r.store.gallery(image.ProductID))
+	image.ID = r.store.id()
+	image.Position = count
+	image.IsPrimary = count == 0
+	image.CreatedAt = time.Now()
+	r.store.images[image.ID] = *image
+	return nil
+}
+
+func (r *MemoryProductImageRepository) Delete(ctx context.Context, productID string, imageID int) (models.ProductImage, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	image, ok := r.store.images[imageID]
+	if !ok || image.ProductID != productID {
+		return models.ProductImage{}, ErrNotFound
+	}
+	delete(r.store.images, imageID)
+
+	// Close the gap in the positions and hand over the primary flag
+	for i, other := range r.store.gallery(productID) {
+		other.Position = i
+		other.IsPrimary = other.IsPrimary || (image.IsPrimary && i == 0)
+		r.store.images[other.ID] = other
+	}
+	return image, nil
+}
+
+func (r *MemoryProductImageRepository) Reorder(ctx context.Context, productID string, ids []int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[productID]; !ok {
+		return ErrNotFound
+	}
+	if !sameImages(r.store.gallery(productID), ids) {
+		return ErrNotFound
+	}
+	for position, id := range ids {
+		image := r.store.images[id]
+		image.Position = position
+		r.store.images[id] = image
+	}
+	return nil
+}
+
+func (r *MemoryProductImageRepository) SetPrimary(ctx context.Context, productID string, imageID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if image, ok := r.store.images[imageID]; !ok || image.ProductID != productID {
+		return ErrNotFound
+	}
+	for _, image := range r.store.gallery(productID) {
+		image.IsPrimary = image.ID == imageID
+		r.store.images[image.ID] = image
+	}
+	return nil
+}
+
+// MemoryOrderRepository - OrderRepository kept in process memory
+type MemoryOrderRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryOrderRepository) Create(ctx context.Context, order *models.Order, rules pricing.Rules, actor string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	customer, ok := r.store.users[order.CustomerID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.CheckoutID != "" {
+		if err := r.store.openCheckout(order.CheckoutID, order.CustomerID); err != nil {
+			return err
+		}
+	}
+
+	sortOrderItems(order.Items)
+	variants := make(map[string][]models.ProductVariant)
+	for _, item := range order.Items {
+		if _, ok := variants[item.ProductID]; !ok {
+			variants[item.ProductID] = r.store.productVariants(item.ProductID)
+		}
+	}
+	if err := priceItems(order.Items, r.store.products, variants); err != nil {
+		return err
+	}
+
+	var voucher *models.Voucher
+	if order.VoucherCode != "" {
+		stored, ok := r.store.voucherByCode(order.VoucherCode)
+		if !ok {
+			return &VoucherError{Reason: models.VoucherReasonNotFound}
+		}
+		stored = r.store.voucherFor(stored, order.CustomerID)
+		voucher = &stored
+		order.VoucherCode = stored.Code
+	}
+	if err := priceOrder(order, rules, customer.IsMember, voucher); err != nil {
+		return err
+	}
+	if order.PaymentMethod == models.PaymentBalance && customer.Balance < order.Total {
+		return ErrInsufficientBalance
+	}
+	if voucher != nil {
+		stored := r.store.vouchers[voucher.ID]
+		stored.UsedCount++
+		r.store.vouchers[stored.ID] = stored
+		r.store.redeemed[order.ID] = voucherUse{voucherID: voucher.ID, userID: order.CustomerID}
+	}
+
+	order.Status = models.OrderStatusPendingPayment
+	order.CreatedAt = time.Now()
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.VariantID != 0 {
+			v := r.store.variants[item.VariantID]
+			v.Stock -= item.Quantity
+			r.store.variants[v.ID] = v
+		} else {
+			p := r.store.products[item.ProductID]
+			p.Stock -= item.Quantity
+			r.store.products[p.ID] = p
+		}
+
+		item.ID = r.store.id()
+		item.OrderID = order.ID
+	}
+
+	if order.CheckoutID != "" {
+		r.store.placeCheckout(*order)
+	}
+
+	r.store.orders[order.ID] = *order
+	r.record(order.ID, "", order.Status, actor, "Order placed")
+	if order.PaymentMethod == models.PaymentBalance {
+		customer.Balance -= order.Total
+		r.store.users[customer.ID] = customer
+		order.BalancePaid = order.Total
+		order.Status = models.OrderStatusPaid
+		r.store.orders[order.ID] = *order
+		r.record(order.ID, models.OrderStatusPendingPayment, order.Status, actor, "Paid from balance")
+	}
+	return nil
+}
+
+func (r *MemoryOrderRepository) GetByID(ctx context.Context, id string) (models.Order, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	order, ok := r.store.orders[id]
+	if !ok {
+		return models.Order{}, ErrNotFound
+	}
+	return order, nil
+}
+
+func (r *MemoryOrderRepository) List(ctx context.Context, filter OrderFilter) ([]models.Order, map[string]int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	keyword := strings.ToLower(filter.Query)
+	counts := make(map[string]int)
+	orders := []models.Order{}
+	for _, order := range r.store.orders {
+		if filter.CustomerID > 0 && order.CustomerID != filter.CustomerID {
+			continue
+		}
+		if !filter.Since.IsZero() && order.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		if keyword != "" && !orderMatches(order, keyword) {
+			continue
+		}
+
+		counts[order.Status]++
+		if len(filter.Statuses) > 0 && !containsString(filter.Statuses, order.Status) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return orders, counts, nil
+}
+
+func (r *MemoryOrderRepository) Events(ctx context.Context, orderID string) ([]models.OrderEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return append([]models.OrderEvent{}, r.store.events[orderID]...), nil
+}
+
+func (r *MemoryOrderRepository) Transition(ctx context.Context, orderID, to, actor, note string) error {
+	_, err := r.settle(orderID, to, actor, note)
+	return err
+}
+
+func (r *MemoryOrderRepository) Cancel(ctx context.Context, orderID, actor, note string) (int, error) {
+	return r.settle(orderID, models.OrderStatusCancelled, actor, note)
+}
+
+func (r *MemoryOrderRepository) Refund(ctx context.Context, orderID, actor, note string) (int, error) {
+	return r.settle(orderID, models.OrderStatusRefunded, actor, note)
+}
+
+// settle - Apply the change together with what the new status undoes, as
+// the MySQL settle does, and return the balance refunded
+func (r *MemoryOrderRepository) settle(orderID, to, actor, note string) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	order, err := r.transition(orderID, to, actor, note)
+	if err != nil {
+		return 0, err
+	}
+	if to != models.OrderStatusCancelled && to != models.OrderStatusRefunded {
+		return 0, nil
+	}
+
+	if to == models.OrderStatusCancelled {
+		for _, item := range order.Items {
+			if item.VariantID != 0 {
+				if v, ok := r.store.variants[item.VariantID]; ok {
+					v.Stock += item.Quantity
+					r.store.variants[v.ID] = v
+				}
+				continue
+			}
+			if p, ok := r.store.products[item.ProductID]; ok {
+				p.Stock += item.Quantity
+				r.store.products[p.ID] = p
+			}
+		}
+
+		if use, ok := r.store.redeemed[order.ID]; ok {
+			if v, ok := r.store.vouchers[use.voucherID]; ok {
+				v.UsedCount--
+				r.store.vouchers[v.ID] = v
+			}
+			delete(r.store.redeemed, order.ID)
+		}
+	}
+
+	refunded := order.BalancePaid
+	if refunded > 0 {
+		if user, ok := r.store.users[order.CustomerID]; ok {
+			user.Balance += refunded
+			r.store.users[user.ID] = user
+		}
+		order.BalancePaid = 0
+		r.store.orders[order.ID] = order
+	}
+
+	return refunded, nil
+}
+
+func (r *MemoryOrderRepository) ReorderLines(ctx context.Context, orderID string) ([]models.ReorderLine, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	order, ok := r.store.orders[orderID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	lines := []models.ReorderLine{}
+	for _, item := range order.Items {
+		p, ok := r.store.products[item.ProductID]
+		if !ok {
+			continue
+		}
+		price, stock := p.Price, p.Stock
+		if item.VariantID != 0 {
+			// Skip variants deleted since the order
+			v, ok := r.store.variants[item.VariantID]
+			if !ok {
+				continue
+			}
+			if v.PriceOverride != nil {
+				price = *v.PriceOverride
+			}
+			stock = v.Stock
+		}
+		lines = append(lines, flagReorderLine(models.ReorderLine{
+			ProductID:     item.ProductID,
+			ProductName:   p.Name,
+			VariantID:     item.VariantID,
+			VariantLabel:  item.VariantLabel,
+			Quantity:      item.Quantity,
+			Price:         price,
+			PreviousPrice: item.Price,
+			Stock:         stock,
+		}))
+	}
+	return lines, nil
+}
+
+// Purchased - Whether a completed order of the customer contains the product
+func (r *MemoryOrderRepository) Purchased(ctx context.Context, customerID int, productID string) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, order := range r.store.orders {
+		if order.CustomerID != customerID || order.Status != models.OrderStatusCompleted {
+			continue
+		}
+		for _, item := range order.Items {
+			if item.ProductID == productID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// transition - Apply a status change; the caller holds the write lock
+func (r *MemoryOrderRepository) transition(orderID, to, actor, note string) (models.Order, error) {
+	order, ok := r.store.orders[orderID]
+	if !ok {
+		return order, ErrNotFound
+	}
+
+	from := order.Status
+	if !models.CanTransitionOrder(from, to) {
+		return order, &TransitionError{From: from, To: to}
+	}
+
+	order.Status = to
+	r.store.orders[orderID] = order
+	r.record(orderID, from, to, actor, note)
+	return order, nil
+}
+
+// record - Append an order event; the caller holds the write lock
+func (r *MemoryOrderRepository) record(orderID, from, to, actor, note string) {
+	r.store.events[orderID] = append(r.store.events[orderID], models.OrderEvent{
+		ID:         r.store.id(),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		Note:       note,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// orderMatches - Order ID or any product name contains the keyword
+func orderMatches(order models.Order, keyword string) bool {
+	if strings.Contains(strings.ToLower(order.ID), keyword) {
+		return true
+	}
+	for _, item := range order.Items {
+		if strings.Contains(strings.ToLower(item.ProductName), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryTokenRepository - TokenRepository kept in process memory, keyed by hash
+type MemoryTokenRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryTokenRepository) Create(ctx context.Context, token models.RefreshToken) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	token.ID = r.store.id()
+	token.CreatedAt = time.Now()
+	r.store.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *MemoryTokenRepository) Rotate(ctx context.Context, oldHash string, next models.RefreshToken) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	old, ok := r.store.tokens[oldHash]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if old.RevokedAt != nil {
+		r.revokeFamily(old.FamilyID)
+		return 0, ErrTokenRevoked
+	}
+	if time.Now().After(old.ExpiresAt) {
+		return 0, ErrTokenExpired
+	}
+
+	now := time.Now()
+	old.RevokedAt = &now
+	r.store.tokens[oldHash] = old
+
+	next.ID = r.store.id()
+	next.UserID = old.UserID
+	next.FamilyID = old.FamilyID
+	next.CreatedAt = now
+	r.store.tokens[next.TokenHash] = next
+	return next.UserID, nil
+}
+
+func (r *MemoryTokenRepository) RevokeFamily(ctx context.Context, hash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if token, ok := r.store.tokens[hash]; ok {
+		r.revokeFamily(token.FamilyID)
+	}
+	return nil
+}
+
+// revokeFamily - The caller holds the write lock
+func (r *MemoryTokenRepository) revokeFamily(familyID string) {
+	now := time.Now()
+	for hash, token := range r.store.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.store.tokens[hash] = token
+		}
+	}
+}
+
+// cartLine - A stored cart line; the rest of models.CartItem is read live
+type cartLine struct {
+	owner CartOwner
+	item  models.CartItem
+}
+
+// MemoryCartRepository - CartRepository kept in process memory
+type MemoryCartRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryCartRepository) Items(ctx context.Context, owner CartOwner) ([]models.CartItem, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.store.cartItems(owner), nil
+}
+
+// cartItems - The caller holds the lock
+func (s *memoryStore) cartItems(owner CartOwner) []models.CartItem {
+	items := []models.CartItem{}
+	for _, line := range s.cart {
+		if line.owner != owner {
+			continue
+		}
+		items = append(items, s.liveCartItem(line.item))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].AddedAt.Equal(items[j].AddedAt) {
+			return items[i].AddedAt.Before(items[j].AddedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+// liveCartItem - The line with the product's current name, image, price
+// and stock. The caller holds the lock.
+func (s *memoryStore) liveCartItem(item models.CartItem) models.CartItem {
+	p := s.products[item.ProductID]
+	item.ProductName, item.Image = p.Name, models.Cover(s.gallery(p.ID))
+	item.Price, item.Stock = p.Price, p.Stock
+	if item.VariantID != 0 {
+		v := s.variants[item.VariantID]
+		if v.PriceOverride != nil {
+			item.Price = *v.PriceOverride
+		}
+		item.Stock = v.Stock
+		item.VariantLabel = v.Label()
+	} else {
+		item.Unavailable = len(s.productVariants(p.ID)) > 0
+	}
+	return item
+}
+
+// touchCart - Record a change to a guest cart. The caller holds the write
+// lock.
+func (s *memoryStore) touchCart(owner CartOwner) {
+	if owner.UserID == 0 && owner.TokenHash != "" {
+		s.guestCarts[owner.TokenHash] = time.Now()
+	}
+}
+
+func (r *MemoryCartRepository) AddItem(ctx context.Context, owner CartOwner, item models.CartItem) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.products[item.ProductID]; !ok {
+		return 0, ErrNotFound
+	}
+	if v, ok := r.store.variants[item.VariantID]; item.VariantID != 0 && (!ok || v.ProductID != item.ProductID) {
+		return 0, ErrNotFound
+	}
+	r.store.touchCart(owner)
+	return r.store.addCartLine(owner, item), nil
+}
+
+// addCartLine - Add the item to the owner's cart as AddItem describes. The
+// caller holds the write lock.
+func (s *memoryStore) addCartLine(owner CartOwner, item models.CartItem) int {
+	for id, line := range s.cart {
+		if line.owner == owner && line.item.ProductID == item.ProductID && line.item.VariantID == item.VariantID {
+			line.item.Quantity += item.Quantity
+			line.item.Selected = true
+			line.item.PreviousPrice = item.PreviousPrice
+			s.cart[id] = line
+			return id
+		}
+	}
+
+	line := cartLine{owner: owner, item: models.CartItem{
+		ID:            s.id(),
+		ProductID:     item.ProductID,
+		VariantID:     item.VariantID,
+		Quantity:      item.Quantity,
+		Selected:      true,
+		PreviousPrice: item.PreviousPrice,
+		AddedAt:       time.Now(),
+	}}
+	s.cart[line.item.ID] = line
+	return line.item.ID
+}
+
+func (r *MemoryCartRepository) UpdateItem(ctx context.Context, owner CartOwner, item models.CartItem) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	line, ok := r.store.cart[item.ID]
+	if !ok || line.owner != owner {
+		return ErrNotFound
+	}
+	line.item.Quantity = item.Quantity
+	line.item.Selected = item.Selected
+	line.item.PreviousPrice = item.PreviousPrice
+	r.store.cart[item.ID] = line
+	r.store.touchCart(owner)
+	return nil
+}
+
+func (r *MemoryCartRepository) DeleteItems(ctx context.Context, owner CartOwner, ids []int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, line := range r.store.cart {
+		if line.owner == owner && (len(ids) == 0 || containsInt(ids, id)) {
+			delete(r.store.cart, id)
+		}
+	}
+	r.store.touchCart(owner)
+	return nil
+}
+
+func (r *MemoryCartRepository) SelectItems(ctx context.Context, owner CartOwner, ids []int, selected bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, line := range r.store.cart {
+		if line.owner == owner && (len(ids) == 0 || containsInt(ids, id)) {
+			line.item.Selected = selected
+			r.store.cart[id] = line
+		}
+	}
+	r.store.touchCart(owner)
+	return nil
+}
+
+func (r *MemoryCartRepository) Merge(ctx context.Context, tokenHash string, userID, maxQuantity int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	guest := CartOwner{TokenHash: tokenHash}
+	user := CartOwner{UserID: userID}
+	saved := r.store.cartItems(user)
+	for _, line := range r.store.cartItems(guest) {
+		match := findCartLine(saved, line.ProductID, line.VariantID)
+		merged := mergeCartLine(match, line, maxQuantity)
+		if match.ID == 0 {
+			// Move the guest line over, keeping when it was added
+			stored := r.store.cart[line.ID]
+			stored.owner = user
+			stored.item.Quantity, stored.item.Selected = merged.Quantity, true
+			r.store.cart[line.ID] = stored
+			continue
+		}
+		stored := r.store.cart[match.ID]
+		stored.item.Quantity, stored.item.Selected = merged.Quantity, true
+		stored.item.PreviousPrice = merged.PreviousPrice
+		r.store.cart[match.ID] = stored
+		delete(r.store.cart, line.ID)
+	}
+
+	delete(r.store.guestCarts, tokenHash)
+	return nil
+}
+
+func (r *MemoryCartRepository) DeleteGuestCarts(ctx context.Context, before time.Time) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	removed := 0
+	for hash, changed := range r.store.guestCarts {
+		if !changed.Before(before) {
+			continue
+		}
+		for id, line := range r.store.cart {
+			if line.owner.TokenHash == hash {
+				delete(r.store.cart, id)
+			}
+		}
+		delete(r.store.guestCarts, hash)
+		delete(r.store.cartCodes, CartOwner{TokenHash: hash})
+		removed++
+	}
+	return removed, nil
+}
+
+func (r *MemoryCartRepository) VoucherID(ctx context.Context, owner CartOwner) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.store.cartCodes[owner], nil
+}
+
+func (r *MemoryCartRepository) SetVoucher(ctx context.Context, owner CartOwner, voucherID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if voucherID == 0 {
+		delete(r.store.cartCodes, owner)
+		return nil
+	}
+	if _, ok := r.store.vouchers[voucherID]; !ok {
+		return ErrNotFound
+	}
+	r.store.cartCodes[owner] = voucherID
+	r.store.touchCart(owner)
+	return nil
+}
+
+// wishlistLine - A stored wishlist line; the rest of models.WishlistItem is
+// read live
+type wishlistLine struct {
+	userID int
+	item   models.WishlistItem
+}
+
+// MemoryWishlistRepository - WishlistRepository kept in process memory
+type MemoryWishlistRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryWishlistRepository) Items(ctx context.Context, userID int) ([]models.WishlistItem, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.store.wishlistItems(userID, nil), nil
+}
+
+// wishlistItems - The user's lines, or only those in ids when given, newest
+// first. The caller holds the lock.
+func (s *memoryStore) wishlistItems(userID int, ids []int) []models.WishlistItem {
+	items := []models.WishlistItem{}
+	for id, line := range s.wishlist {
+		if line.userID != userID || (ids != nil && !containsInt(ids, id)) {
+			continue
+		}
+		item := line.item
+		p := s.products[item.ProductID]
+		item.ProductName, item.Image = p.Name, models.Cover(s.gallery(p.ID))
+		item.Price, item.Stock = p.Price, p.Stock
+		if item.VariantID != 0 {
+			v := s.variants[item.VariantID]
+			if v.PriceOverride != nil {
+				item.Price = *v.PriceOverride
+			}
+			item.Stock = v.Stock
+			item.VariantLabel = v.Label()
+		} else {
+			item.NeedsVariant = len(s.productVariants(p.ID)) > 0
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].AddedAt.Equal(items[j].AddedAt) {
+			return items[i].AddedAt.After(items[j].AddedAt)
+		}
+		return items[i].ID > items[j].ID
+	})
+	return items
+}
+
+// addWishlistLine - Save the item as AddItem describes. The caller holds the
+// write lock.
+func (s *memoryStore) addWishlistLine(userID int, item models.WishlistItem) int {
+	for id, line := range s.wishlist {
+		if line.userID == userID && line.item.ProductID == item.ProductID && line.item.VariantID == item.VariantID {
+			return id
+		}
+	}
+
+	line := wishlistLine{userID: userID, item: models.WishlistItem{
+		ID:         s.id(),
+		ProductID:  item.ProductID,
+		VariantID:  item.VariantID,
+		SavedPrice: item.SavedPrice,
+		AddedAt:    time.Now(),
+	}}
+	s.wishlist[line.item.ID] = line
+	return line.item.ID
+}
+
+func (r *MemoryWishlistRepository) AddItem(ctx context.Context, userID int, item models.WishlistItem) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[userID]; !ok {
+		return 0, ErrNotFound
+	}
+	if _, ok := r.store.products[item.ProductID]; !ok {
+		return 0, ErrNotFound
+	}
+	if v, ok := r.store.variants[item.VariantID]; item.VariantID != 0 && (!ok || v.ProductID != item.ProductID) {
+		return 0, ErrNotFound
+	}
+	return r.store.addWishlistLine(userID, item), nil
+}
+
+func (r *MemoryWishlistRepository) DeleteItems(ctx context.Context, userID int, ids []int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, id := range ids {
+		if line, ok := r.store.wishlist[id]; ok && line.userID == userID {
+			delete(r.store.wishlist, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWishlistRepository) DeleteProduct(ctx context.Context, userID int, productID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, line := range r.store.wishlist {
+		if line.userID == userID && line.item.ProductID == productID {
+			delete(r.store.wishlist, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWishlistRepository) MoveFromCart(ctx context.Context, userID int, cartItemIDs []int) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	moved := 0
+	for _, line := range r.store.cartItems(CartOwner{UserID: userID}) {
+		if !containsInt(cartItemIDs, line.ID) {
+			continue
+		}
+		r.store.addWishlistLine(userID, models.WishlistItem{
+			ProductID:  line.ProductID,
+			VariantID:  line.VariantID,
+			SavedPrice: line.Price,
+		})
+		delete(r.store.cart, line.ID)
+		moved++
+	}
+	return moved, nil
+}
+
+func (r *MemoryWishlistRepository) MoveToCart(ctx context.Context, userID int, ids []int, maxQuantity int) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	owner := CartOwner{UserID: userID}
+	saved := r.store.cartItems(owner)
+	lines := r.store.wishlistItems(userID, ids)
+	for _, line := range lines {
+		match := findCartLine(saved, line.ProductID, line.VariantID)
+		merged := mergeCartLine(match, wishlistCartLine(line), maxQuantity)
+		if match.ID == 0 {
+			r.store.addCartLine(owner, merged)
+		} else {
+			stored := r.store.cart[match.ID]
+			stored.item.Quantity, stored.item.Selected = merged.Quantity, true
+			stored.item.PreviousPrice = merged.PreviousPrice
+			r.store.cart[match.ID] = stored
+		}
+		delete(r.store.wishlist, line.ID)
+	}
+	return len(lines), nil
+}
+
+// voucherUse - A user's claim or redemption of a voucher
+type voucherUse struct {
+	voucherID int
+	userID    int
+}
+
+// MemoryVoucherRepository - VoucherRepository kept in process memory
+type MemoryVoucherRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryVoucherRepository) List(ctx context.Context, filter VoucherFilter) ([]models.Voucher, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	now := time.Now()
+	keyword := strings.ToLower(filter.Query)
+	vouchers := []models.Voucher{}
+	for _, v := range r.store.vouchers {
+		v = r.store.voucherFor(v, filter.UserID)
+		switch {
+		case filter.Claimed && !v.Claimed,
+			filter.Public && !v.IsPublic,
+			filter.Current && (!v.IsActive || !now.Before(v.ExpiresAt)),
+			keyword != "" && !strings.Contains(strings.ToLower(v.Code), keyword) &&
+				!strings.Contains(strings.ToLower(v.Name), keyword):
+			continue
+		}
+		vouchers = append(vouchers, v)
+	}
+
+	sort.Slice(vouchers, func(i, j int) bool {
+		if !vouchers[i].ExpiresAt.Equal(vouchers[j].ExpiresAt) {
+			return vouchers[i].ExpiresAt.Before(vouchers[j].ExpiresAt)
+		}
+		return vouchers[i].ID < vouchers[j].ID
+	})
+	return vouchers, nil
+}
+
+func (r *MemoryVoucherRepository) GetByID(ctx context.Context, id, userID int) (models.Voucher, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	v, ok := r.store.vouchers[id]
+	if !ok {
+		return models.Voucher{}, ErrNotFound
+	}
+	return r.store.voucherFor(v, userID), nil
+}
+
+func (r *MemoryVoucherRepository) GetByCode(ctx context.Context, code string, userID int) (models.Voucher, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	v, ok := r.store.voucherByCode(code)
+	if !ok {
+		return models.Voucher{}, ErrNotFound
+	}
+	return r.store.voucherFor(v, userID), nil
+}
+
+func (r *MemoryVoucherRepository) Create(ctx context.Context, voucher *models.Voucher) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.voucherByCode(voucher.Code); ok {
+		return ErrDuplicate
+	}
+	voucher.ID = r.store.id()
+	voucher.UsedCount = 0
+	voucher.CreatedAt = time.Now()
+	voucher.Claimed, voucher.UserUses = false, 0
+	r.store.vouchers[voucher.ID] = *voucher
+	return nil
+}
+
+func (r *MemoryVoucherRepository) Update(ctx context.Context, voucher models.Voucher) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.vouchers[voucher.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if other, ok := r.store.voucherByCode(voucher.Code); ok && other.ID != voucher.ID {
+		return ErrDuplicate
+	}
+	voucher.UsedCount = existing.UsedCount
+	voucher.CreatedAt = existing.CreatedAt
+	voucher.Claimed, voucher.UserUses = false, 0
+	r.store.vouchers[voucher.ID] = voucher
+	return nil
+}
+
+func (r *MemoryVoucherRepository) Delete(ctx context.Context, id int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.vouchers[id]; !ok {
+		return ErrNotFound
+	}
+	for _, use := range r.store.redeemed {
+		if use.voucherID == id {
+			return ErrInUse
+		}
+	}
+
+	delete(r.store.vouchers, id)
+	for claim := range r.store.claims {
+		if claim.voucherID == id {
+			delete(r.store.claims, claim)
+		}
+	}
+	for owner, voucherID := range r.store.cartCodes {
+		if voucherID == id {
+			delete(r.store.cartCodes, owner)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryVoucherRepository) Claim(ctx context.Context, id, userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.vouchers[id]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := r.store.users[userID]; !ok {
+		return ErrNotFound
+	}
+	r.store.claims[voucherUse{voucherID: id, userID: userID}] = true
+	return nil
+}
+
+// voucherByCode - The caller holds the lock
+func (s *memoryStore) voucherByCode(code string) (models.Voucher, bool) {
+	for _, v := range s.vouchers {
+		if v.Code == code {
+			return v, true
+		}
+	}
+	return models.Voucher{}, false
+}
+
+// voucherFor - Fill in Claimed and UserUses for the user. The caller holds
+// the lock.
+func (s *memoryStore) voucherFor(v models.Voucher, userID int) models.Voucher {
+	v.Claimed = s.claims[voucherUse{voucherID: v.ID, userID: userID}]
+	v.UserUses = 0
+	for _, use := range s.redeemed {
+		if use.voucherID == v.ID && use.userID == userID {
+			v.UserUses++
+		}
+	}
+	return v
+}
+
+type checkoutLine struct {
+	checkoutID string
+	cartItemID int
+	item       models.CartItem
+}
+
+// MemoryCheckoutRepository - CheckoutRepository kept in process memory
+type MemoryCheckoutRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryCheckoutRepository) Create(ctx context.Context, checkout *models.Checkout) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, other := range r.store.checkouts {
+		if other.UserID == checkout.UserID && other.Status == models.CheckoutOpen {
+			r.store.deleteCheckout(id)
+		}
+	}
+
+	now := time.Now()
+	for i := range checkout.Items {
+		item := &checkout.Items[i]
+		if _, ok := r.store.products[item.ProductID]; !ok {
+			return ErrNotFound
+		}
+		line := checkoutLine{checkoutID: checkout.ID, cartItemID: item.ID, item: models.CartItem{
+			ID:            r.store.id(),
+			ProductID:     item.ProductID,
+			VariantID:     item.VariantID,
+			Quantity:      item.Quantity,
+			Selected:      true,
+			PreviousPrice: item.PreviousPrice,
+			AddedAt:       now,
+		}}
+		r.store.checkoutLines[line.item.ID] = line
+		item.ID, item.AddedAt = line.item.ID, now
+	}
+
+	checkout.Status = models.CheckoutOpen
+	checkout.CreatedAt = now
+	stored := *checkout
+	stored.Items = nil
+	r.store.checkouts[checkout.ID] = stored
+	return nil
+}
+
+func (r *MemoryCheckoutRepository) Get(ctx context.Context, id string, userID int) (models.Checkout, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	checkout, ok := r.store.checkouts[id]
+	if !ok || checkout.UserID != userID {
+		return models.Checkout{}, ErrNotFound
+	}
+
+	checkout.Items = []models.CartItem{}
+	for _, line := range r.store.checkoutLines {
+		if line.checkoutID == id {
+			checkout.Items = append(checkout.Items, r.store.liveCartItem(line.item))
+		}
+	}
+	sort.Slice(checkout.Items, func(i, j int) bool { return checkout.Items[i].ID < checkout.Items[j].ID })
+	return checkout, nil
+}
+
+func (r *MemoryCheckoutRepository) Update(ctx context.Context, checkout models.Checkout) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if err := r.store.openCheckout(checkout.ID, checkout.UserID); err != nil {
+		return err
+	}
+
+	stored := r.store.checkouts[checkout.ID]
+	stored.Address = checkout.Address
+	stored.ShippingMethod = checkout.ShippingMethod
+	stored.PaymentMethod = checkout.PaymentMethod
+	stored.VoucherCode = checkout.VoucherCode
+	r.store.checkouts[checkout.ID] = stored
+
+	for _, item := range checkout.Items {
+		line, ok := r.store.checkoutLines[item.ID]
+		if ok && line.checkoutID == checkout.ID {
+			line.item.PreviousPrice = item.PreviousPrice
+			r.store.checkoutLines[item.ID] = line
+		}
+	}
+	return nil
+}
+
+// openCheckout - Returns ErrNotFound when the user has no such session, or
+// ErrCheckoutClosed once it was placed. The caller holds the lock.
+func (s *memoryStore) openCheckout(id string, userID int) error {
+	checkout, ok := s.checkouts[id]
+	if !ok || checkout.UserID != userID {
+		return ErrNotFound
+	}
+	if checkout.Status != models.CheckoutOpen {
+		return ErrCheckoutClosed
+	}
+	return nil
+}
+
+// placeCheckout - Mark the session placed as the order and remove the cart
+// lines it came from. The caller holds the write lock.
+func (s *memoryStore) placeCheckout(order models.Order) {
+	checkout := s.checkouts[order.CheckoutID]
+	checkout.Status = models.CheckoutPlaced
+	checkout.OrderID = order.ID
+	checkout.TermsAcceptedAt = order.TermsAcceptedAt
+	s.checkouts[checkout.ID] = checkout
+
+	owner := CartOwner{UserID: order.CustomerID}
+	for _, line := range s.checkoutLines {
+		if cartLine, ok := s.cart[line.cartItemID]; ok && line.checkoutID == checkout.ID && cartLine.owner == owner {
+			delete(s.cart, line.cartItemID)
+		}
+	}
+}
+
+// deleteCheckout - The caller holds the write lock
+func (s *memoryStore) deleteCheckout(id string) {
+	delete(s.checkouts, id)
+	for lineID, line := range s.checkoutLines {
+		if line.checkoutID == id {
+			delete(s.checkoutLines, lineID)
+		}
+	}
+}
+
+// MemoryAddressRepository - AddressRepository kept in process memory
+type MemoryAddressRepository struct {
+	store *memoryStore
+}
+
+func (r *MemoryAddressRepository) List(ctx context.Context, userID int) ([]models.Address, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	addresses := []models.Address{}
+	for _, a := range r.store.addresses {
+		if a.UserID == userID {
+			addresses = append(addresses, a)
+		}
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		a, b := addresses[i], addresses[j]
+		if a.IsDefault != b.IsDefault {
+			return a.IsDefault
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	return addresses, nil
+}
+
+func (r *MemoryAddressRepository) Get(ctx context.Context, id, userID int) (models.Address, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	a, ok := r.store.addresses[id]
+	if !ok || a.UserID != userID {
+		return models.Address{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (r *MemoryAddressRepository) Create(ctx context.Context, address *models.Address) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[address.UserID]; !ok {
+		return ErrNotFound
+	}
+	if address.IsDefault || r.store.defaultAddress(address.UserID) == 0 {
+		r.store.clearDefaultAddress(address.UserID)
+		address.IsDefault = true
+	}
+
+	address.ID = r.store.id()
+	address.CreatedAt = time.Now()
+	address.UpdatedAt = address.CreatedAt
+	r.store.addresses[address.ID] = *address
+	return nil
+}
+
+func (r *MemoryAddressRepository) Update(ctx context.Context, address *models.Address) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.addresses[address.ID]
+	if !ok || existing.UserID != address.UserID {
+		return ErrNotFound
+	}
+	if address.IsDefault && !existing.IsDefault {
+		r.store.clearDefaultAddress(address.UserID)
+	}
+	address.IsDefault = address.IsDefault || existing.IsDefault
+
+	address.CreatedAt = existing.CreatedAt
+	address.UpdatedAt = time.Now()
+	r.store.addresses[address.ID] = *address
+	return nil
+}
+
+func (r *MemoryAddressRepository) Delete(ctx context.Context, id, userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	a, ok := r.store.addresses[id]
+	if !ok || a.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.store.addresses, id)
+	if !a.IsDefault {
+		return nil
+	}
+
+	// The newest address left takes over
+	newest := models.Address{}
+	for _, other := range r.store.addresses {
+		if other.UserID == userID && (newest.ID == 0 || other.CreatedAt.After(newest.CreatedAt) ||
+			(other.CreatedAt.Equal(newest.CreatedAt) && other.ID > newest.ID)) {
+			newest = other
+		}
+	}
+	if newest.ID != 0 {
+		newest.IsDefault = true
+		r.store.addresses[newest.ID] = newest
+	}
+	return nil
+}
+
+func (r *MemoryAddressRepository) SetDefault(ctx context.Context, id, userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	a, ok := r.store.addresses[id]
+	if !ok || a.UserID != userID {
+		return ErrNotFound
+	}
+	r.store.clearDefaultAddress(userID)
+	a.IsDefault = true
+	r.store.addresses[id] = a
+	return nil
+}
+
+// defaultAddress - ID of the user's default address, 0 for none. The
+// caller holds the lock.
+func (s *memoryStore) defaultAddress(userID int) int {
+	for id, a := range s.addresses {
+		if a.UserID == userID && a.IsDefault {
+			return id
+		}
+	}
+	return 0
+}
+
+// clearDefaultAddress - Unset the user's default. The caller holds the
+// write lock.
+func (s *memoryStore) clearDefaultAddress(userID int) {
+	if id := s.defaultAddress(userID); id != 0 {
+		a := s.addresses[id]
+		a.IsDefault = false
+		s.addresses[id] = a
+	}
+}
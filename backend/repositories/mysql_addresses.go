@@ -0,0 +1,217 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLAddressRepository - AddressRepository backed by the addresses table
+type MySQLAddressRepository struct {
+	db *sql.DB
+}
+
+// addressColumns - Columns of addresses read by scanAddress
+const addressColumns = `id, user_id, label, recipient_name, phone, street, province_code, province, city, district,
+                        postal_code, COALESCE(notes, ''), is_default, created_at, updated_at`
+
+func scanAddress(row scanner) (models.Address, error) {
+	var a models.Address
+	err := row.Scan(&a.ID, &a.UserID, &a.Label, &a.RecipientName, &a.Phone, &a.Street, &a.ProvinceCode, &a.Province,
+		&a.City, &a.District, &a.PostalCode, &a.Notes, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+func (r *MySQLAddressRepository) List(ctx context.Context, userID int) ([]models.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE user_id = ? ORDER BY is_default DESC, created_at DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []models.Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+
+	return addresses, rows.Err()
+}
+
+func (r *MySQLAddressRepository) Get(ctx context.Context, id, userID int) (models.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE id = ? AND user_id = ?`
+	a, err := scanAddress(r.db.QueryRowContext(ctx, query, id, userID))
+	if err == sql.ErrNoRows {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *MySQLAddressRepository) Create(ctx context.Context, address *models.Address) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockAddresses(ctx, tx, address.UserID); err != nil {
+		return err
+	}
+	if !address.IsDefault {
+		var count int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM addresses WHERE user_id = ?`, address.UserID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		address.IsDefault = count == 0
+	}
+	if address.IsDefault {
+		if err := clearDefaultAddress(ctx, tx, address.UserID); err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO addresses (user_id, label, recipient_name, phone, street, province_code, province, city, district,
+                                     postal_code, notes, is_default)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, address.UserID, address.Label, address.RecipientName, address.Phone,
+		address.Street, address.ProvinceCode, address.Province, address.City, address.District, address.PostalCode,
+		nullString(address.Notes), address.IsDefault)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	address.ID = int(id)
+	address.CreatedAt = time.Now()
+	address.UpdatedAt = address.CreatedAt
+
+	return tx.Commit()
+}
+
+func (r *MySQLAddressRepository) Update(ctx context.Context, address *models.Address) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockAddresses(ctx, tx, address.UserID); err != nil {
+		return err
+	}
+	var wasDefault bool
+	err = tx.QueryRowContext(ctx, `SELECT is_default FROM addresses WHERE id = ? AND user_id = ?`,
+		address.ID, address.UserID).Scan(&wasDefault)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if address.IsDefault && !wasDefault {
+		if err := clearDefaultAddress(ctx, tx, address.UserID); err != nil {
+			return err
+		}
+	}
+	address.IsDefault = address.IsDefault || wasDefault
+
+	query := `UPDATE addresses
+              SET label = ?, recipient_name = ?, phone = ?, street = ?, province_code = ?, province = ?, city = ?,
+                  district = ?, postal_code = ?, notes = ?, is_default = ?
+              WHERE id = ?`
+	_, err = tx.ExecContext(ctx, query, address.Label, address.RecipientName, address.Phone, address.Street,
+		address.ProvinceCode, address.Province, address.City, address.District, address.PostalCode,
+		nullString(address.Notes), address.IsDefault, address.ID)
+	if err != nil {
+		return err
+	}
+	address.UpdatedAt = time.Now()
+
+	return tx.Commit()
+}
+
+func (r *MySQLAddressRepository) Delete(ctx context.Context, id, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockAddresses(ctx, tx, userID); err != nil {
+		return err
+	}
+	var wasDefault bool
+	err = tx.QueryRowContext(ctx, `SELECT is_default FROM addresses WHERE id = ? AND user_id = ?`, id, userID).Scan(&wasDefault)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM addresses WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if wasDefault {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default = TRUE WHERE user_id = ?
+                                       ORDER BY created_at DESC, id DESC LIMIT 1`, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *MySQLAddressRepository) SetDefault(ctx context.Context, id, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockAddresses(ctx, tx, userID); err != nil {
+		return err
+	}
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM addresses WHERE id = ? AND user_id = ?`, id, userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := clearDefaultAddress(ctx, tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default = TRUE WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockAddresses - Lock the user row so changes to the user's addresses, and
+// which one is the default, happen one at a time. Returns ErrNotFound for an
+// unknown user.
+func lockAddresses(ctx context.Context, tx *sql.Tx, userID int) error {
+	var id int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = ? FOR UPDATE`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// clearDefaultAddress - Unset the user's default before another takes its
+// place, as the unique key allows one at a time
+func clearDefaultAddress(ctx context.Context, tx *sql.Tx, userID int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default = FALSE WHERE user_id = ? AND is_default`, userID)
+	return err
+}
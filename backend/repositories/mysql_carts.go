@@ -0,0 +1,326 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLCartRepository - CartRepository backed by the carts and cart_items
+// tables
+type MySQLCartRepository struct {
+	db *sql.DB
+}
+
+// cartItemColumns - Columns of cart_items ci, products p and
+// product_variants v read by scanCartItem. A line without a variant is
+// unavailable once the product has variants.
+const cartItemColumns = `ci.id, ci.product_id, p.name, ` + productCover + `, COALESCE(ci.variant_id, 0), v.options,
+                         ci.quantity, ci.selected, ci.price, ci.created_at, COALESCE(v.price, p.price),
+                         IF(ci.variant_id IS NULL, p.stock, v.stock),
+                         ci.variant_id IS NULL AND EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id)`
+
+func (r *MySQLCartRepository) Items(ctx context.Context, owner CartOwner) ([]models.CartItem, error) {
+	where, arg := cartOwnerClause(owner)
+	return loadCartItems(ctx, r.db, where, arg)
+}
+
+// loadCartItems - Lines of the carts c matching the WHERE clause, oldest
+// first
+func loadCartItems(ctx context.Context, db queryer, where string, args ...interface{}) ([]models.CartItem, error) {
+	query := `SELECT ` + cartItemColumns + `
+              FROM carts c
+              JOIN cart_items ci ON ci.cart_id = c.id
+              JOIN products p ON p.id = ci.product_id
+              LEFT JOIN product_variants v ON v.id = ci.variant_id
+              WHERE ` + where + `
+              ORDER BY ci.created_at, ci.id`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.CartItem{}
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *MySQLCartRepository) AddItem(ctx context.Context, owner CartOwner, item models.CartItem) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the cart keeps one line per product and variant
+	cartID, err := lockCart(ctx, tx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := addCartLine(ctx, tx, cartID, item)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *MySQLCartRepository) UpdateItem(ctx context.Context, owner CartOwner, item models.CartItem) error {
+	where, arg := cartOwnerClause(owner)
+	query := `UPDATE cart_items ci JOIN carts c ON c.id = ci.cart_id
+              SET ci.quantity = ?, ci.selected = ?, ci.price = ?, c.updated_at = CURRENT_TIMESTAMP
+              WHERE ci.id = ? AND ` + where
+	result, err := r.db.ExecContext(ctx, query, item.Quantity, item.Selected, item.PreviousPrice, item.ID, arg)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		return nil
+	}
+
+	// Storing the same values again changes no rows either
+	var exists int
+	query = `SELECT 1 FROM cart_items ci JOIN carts c ON c.id = ci.cart_id WHERE ci.id = ? AND ` + where
+	err = r.db.QueryRowContext(ctx, query, item.ID, arg).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *MySQLCartRepository) DeleteItems(ctx context.Context, owner CartOwner, ids []int) error {
+	where, arg := cartOwnerClause(owner)
+	query := `DELETE ci FROM cart_items ci JOIN carts c ON c.id = ci.cart_id WHERE ` + where
+	args := []interface{}{arg}
+	if len(ids) > 0 {
+		query += ` AND ci.id IN (` + placeholders(len(ids)) + `)`
+		args = append(args, intArgs(ids)...)
+	}
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE carts c SET c.updated_at = CURRENT_TIMESTAMP WHERE `+where, arg)
+	return err
+}
+
+func (r *MySQLCartRepository) SelectItems(ctx context.Context, owner CartOwner, ids []int, selected bool) error {
+	where, arg := cartOwnerClause(owner)
+	query := `UPDATE cart_items ci JOIN carts c ON c.id = ci.cart_id
+              SET ci.selected = ?, c.updated_at = CURRENT_TIMESTAMP
+              WHERE ` + where
+	args := []interface{}{selected, arg}
+	if len(ids) > 0 {
+		query += ` AND ci.id IN (` + placeholders(len(ids)) + `)`
+		args = append(args, intArgs(ids)...)
+	}
+
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *MySQLCartRepository) Merge(ctx context.Context, tokenHash string, userID, maxQuantity int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var guestID int
+	err = tx.QueryRowContext(ctx, `SELECT id FROM carts WHERE token_hash = ? FOR UPDATE`, tokenHash).Scan(&guestID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cartID, err := lockCart(ctx, tx, CartOwner{UserID: userID})
+	if err != nil {
+		return err
+	}
+
+	guest, err := loadCartItems(ctx, tx, `c.id = ?`, guestID)
+	if err != nil {
+		return err
+	}
+	saved, err := loadCartItems(ctx, tx, `c.id = ?`, cartID)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range guest {
+		match := findCartLine(saved, line.ProductID, line.VariantID)
+		merged := mergeCartLine(match, line, maxQuantity)
+		if match.ID == 0 {
+			// Move the guest line over, keeping when it was added
+			query := `UPDATE cart_items SET cart_id = ?, quantity = ?, selected = TRUE WHERE id = ?`
+			_, err = tx.ExecContext(ctx, query, cartID, merged.Quantity, line.ID)
+		} else {
+			query := `UPDATE cart_items SET quantity = ?, selected = TRUE, price = ? WHERE id = ?`
+			_, err = tx.ExecContext(ctx, query, merged.Quantity, merged.PreviousPrice, match.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Lines folded into saved ones go with the guest cart
+	if _, err := tx.ExecContext(ctx, `DELETE FROM carts WHERE id = ?`, guestID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MySQLCartRepository) DeleteGuestCarts(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM carts WHERE user_id IS NULL AND updated_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+func (r *MySQLCartRepository) VoucherID(ctx context.Context, owner CartOwner) (int, error) {
+	where, arg := cartOwnerClause(owner)
+	var id int
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(c.voucher_id, 0) FROM carts c WHERE `+where, arg).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (r *MySQLCartRepository) SetVoucher(ctx context.Context, owner CartOwner, voucherID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cartID, err := lockCart(ctx, tx, owner)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE carts SET voucher_id = ? WHERE id = ?`, nullInt(voucherID), cartID)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addCartLine - Add the item to the locked cart as AddItem describes
+func addCartLine(ctx context.Context, tx *sql.Tx, cartID int, item models.CartItem) (int, error) {
+	var id int
+	query := `SELECT id FROM cart_items WHERE cart_id = ? AND product_id = ? AND variant_id <=> ?`
+	err := tx.QueryRowContext(ctx, query, cartID, item.ProductID, nullInt(item.VariantID)).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		query = `INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, selected, price, created_at) VALUES (?, ?, ?, ?, TRUE, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, cartID, item.ProductID, nullInt(item.VariantID), item.Quantity,
+			item.PreviousPrice, time.Now())
+		if isForeignKeyViolation(err) {
+			return 0, ErrNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		lastID, _ := result.LastInsertId()
+		id = int(lastID)
+	case err != nil:
+		return 0, err
+	default:
+		query = `UPDATE cart_items SET quantity = quantity + ?, selected = TRUE, price = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, query, item.Quantity, item.PreviousPrice, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// cartOwnerClause - Condition on carts c selecting the owner's cart, and
+// its argument
+func cartOwnerClause(owner CartOwner) (string, interface{}) {
+	if owner.UserID != 0 {
+		return `c.user_id = ?`, owner.UserID
+	}
+	return `c.token_hash = ?`, owner.TokenHash
+}
+
+// lockCart - ID of the owner's cart, created on first use, locked until the
+// transaction ends
+func lockCart(ctx context.Context, tx *sql.Tx, owner CartOwner) (int, error) {
+	query := `INSERT INTO carts (user_id, token_hash) VALUES (?, ?) ON DUPLICATE KEY UPDATE updated_at = CURRENT_TIMESTAMP`
+	_, err := tx.ExecContext(ctx, query, nullInt(owner.UserID), nullString(owner.TokenHash))
+	if isForeignKeyViolation(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	where, arg := cartOwnerClause(owner)
+	err = tx.QueryRowContext(ctx, `SELECT id FROM carts c WHERE `+where+` FOR UPDATE`, arg).Scan(&id)
+	return id, err
+}
+
+// findCartLine - The line for the product and variant, or the zero value
+func findCartLine(items []models.CartItem, productID string, variantID int) models.CartItem {
+	for _, item := range items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			return item
+		}
+	}
+	return models.CartItem{}
+}
+
+// mergeCartLine - The guest line folded into the saved one (the zero value
+// when the user has none), by the rules of CartRepository.Merge. Shared
+// with the memory implementation.
+func mergeCartLine(saved, guest models.CartItem, maxQuantity int) models.CartItem {
+	merged := guest
+	if saved.ID != 0 {
+		merged = saved
+		merged.Quantity += guest.Quantity
+		if merged.PreviousPrice == merged.Price {
+			merged.PreviousPrice = guest.PreviousPrice
+		}
+	}
+
+	limit := max(min(merged.Stock, maxQuantity), 1)
+	merged.Quantity = min(merged.Quantity, limit)
+	merged.Selected = true
+	return merged
+}
+
+func scanCartItem(row scanner) (models.CartItem, error) {
+	var item models.CartItem
+	var options []byte
+	err := row.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Image, &item.VariantID, &options,
+		&item.Quantity, &item.Selected, &item.PreviousPrice, &item.AddedAt, &item.Price, &item.Stock, &item.Unavailable)
+	if err != nil {
+		return item, err
+	}
+
+	var variant models.ProductVariant
+	if err := decodeJSON(options, &variant.Options); err != nil {
+		return item, err
+	}
+	item.VariantLabel = variant.Label()
+	return item, nil
+}
@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLCategoryRepository - CategoryRepository backed by the categories table
+type MySQLCategoryRepository struct {
+	db *sql.DB
+}
+
+const categoryColumns = `id, parent_id, name, slug, image, sort_order, created_at`
+
+func (r *MySQLCategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	return loadCategories(ctx, r.db)
+}
+
+func (r *MySQLCategoryRepository) GetByID(ctx context.Context, id int) (models.Category, error) {
+	return r.get(ctx, `SELECT `+categoryColumns+` FROM categories WHERE id = ?`, id)
+}
+
+func (r *MySQLCategoryRepository) GetBySlug(ctx context.Context, slug string) (models.Category, error) {
+	return r.get(ctx, `SELECT `+categoryColumns+` FROM categories WHERE slug = ?`, slug)
+}
+
+func (r *MySQLCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	query := `INSERT INTO categories (parent_id, name, slug, image, sort_order) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, category.ParentID, category.Name, category.Slug,
+		category.Image, category.SortOrder)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	category.ID = int(id)
+	category.CreatedAt = time.Now()
+	return nil
+}
+
+func (r *MySQLCategoryRepository) Update(ctx context.Context, category models.Category) error {
+	query := `UPDATE categories SET parent_id = ?, name = ?, slug = ?, image = ?, sort_order = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, category.ParentID, category.Name, category.Slug,
+		category.Image, category.SortOrder, category.ID)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing changed or nothing there
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM categories WHERE id = ?`, category.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *MySQLCategoryRepository) Delete(ctx context.Context, id int) error {
+	// Subcategories and products reference the row, so the foreign keys
+	// refuse the delete while either exists
+	result, err := r.db.ExecContext(ctx, `DELETE FROM categories WHERE id = ?`, id)
+	if isReferencedRow(err) {
+		return ErrInUse
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MySQLCategoryRepository) get(ctx context.Context, query string, arg interface{}) (models.Category, error) {
+	category, err := scanCategory(r.db.QueryRowContext(ctx, query, arg))
+	if err == sql.ErrNoRows {
+		return category, ErrNotFound
+	}
+	return category, err
+}
+
+// loadCategories - Every category in display order
+func loadCategories(ctx context.Context, db queryer) ([]models.Category, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY sort_order, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+func scanCategory(row scanner) (models.Category, error) {
+	var category models.Category
+	var parentID sql.NullInt64
+	err := row.Scan(&category.ID, &parentID, &category.Name, &category.Slug, &category.Image,
+		&category.SortOrder, &category.CreatedAt)
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		category.ParentID = &id
+	}
+	return category, err
+}
@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLCheckoutRepository - CheckoutRepository backed by the
+// checkout_sessions and checkout_items tables
+type MySQLCheckoutRepository struct {
+	db *sql.DB
+}
+
+// checkoutItemColumns - Columns of checkout_items ci, products p and
+// product_variants v read by scanCartItem; every line counts as selected
+const checkoutItemColumns = `ci.id, ci.product_id, p.name, ` + productCover + `, COALESCE(ci.variant_id, 0), v.options,
+                             ci.quantity, TRUE, ci.price, ci.created_at, COALESCE(v.price, p.price),
+                             IF(ci.variant_id IS NULL, p.stock, v.stock),
+                             ci.variant_id IS NULL AND EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id)`
+
+func (r *MySQLCheckoutRepository) Create(ctx context.Context, checkout *models.Checkout) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM checkout_sessions WHERE user_id = ? AND status = ?`, checkout.UserID, models.CheckoutOpen)
+	if err != nil {
+		return err
+	}
+
+	checkout.Status = models.CheckoutOpen
+	_, err = tx.ExecContext(ctx, `INSERT INTO checkout_sessions (id, user_id, status, voucher_code, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		checkout.ID, checkout.UserID, checkout.Status, nullString(checkout.VoucherCode), checkout.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, item := range checkout.Items {
+		result, err := tx.ExecContext(ctx, `INSERT INTO checkout_items (checkout_id, cart_item_id, product_id, variant_id, quantity, price)
+                                            VALUES (?, ?, ?, ?, ?, ?)`,
+			checkout.ID, nullInt(item.ID), item.ProductID, nullInt(item.VariantID), item.Quantity, item.PreviousPrice)
+		if isForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		checkout.Items[i].ID = int(id)
+		checkout.Items[i].AddedAt = now
+	}
+
+	checkout.CreatedAt = now
+	return tx.Commit()
+}
+
+func (r *MySQLCheckoutRepository) Get(ctx context.Context, id string, userID int) (models.Checkout, error) {
+	query := `SELECT id, user_id, status, address, COALESCE(shipping_method, ''), COALESCE(payment_method, ''),
+                     COALESCE(voucher_code, ''), COALESCE(order_id, ''), terms_accepted_at, expires_at, created_at
+              FROM checkout_sessions WHERE id = ? AND user_id = ?`
+
+	var checkout models.Checkout
+	var address []byte
+	var acceptedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, id, userID).Scan(&checkout.ID, &checkout.UserID, &checkout.Status, &address,
+		&checkout.ShippingMethod, &checkout.PaymentMethod, &checkout.VoucherCode, &checkout.OrderID, &acceptedAt,
+		&checkout.ExpiresAt, &checkout.CreatedAt)
+	if err == sql.ErrNoRows {
+		return checkout, ErrNotFound
+	}
+	if err != nil {
+		return checkout, err
+	}
+	if err := decodeJSON(address, &checkout.Address); err != nil {
+		return checkout, err
+	}
+	if acceptedAt.Valid {
+		checkout.TermsAcceptedAt = &acceptedAt.Time
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+checkoutItemColumns+`
+                                         FROM checkout_items ci
+                                         JOIN products p ON p.id = ci.product_id
+                                         LEFT JOIN product_variants v ON v.id = ci.variant_id
+                                         WHERE ci.checkout_id = ?
+                                         ORDER BY ci.id`, id)
+	if err != nil {
+		return checkout, err
+	}
+	defer rows.Close()
+
+	checkout.Items = []models.CartItem{}
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			return checkout, err
+		}
+		checkout.Items = append(checkout.Items, item)
+	}
+
+	return checkout, rows.Err()
+}
+
+func (r *MySQLCheckoutRepository) Update(ctx context.Context, checkout models.Checkout) error {
+	address, err := encodeAddress(checkout.Address)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockOpenCheckout(ctx, tx, checkout.ID, checkout.UserID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE checkout_sessions
+                                  SET address = ?, shipping_method = ?, payment_method = ?, voucher_code = ?
+                                  WHERE id = ?`,
+		address, nullString(checkout.ShippingMethod), nullString(checkout.PaymentMethod), nullString(checkout.VoucherCode),
+		checkout.ID)
+	if err != nil {
+		return err
+	}
+	for _, item := range checkout.Items {
+		_, err = tx.ExecContext(ctx, `UPDATE checkout_items SET price = ? WHERE id = ? AND checkout_id = ?`,
+			item.PreviousPrice, item.ID, checkout.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// lockOpenCheckout - Lock the user's session until the transaction ends.
+// Returns ErrNotFound, or ErrCheckoutClosed once it was placed.
+func lockOpenCheckout(ctx context.Context, tx *sql.Tx, id string, userID int) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM checkout_sessions WHERE id = ? AND user_id = ? FOR UPDATE`,
+		id, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.CheckoutOpen {
+		return ErrCheckoutClosed
+	}
+	return nil
+}
+
+// placeCheckout - Mark the locked session placed as the order and remove
+// the cart lines it came from
+func placeCheckout(ctx context.Context, tx *sql.Tx, order models.Order) error {
+	_, err := tx.ExecContext(ctx, `UPDATE checkout_sessions SET status = ?, order_id = ?, terms_accepted_at = ? WHERE id = ?`,
+		models.CheckoutPlaced, order.ID, order.TermsAcceptedAt, order.CheckoutID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE ci FROM cart_items ci
+                                  JOIN checkout_items ki ON ki.cart_item_id = ci.id
+                                  JOIN carts c ON c.id = ci.cart_id
+                                  WHERE ki.checkout_id = ? AND c.user_id = ?`, order.CheckoutID, order.CustomerID)
+	return err
+}
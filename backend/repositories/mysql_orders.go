@@ -0,0 +1,601 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+)
+
+// MySQLOrderRepository - OrderRepository backed by the orders, order_items and
+// order_events tables
+type MySQLOrderRepository struct {
+	db *sql.DB
+}
+
+func (r *MySQLOrderRepository) Create(ctx context.Context, order *models.Order, rules pricing.Rules, actor string) error {
+	// Lock rows in a fixed order to avoid deadlocks between concurrent checkouts
+	sortOrderItems(order.Items)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if order.CheckoutID != "" {
+		if err := lockOpenCheckout(ctx, tx, order.CheckoutID, order.CustomerID); err != nil {
+			return err
+		}
+	}
+
+	// Paying from the balance keeps the customer row locked until commit
+	query := `SELECT is_member, balance FROM users WHERE id = ?`
+	if order.PaymentMethod == models.PaymentBalance {
+		query += ` FOR UPDATE`
+	}
+	var member bool
+	var balance int
+	err = tx.QueryRowContext(ctx, query, order.CustomerID).Scan(&member, &balance)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var productIDs []string
+	for _, item := range order.Items {
+		if len(productIDs) == 0 || productIDs[len(productIDs)-1] != item.ProductID {
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	query = `SELECT id, name, price, stock FROM products WHERE id IN (` + placeholders(len(productIDs)) + `) ORDER BY id FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, stringArgs(productIDs)...)
+	if err != nil {
+		return err
+	}
+
+	locked := make(map[string]models.Product)
+	for rows.Next() {
+		var p models.Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock); err != nil {
+			rows.Close()
+			return err
+		}
+		locked[p.ID] = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Every variant of the ordered products, so items missing a required variant are caught
+	variants, err := loadVariants(ctx, tx, `WHERE product_id IN (`+placeholders(len(productIDs))+`) ORDER BY product_id, id FOR UPDATE`,
+		stringArgs(productIDs)...)
+	if err != nil {
+		return err
+	}
+
+	if err := priceItems(order.Items, locked, variants); err != nil {
+		return err
+	}
+
+	order.Status = models.OrderStatusPendingPayment
+	order.CreatedAt = time.Now()
+	for i := range order.Items {
+		order.Items[i].OrderID = order.ID
+	}
+
+	// The voucher stays locked until commit, so its limits hold under
+	// concurrent checkouts
+	var voucher *models.Voucher
+	if order.VoucherCode != "" {
+		locked, err := lockVoucher(ctx, tx, order.VoucherCode, order.CustomerID)
+		if err != nil {
+			return err
+		}
+		voucher = &locked
+		order.VoucherCode = locked.Code
+	}
+	if err := priceOrder(order, rules, member, voucher); err != nil {
+		return err
+	}
+	if order.PaymentMethod == models.PaymentBalance {
+		if balance < order.Total {
+			return ErrInsufficientBalance
+		}
+		order.BalancePaid = order.Total
+		order.Status = models.OrderStatusPaid
+	}
+
+	address, err := encodeAddress(order.ShippingAddress)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO orders (id, customer_id, checkout_id, shipping_address, shipping_method, payment_method,
+                                                      terms_accepted_at, subtotal, member_discount, voucher_discount, voucher_code,
+                                                      shipping, shipping_discount, tax_rate, tax_included, tax, total, balance_paid,
+                                                      status)
+                                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.ID, order.CustomerID, nullString(order.CheckoutID), address, nullString(order.ShippingMethod),
+		nullString(order.PaymentMethod), order.TermsAcceptedAt, order.Subtotal, order.MemberDiscount, order.VoucherDiscount,
+		nullString(order.VoucherCode), order.Shipping, order.ShippingDiscount, order.TaxRate, order.TaxIncluded, order.Tax,
+		order.Total, order.BalancePaid, order.Status)
+	if err != nil {
+		return err
+	}
+	if order.CheckoutID != "" {
+		if err := placeCheckout(ctx, tx, *order); err != nil {
+			return err
+		}
+	}
+	if voucher != nil {
+		if err := redeemVoucher(ctx, tx, voucher.ID, *order); err != nil {
+			return err
+		}
+	}
+
+	for i, item := range order.Items {
+		result, err := tx.ExecContext(ctx, `INSERT INTO order_items (order_id, product_id, variant_id, variant_label, quantity, price,
+                                                                     member_discount, voucher_discount, tax, total)
+                                            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			item.OrderID, item.ProductID, nullInt(item.VariantID), nullString(item.VariantLabel), item.Quantity, item.Price,
+			item.MemberDiscount, item.VoucherDiscount, item.Tax, item.Total)
+		if err != nil {
+			return err
+		}
+		itemID, _ := result.LastInsertId()
+		order.Items[i].ID = int(itemID)
+
+		if item.VariantID != 0 {
+			_, err = tx.ExecContext(ctx, `UPDATE product_variants SET stock = stock - ? WHERE id = ?`, item.Quantity, item.VariantID)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE products SET stock = stock - ? WHERE id = ?`, item.Quantity, item.ProductID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordOrderEvent(ctx, tx, order.ID, "", models.OrderStatusPendingPayment, actor, "Order placed")
+	if err != nil {
+		return err
+	}
+	if order.BalancePaid > 0 {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET balance = balance - ? WHERE id = ?`, order.BalancePaid, order.CustomerID)
+		if err != nil {
+			return err
+		}
+		err = recordOrderEvent(ctx, tx, order.ID, models.OrderStatusPendingPayment, order.Status, actor, "Paid from balance")
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *MySQLOrderRepository) GetByID(ctx context.Context, id string) (models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders o WHERE o.id = ?`
+	order, err := scanOrder(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return order, ErrNotFound
+	}
+	if err != nil {
+		return order, err
+	}
+
+	items, err := r.loadItems(ctx, []string{order.ID})
+	if err != nil {
+		return order, err
+	}
+	order.Items = items[order.ID]
+
+	return order, nil
+}
+
+func (r *MySQLOrderRepository) List(ctx context.Context, filter OrderFilter) ([]models.Order, map[string]int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.CustomerID > 0 {
+		conditions = append(conditions, "o.customer_id = ?")
+		args = append(args, filter.CustomerID)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "o.created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Query != "" {
+		searchPattern := containsPattern(filter.Query)
+		conditions = append(conditions, `(o.id LIKE ? ESCAPE '\\' OR EXISTS (
+			SELECT 1 FROM order_items oi JOIN products p ON p.id = oi.product_id
+			WHERE oi.order_id = o.id AND p.name LIKE ? ESCAPE '\\'))`)
+		args = append(args, searchPattern, searchPattern)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Counts per status ignore the status filter
+	counts := make(map[string]int)
+	rows, err := r.db.QueryContext(ctx, `SELECT o.status, COUNT(*) FROM orders o`+where+` GROUP BY o.status`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		counts[models.NormalizeOrderStatus(status)] += n
+	}
+	rows.Close()
+
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, "o.status IN ("+placeholders(len(filter.Statuses))+")")
+		args = append(args, stringArgs(filter.Statuses)...)
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `SELECT ` + orderColumns + ` FROM orders o` + where + ` ORDER BY o.created_at DESC`
+	rows, err = r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	var orderIDs []string
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		orders = append(orders, order)
+		orderIDs = append(orderIDs, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	items, err := r.loadItems(ctx, orderIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+	}
+
+	return orders, counts, nil
+}
+
+func (r *MySQLOrderRepository) Events(ctx context.Context, orderID string) ([]models.OrderEvent, error) {
+	query := `SELECT id, order_id, COALESCE(from_status, ''), to_status, actor, COALESCE(note, ''), created_at
+              FROM order_events
+              WHERE order_id = ?
+              ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.OrderEvent{}
+	for rows.Next() {
+		var event models.OrderEvent
+		err := rows.Scan(&event.ID, &event.OrderID, &event.FromStatus, &event.ToStatus,
+			&event.Actor, &event.Note, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *MySQLOrderRepository) Transition(ctx context.Context, orderID, to, actor, note string) error {
+	_, err := r.settle(ctx, orderID, to, actor, note)
+	return err
+}
+
+func (r *MySQLOrderRepository) Cancel(ctx context.Context, orderID, actor, note string) (int, error) {
+	return r.settle(ctx, orderID, models.OrderStatusCancelled, actor, note)
+}
+
+func (r *MySQLOrderRepository) Refund(ctx context.Context, orderID, actor, note string) (int, error) {
+	return r.settle(ctx, orderID, models.OrderStatusRefunded, actor, note)
+}
+
+// settle - Apply the change together with what the new status undoes, in
+// one transaction, and return the balance refunded. A cancelled order puts
+// the reserved stock and the voucher use back; cancelled and refunded
+// orders both give back what was paid from the customer's balance.
+func (r *MySQLOrderRepository) settle(ctx context.Context, orderID, to, actor, note string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := transitionOrder(ctx, tx, orderID, to, actor, note); err != nil {
+		return 0, err
+	}
+
+	refunded := 0
+	if to == models.OrderStatusCancelled {
+		if err := releaseOrder(ctx, tx, orderID); err != nil {
+			return 0, err
+		}
+	}
+	if to == models.OrderStatusCancelled || to == models.OrderStatusRefunded {
+		if refunded, err = refundBalance(ctx, tx, orderID); err != nil {
+			return 0, err
+		}
+	}
+
+	return refunded, tx.Commit()
+}
+
+func (r *MySQLOrderRepository) ReorderLines(ctx context.Context, orderID string) ([]models.ReorderLine, error) {
+	// Items whose variant was deleted since are skipped
+	query := `SELECT oi.product_id, p.name, COALESCE(oi.variant_id, 0), COALESCE(oi.variant_label, ''), oi.quantity, oi.price,
+                     COALESCE(v.price, p.price), IF(oi.variant_id IS NULL, p.stock, v.stock)
+              FROM order_items oi
+              JOIN products p ON p.id = oi.product_id
+              LEFT JOIN product_variants v ON v.id = oi.variant_id
+              WHERE oi.order_id = ? AND (oi.variant_label IS NULL OR v.id IS NOT NULL)
+              ORDER BY oi.id`
+
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.ReorderLine{}
+	for rows.Next() {
+		var line models.ReorderLine
+		err := rows.Scan(&line.ProductID, &line.ProductName, &line.VariantID, &line.VariantLabel,
+			&line.Quantity, &line.PreviousPrice, &line.Price, &line.Stock)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, flagReorderLine(line))
+	}
+
+	return lines, rows.Err()
+}
+
+func (r *MySQLOrderRepository) Purchased(ctx context.Context, customerID int, productID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM orders o JOIN order_items oi ON oi.order_id = o.id
+              WHERE o.customer_id = ? AND oi.product_id = ? AND o.status = ?)`
+
+	var purchased bool
+	err := r.db.QueryRowContext(ctx, query, customerID, productID, models.OrderStatusCompleted).Scan(&purchased)
+	return purchased, err
+}
+
+// loadItems - Fetch items with product names, grouped by order ID
+func (r *MySQLOrderRepository) loadItems(ctx context.Context, orderIDs []string) (map[string][]models.OrderItem, error) {
+	items := make(map[string][]models.OrderItem)
+	if len(orderIDs) == 0 {
+		return items, nil
+	}
+
+	query := `SELECT oi.id, oi.order_id, oi.product_id, p.name, COALESCE(oi.variant_id, 0), COALESCE(oi.variant_label, ''), oi.quantity, oi.price,
+                     oi.member_discount, oi.voucher_discount, oi.tax, oi.total
+              FROM order_items oi
+              JOIN products p ON p.id = oi.product_id
+              WHERE oi.order_id IN (` + placeholders(len(orderIDs)) + `)
+              ORDER BY oi.id`
+
+	rows, err := r.db.QueryContext(ctx, query, stringArgs(orderIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName,
+			&item.VariantID, &item.VariantLabel, &item.Quantity, &item.Price,
+			&item.MemberDiscount, &item.VoucherDiscount, &item.Tax, &item.Total)
+		if err != nil {
+			return nil, err
+		}
+		items[item.OrderID] = append(items[item.OrderID], item)
+	}
+
+	return items, rows.Err()
+}
+
+// releaseOrder - Put the order's reserved stock back, on the variant when
+// the item had one, and give the voucher use back
+func releaseOrder(ctx context.Context, tx *sql.Tx, orderID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE products p
+                                   JOIN order_items oi ON oi.product_id = p.id
+                                   SET p.stock = p.stock + oi.quantity
+                                   WHERE oi.order_id = ? AND oi.variant_id IS NULL AND oi.variant_label IS NULL`, orderID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE product_variants v
+                                  JOIN order_items oi ON oi.variant_id = v.id
+                                  SET v.stock = v.stock + oi.quantity
+                                  WHERE oi.order_id = ?`, orderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE vouchers v
+                                  JOIN voucher_redemptions vr ON vr.voucher_id = v.id
+                                  SET v.used_count = v.used_count - 1
+                                  WHERE vr.order_id = ?`, orderID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM voucher_redemptions WHERE order_id = ?`, orderID)
+	return err
+}
+
+// refundBalance - Credit what the order paid from the customer's balance
+// back to it, once, and return the amount
+func refundBalance(ctx context.Context, tx *sql.Tx, orderID string) (int, error) {
+	var customerID, balancePaid int
+	err := tx.QueryRowContext(ctx, `SELECT customer_id, balance_paid FROM orders WHERE id = ?`, orderID).Scan(&customerID, &balancePaid)
+	if err != nil || balancePaid == 0 {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET balance = balance + ? WHERE id = ?`, balancePaid, customerID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET balance_paid = 0 WHERE id = ?`, orderID)
+	if err != nil {
+		return 0, err
+	}
+	return balancePaid, nil
+}
+
+// transitionOrder - Lock the order, validate the change against the state
+// machine, update it and record the event
+func transitionOrder(ctx context.Context, tx *sql.Tx, orderID, to, actor, note string) error {
+	var from string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = ? FOR UPDATE`, orderID).Scan(&from)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	from = models.NormalizeOrderStatus(from)
+
+	if !models.CanTransitionOrder(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET status = ? WHERE id = ?`, to, orderID)
+	if err != nil {
+		return err
+	}
+
+	return recordOrderEvent(ctx, tx, orderID, from, to, actor, note)
+}
+
+// recordOrderEvent - Append a status change to the order_events table
+func recordOrderEvent(ctx context.Context, tx *sql.Tx, orderID, from, to, actor, note string) error {
+	var fromStatus interface{}
+	if from != "" {
+		fromStatus = from
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO order_events (order_id, from_status, to_status, actor, note) VALUES (?, ?, ?, ?, ?)`,
+		orderID, fromStatus, to, actor, note)
+	return err
+}
+
+// sortOrderItems - Order by product, then variant
+func sortOrderItems(items []models.OrderItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ProductID != items[j].ProductID {
+			return items[i].ProductID < items[j].ProductID
+		}
+		return items[i].VariantID < items[j].VariantID
+	})
+}
+
+// orderColumns - Columns of orders o read by scanOrder
+const orderColumns = `o.id, o.customer_id, COALESCE(o.checkout_id, ''), o.shipping_address, COALESCE(o.shipping_method, ''),
+                      COALESCE(o.payment_method, ''), o.terms_accepted_at, o.subtotal, o.member_discount, o.voucher_discount,
+                      COALESCE(o.voucher_code, ''), o.shipping, o.shipping_discount, o.tax_rate, o.tax_included, o.tax, o.total,
+                      o.balance_paid, o.status, o.created_at`
+
+func scanOrder(row scanner) (models.Order, error) {
+	var order models.Order
+	var address []byte
+	var acceptedAt sql.NullTime
+	err := row.Scan(&order.ID, &order.CustomerID, &order.CheckoutID, &address, &order.ShippingMethod,
+		&order.PaymentMethod, &acceptedAt, &order.Subtotal, &order.MemberDiscount, &order.VoucherDiscount,
+		&order.VoucherCode, &order.Shipping, &order.ShippingDiscount, &order.TaxRate, &order.TaxIncluded, &order.Tax, &order.Total,
+		&order.BalancePaid, &order.Status, &order.CreatedAt)
+	if err != nil {
+		return order, err
+	}
+	if acceptedAt.Valid {
+		order.TermsAcceptedAt = &acceptedAt.Time
+	}
+	order.Status = models.NormalizeOrderStatus(order.Status)
+	return order, decodeJSON(address, &order.ShippingAddress)
+}
+
+// encodeAddress - The JSON column value of an address, NULL for none
+func encodeAddress(address *models.ShippingAddress) (interface{}, error) {
+	if address == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(address)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// nullInt - NULL for zero, which marks "none" in the models
+func nullInt(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// likeEscaper - Escapes the LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern - LIKE pattern matching the text anywhere, with its
+// wildcards taken literally; use it with ESCAPE '\\'
+func containsPattern(text string) string {
+	return "%" + likeEscaper.Replace(text) + "%"
+}
+
+// placeholders - "?,?,?" for an IN clause of n values
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+func intArgs(values []int) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLProductImageRepository - ProductImageRepository backed by the
+// product_images table
+type MySQLProductImageRepository struct {
+	db *sql.DB
+}
+
+func (r *MySQLProductImageRepository) List(ctx context.Context, productID string) ([]models.ProductImage, error) {
+	return loadImages(ctx, r.db, productID)
+}
+
+func (r *MySQLProductImageRepository) Add(ctx context.Context, image *models.ProductImage) error {
+	thumbnails, err := json.Marshal(image.Thumbnails)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the product serializes uploads to the same gallery
+	if err := lockProduct(ctx, tx, image.ProductID); err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_images WHERE product_id = ?`, image.ProductID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	image.Position = count
+	image.IsPrimary = count == 0
+	image.CreatedAt = time.Now()
+
+	query := `INSERT INTO product_images (product_id, storage_key, url, thumbnails, content_type, width, height, size_bytes, position, is_primary, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, image.ProductID, image.Key, image.URL, string(thumbnails), image.ContentType,
+		image.Width, image.Height, image.Size, image.Position, image.IsPrimary, image.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	image.ID = int(id)
+
+	return tx.Commit()
+}
+
+func (r *MySQLProductImageRepository) Delete(ctx context.Context, productID string, imageID int) (models.ProductImage, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return models.ProductImage{}, err
+	}
+
+	images, err := loadImages(ctx, tx, productID)
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	image, ok := findImage(images, imageID)
+	if !ok {
+		return models.ProductImage{}, ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM product_images WHERE id = ?`, imageID)
+	if err != nil {
+		return image, err
+	}
+	// Close the gap in the positions
+	_, err = tx.ExecContext(ctx, `UPDATE product_images SET position = position - 1 WHERE product_id = ? AND position > ?`,
+		productID, image.Position)
+	if err != nil {
+		return image, err
+	}
+	if image.IsPrimary {
+		_, err = tx.ExecContext(ctx, `UPDATE product_images SET is_primary = TRUE WHERE product_id = ? ORDER BY position LIMIT 1`, productID)
+		if err != nil {
+			return image, err
+		}
+	}
+
+	return image, tx.Commit()
+}
+
+func (r *MySQLProductImageRepository) Reorder(ctx context.Context, productID string, ids []int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	images, err := loadImages(ctx, tx, productID)
+	if err != nil {
+		return err
+	}
+	if !sameImages(images, ids) {
+		return ErrNotFound
+	}
+
+	for position, id := range ids {
+		_, err := tx.ExecContext(ctx, `UPDATE product_images SET position = ? WHERE id = ?`, position, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *MySQLProductImageRepository) SetPrimary(ctx context.Context, productID string, imageID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM product_images WHERE id = ? AND product_id = ?`, imageID, productID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE product_images SET is_primary = (id = ?) WHERE product_id = ?`, imageID, productID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockProduct - Lock the product row for the rest of the transaction,
+// ErrNotFound when there is none
+func lockProduct(ctx context.Context, tx *sql.Tx, productID string) error {
+	var exists int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM products WHERE id = ? FOR UPDATE`, productID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// loadImages - Gallery of a product in display order
+func loadImages(ctx context.Context, db queryer, productID string) ([]models.ProductImage, error) {
+	query := `SELECT id, product_id, storage_key, url, thumbnails, content_type, width, height, size_bytes, position, is_primary, created_at
+              FROM product_images WHERE product_id = ? ORDER BY position, id`
+
+	rows, err := db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []models.ProductImage{}
+	for rows.Next() {
+		var image models.ProductImage
+		var thumbnails []byte
+		err := rows.Scan(&image.ID, &image.ProductID, &image.Key, &image.URL, &thumbnails, &image.ContentType,
+			&image.Width, &image.Height, &image.Size, &image.Position, &image.IsPrimary, &image.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(thumbnails, &image.Thumbnails); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
@@ -0,0 +1,448 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLProductRepository - ProductRepository backed by the products table
+type MySQLProductRepository struct {
+	db *sql.DB
+}
+
+// productSortClauses - ORDER BY for each whitelisted sort, with the ID as a
+// tie-breaker so pages never overlap
+var productSortClauses = map[string]string{
+	SortNewest:    "p.created_at DESC, p.id",
+	SortPriceAsc:  "p.price ASC, p.id",
+	SortPriceDesc: "p.price DESC, p.id",
+	SortPopular:   "sold_count DESC, p.id",
+	SortRating:    "p.rating DESC, p.id",
+}
+
+func (r *MySQLProductRepository) List(ctx context.Context, filter ProductFilter) ([]models.Product, int, error) {
+	where, args := productConditions(filter, true)
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM products p`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orderBy, ok := productSortClauses[filter.Sort]
+	if !ok {
+		orderBy = productSortClauses[SortNewest]
+	}
+
+	query := `SELECT ` + productColumns + ` FROM products p` + where + ` ORDER BY ` + orderBy
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	products, err := r.query(ctx, query, args...)
+	return products, total, err
+}
+
+func (r *MySQLProductRepository) Facets(ctx context.Context, filter ProductFilter) (models.ProductFacets, error) {
+	where, args := productConditions(filter, false)
+	if where == "" {
+		where = ` WHERE p.brand <> ''`
+	} else {
+		where += ` AND p.brand <> ''`
+	}
+
+	query := `SELECT p.brand, COUNT(*) FROM products p` + where + ` GROUP BY p.brand ORDER BY COUNT(*) DESC, p.brand`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.ProductFacets{}, err
+	}
+	defer rows.Close()
+
+	facets := models.ProductFacets{Brands: []models.FacetCount{}}
+	for rows.Next() {
+		var brand models.FacetCount
+		if err := rows.Scan(&brand.Value, &brand.Count); err != nil {
+			return facets, err
+		}
+		facets.Brands = append(facets.Brands, brand)
+	}
+
+	return facets, rows.Err()
+}
+
+func (r *MySQLProductRepository) GetByID(ctx context.Context, id string) (models.Product, error) {
+	query := `SELECT ` + productColumns + `, p.description, p.features, p.specs FROM products p WHERE p.id = ?`
+
+	var product models.Product
+	var description sql.NullString
+	var features, specs []byte
+	err := scanProduct(r.db.QueryRowContext(ctx, query, id), &product, &description, &features, &specs)
+	if err == sql.ErrNoRows {
+		return product, ErrNotFound
+	}
+	if err != nil {
+		return product, err
+	}
+	product.Description = description.String
+	if product.CategoryID != nil {
+		categories, err := loadCategories(ctx, r.db)
+		if err != nil {
+			return product, err
+		}
+		product.Breadcrumbs = models.CategoryPath(categories, *product.CategoryID)
+	}
+	if err := decodeJSON(features, &product.Features); err != nil {
+		return product, err
+	}
+	if err := decodeJSON(specs, &product.Specs); err != nil {
+		return product, err
+	}
+
+	product.Images, err = loadImages(ctx, r.db, id)
+	if err != nil {
+		return product, err
+	}
+	product.Image = models.Cover(product.Images)
+
+	variants, err := loadVariants(ctx, r.db, `WHERE product_id = ? ORDER BY id`, id)
+	if err != nil {
+		return product, err
+	}
+	product.ApplyVariants(variants[id])
+
+	return product, nil
+}
+
+func (r *MySQLProductRepository) GetMany(ctx context.Context, ids []string) ([]models.Product, error) {
+	if len(ids) == 0 {
+		return []models.Product{}, nil
+	}
+	query := `SELECT ` + productColumns + ` FROM products p WHERE p.id IN (` + placeholders(len(ids)) + `)`
+	return r.query(ctx, query, stringArgs(ids)...)
+}
+
+func (r *MySQLProductRepository) Create(ctx context.Context, product *models.Product) error {
+	features, specs, tags, err := encodeContent(product.Features, product.Specs, product.Tags)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO products (id, name, price, stock, category_id, brand, description, features, specs, tags)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.ExecContext(ctx, query, product.ID, product.Name, product.Price, product.Stock, product.CategoryID,
+		product.Brand, product.Description, features, specs, tags)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	product.CreatedAt = time.Now()
+	return nil
+}
+
+func (r *MySQLProductRepository) Update(ctx context.Context, id string, req models.ProductUpdateRequest) error {
+	features, specs, tags, err := encodeContent(req.Features, req.Specs, req.Tags)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE products SET name = ?, price = ?, stock = ?, category_id = ?, brand = ?, description = ?,
+              features = ?, specs = ?, tags = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, req.Name, req.Price, req.Stock, req.CategoryID, req.Brand, req.Description,
+		features, specs, tags, id)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing changed or nothing there
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM products WHERE id = ?`, id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *MySQLProductRepository) Delete(ctx context.Context, id string) error {
+	// Order items reference the row, so the foreign key refuses the delete
+	// once the product has been ordered
+	result, err := r.db.ExecContext(ctx, `DELETE FROM products WHERE id = ?`, id)
+	if isReferencedRow(err) {
+		return ErrInUse
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MySQLProductRepository) CreateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	options, images, err := encodeVariant(*variant)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO product_variants (product_id, sku, options, price, stock, images) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, variant.ProductID, variant.SKU, options, variant.PriceOverride, variant.Stock, images)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	variant.ID = int(id)
+	return nil
+}
+
+func (r *MySQLProductRepository) UpdateVariant(ctx context.Context, variant models.ProductVariant) error {
+	options, images, err := encodeVariant(variant)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE product_variants SET sku = ?, options = ?, price = ?, stock = ?, images = ? WHERE id = ? AND product_id = ?`
+	result, err := r.db.ExecContext(ctx, query, variant.SKU, options, variant.PriceOverride, variant.Stock, images, variant.ID, variant.ProductID)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM product_variants WHERE id = ? AND product_id = ?`, variant.ID, variant.ProductID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *MySQLProductRepository) DeleteVariant(ctx context.Context, productID string, variantID int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM product_variants WHERE id = ? AND product_id = ?`, variantID, productID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// productStock - Stock of product p: its variants' total when it has any
+const productStock = `COALESCE((SELECT SUM(v.stock) FROM product_variants v WHERE v.product_id = p.id), p.stock)`
+
+// productCover - Card thumbnail of product p's primary image, empty when
+// it has none
+const productCover = `COALESCE((SELECT JSON_UNQUOTE(JSON_EXTRACT(i.thumbnails, '$.` + models.CardThumbnail + `'))
+                      FROM product_images i WHERE i.product_id = p.id AND i.is_primary LIMIT 1), '')`
+
+// productSold - Units of product p on completed orders
+const productSold = `(SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi JOIN orders o ON o.id = oi.order_id
+                      WHERE oi.product_id = p.id AND o.status = 'completed')`
+
+// productCategory - Name of product p's category, empty when it has none
+const productCategory = `COALESCE((SELECT c.name FROM categories c WHERE c.id = p.category_id), '')`
+
+// productColumns - Columns of the products p read by scanProduct
+const productColumns = `p.id, p.name, p.price, ` + productStock + `, ` + productCover + `, p.category_id, ` +
+	productCategory + `, p.brand, p.tags, ` + productSold + ` AS sold_count, p.rating, p.review_count, p.created_at`
+
+// productConditions - WHERE clause for the filter, with or without its brands
+func productConditions(filter ProductFilter, withBrands bool) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if len(filter.CategoryIDs) > 0 {
+		conditions = append(conditions, "p.category_id IN ("+placeholders(len(filter.CategoryIDs))+")")
+		args = append(args, intArgs(filter.CategoryIDs)...)
+	}
+	if withBrands && len(filter.Brands) > 0 {
+		conditions = append(conditions, "p.brand IN ("+placeholders(len(filter.Brands))+")")
+		args = append(args, stringArgs(filter.Brands)...)
+	}
+	if filter.MinPrice > 0 {
+		conditions = append(conditions, "p.price >= ?")
+		args = append(args, filter.MinPrice)
+	}
+	if filter.MaxPrice > 0 {
+		conditions = append(conditions, "p.price <= ?")
+		args = append(args, filter.MaxPrice)
+	}
+	if filter.MinRating > 0 {
+		conditions = append(conditions, "p.rating >= ?")
+		args = append(args, filter.MinRating)
+	}
+	if filter.InStock {
+		// Products with variants are in stock when any variant is
+		conditions = append(conditions, productStock+` > 0`)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// scanner - Common interface of *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProduct - Scan productColumns, then any extra columns
+func scanProduct(row scanner, product *models.Product, extra ...interface{}) error {
+	var tags []byte
+	var categoryID sql.NullInt64
+	dest := append([]interface{}{&product.ID, &product.Name, &product.Price, &product.Stock, &product.Image, &categoryID,
+		&product.Category, &product.Brand, &tags, &product.SoldCount, &product.Rating, &product.ReviewCount, &product.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		product.CategoryID = &id
+	}
+
+	product.Tags = []string{}
+	return decodeJSON(tags, &product.Tags)
+}
+
+// query - Run a SELECT of productColumns and scan every row
+func (r *MySQLProductRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.Product, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		var product models.Product
+		if err := scanProduct(rows, &product); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+// encodeContent - JSON columns of the product content
+func encodeContent(features []string, specs []models.SpecGroup, tags []string) (string, string, string, error) {
+	f, err := json.Marshal(features)
+	if err != nil {
+		return "", "", "", err
+	}
+	s, err := json.Marshal(specs)
+	if err != nil {
+		return "", "", "", err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	t, err := json.Marshal(tags)
+	if err != nil {
+		return "", "", "", err
+	}
+	return string(f), string(s), string(t), nil
+}
+
+// decodeJSON - Decode a nullable JSON column, leaving v alone for NULL
+func decodeJSON(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// queryer - Common interface of *sql.DB and *sql.Tx for reads
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadVariants - Variants matching the WHERE clause, grouped by product ID
+func loadVariants(ctx context.Context, db queryer, where string, args ...interface{}) (map[string][]models.ProductVariant, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, product_id, sku, options, price, stock, images FROM product_variants `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make(map[string][]models.ProductVariant)
+	for rows.Next() {
+		var v models.ProductVariant
+		var options []byte
+		var images []byte
+		var price sql.NullInt64
+		if err := rows.Scan(&v.ID, &v.ProductID, &v.SKU, &options, &price, &v.Stock, &images); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(options, &v.Options); err != nil {
+			return nil, err
+		}
+		v.Images = []string{}
+		if len(images) > 0 {
+			if err := json.Unmarshal(images, &v.Images); err != nil {
+				return nil, err
+			}
+		}
+		if price.Valid {
+			override := int(price.Int64)
+			v.PriceOverride = &override
+		}
+		variants[v.ProductID] = append(variants[v.ProductID], v)
+	}
+
+	return variants, rows.Err()
+}
+
+// encodeVariant - JSON columns of a variant
+func encodeVariant(v models.ProductVariant) (string, string, error) {
+	options, err := json.Marshal(v.Options)
+	if err != nil {
+		return "", "", err
+	}
+	if v.Images == nil {
+		v.Images = []string{}
+	}
+	images, err := json.Marshal(v.Images)
+	if err != nil {
+		return "", "", err
+	}
+	return string(options), string(images), nil
+}
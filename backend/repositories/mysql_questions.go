@@ -0,0 +1,341 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLQuestionRepository - QuestionRepository backed by the
+// product_questions, question_answers and vote tables
+type MySQLQuestionRepository struct {
+	db *sql.DB
+}
+
+// questionSortClauses - ORDER BY for each whitelisted question sort
+var questionSortClauses = map[string]string{
+	QuestionSortVotes:  "(q.upvotes - q.downvotes) DESC, q.created_at DESC, q.id DESC",
+	QuestionSortNewest: "q.created_at DESC, q.id DESC",
+}
+
+// qaTable - A votable Q&A table and the table holding its votes
+type qaTable struct {
+	items string
+	votes string
+	key   string
+}
+
+var (
+	questionTable = qaTable{items: "product_questions", votes: "question_votes", key: "question_id"}
+	answerTable   = qaTable{items: "question_answers", votes: "answer_votes", key: "answer_id"}
+)
+
+const (
+	questionColumns = `q.id, q.product_id, q.user_id, u.name, q.body, q.status, q.upvotes, q.downvotes, q.created_at`
+	answerColumns   = `a.id, a.question_id, q.product_id, a.user_id, u.name, a.body, a.status, a.is_staff, a.is_verified_buyer,
+                       a.upvotes, a.downvotes, a.created_at`
+	answerJoins = ` FROM question_answers a JOIN product_questions q ON q.id = a.question_id JOIN users u ON u.id = a.user_id`
+)
+
+func (r *MySQLQuestionRepository) ListQuestions(ctx context.Context, filter QuestionFilter) ([]models.Question, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.ProductID != "" {
+		conditions = append(conditions, "q.product_id = ?")
+		args = append(args, filter.ProductID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "q.status = ?")
+		args = append(args, filter.Status)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_questions q`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orderBy, ok := questionSortClauses[filter.Sort]
+	if !ok {
+		orderBy = questionSortClauses[QuestionSortVotes]
+	}
+	query := `SELECT ` + questionColumns + ` FROM product_questions q JOIN users u ON u.id = q.user_id` + where +
+		` ORDER BY ` + orderBy
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	questions := []models.Question{}
+	ids := []int{}
+	for rows.Next() {
+		question, err := scanQuestion(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		questions = append(questions, question)
+		ids = append(ids, question.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	answers, err := r.loadAnswers(ctx, ids, filter.AnswerStatus)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range questions {
+		if a, ok := answers[questions[i].ID]; ok {
+			questions[i].Answers = a
+		}
+	}
+
+	return questions, total, nil
+}
+
+func (r *MySQLQuestionRepository) GetQuestion(ctx context.Context, productID string, id int) (models.Question, error) {
+	query := `SELECT ` + questionColumns + ` FROM product_questions q JOIN users u ON u.id = q.user_id
+              WHERE q.id = ? AND q.product_id = ?`
+	question, err := scanQuestion(r.db.QueryRowContext(ctx, query, id, productID))
+	if err == sql.ErrNoRows {
+		return question, ErrNotFound
+	}
+	return question, err
+}
+
+func (r *MySQLQuestionRepository) CreateQuestion(ctx context.Context, question *models.Question) error {
+	question.CreatedAt = time.Now()
+	query := `INSERT INTO product_questions (product_id, user_id, body, status, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, question.ProductID, question.UserID, question.Body, question.Status, question.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	question.ID = int(id)
+	return nil
+}
+
+func (r *MySQLQuestionRepository) SetQuestionStatus(ctx context.Context, id int, status string) error {
+	return r.setStatus(ctx, questionTable, id, status)
+}
+
+func (r *MySQLQuestionRepository) VoteQuestion(ctx context.Context, id, userID, value int) (models.VoteTally, error) {
+	return r.vote(ctx, questionTable, id, userID, value)
+}
+
+func (r *MySQLQuestionRepository) ListAnswers(ctx context.Context, filter AnswerFilter) ([]models.Answer, int, error) {
+	where := ""
+	args := []interface{}{}
+	if filter.Status != "" {
+		where = " WHERE a.status = ?"
+		args = append(args, filter.Status)
+	}
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM question_answers a`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + answerColumns + answerJoins + where + ` ORDER BY a.created_at DESC, a.id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	answers := []models.Answer{}
+	for rows.Next() {
+		answer, err := scanAnswer(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		answers = append(answers, answer)
+	}
+
+	return answers, total, rows.Err()
+}
+
+func (r *MySQLQuestionRepository) GetAnswer(ctx context.Context, questionID, id int) (models.Answer, error) {
+	query := `SELECT ` + answerColumns + answerJoins + ` WHERE a.id = ? AND a.question_id = ?`
+	answer, err := scanAnswer(r.db.QueryRowContext(ctx, query, id, questionID))
+	if err == sql.ErrNoRows {
+		return answer, ErrNotFound
+	}
+	return answer, err
+}
+
+func (r *MySQLQuestionRepository) CreateAnswer(ctx context.Context, answer *models.Answer) error {
+	answer.CreatedAt = time.Now()
+	query := `INSERT INTO question_answers (question_id, user_id, body, status, is_staff, is_verified_buyer, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, answer.QuestionID, answer.UserID, answer.Body, answer.Status,
+		answer.IsStaff, answer.IsVerifiedBuyer, answer.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	answer.ID = int(id)
+	return nil
+}
+
+func (r *MySQLQuestionRepository) SetAnswerStatus(ctx context.Context, id int, status string) error {
+	return r.setStatus(ctx, answerTable, id, status)
+}
+
+func (r *MySQLQuestionRepository) VoteAnswer(ctx context.Context, id, userID, value int) (models.VoteTally, error) {
+	return r.vote(ctx, answerTable, id, userID, value)
+}
+
+// loadAnswers - Answers with the status (any when empty), grouped by
+// question ID, staff answers first, then by score
+func (r *MySQLQuestionRepository) loadAnswers(ctx context.Context, questionIDs []int, status string) (map[int][]models.Answer, error) {
+	answers := make(map[int][]models.Answer)
+	if len(questionIDs) == 0 {
+		return answers, nil
+	}
+
+	query := `SELECT ` + answerColumns + answerJoins + ` WHERE a.question_id IN (` + placeholders(len(questionIDs)) + `)`
+	args := intArgs(questionIDs)
+	if status != "" {
+		query += ` AND a.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY a.is_staff DESC, (a.upvotes - a.downvotes) DESC, a.created_at, a.id`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		answer, err := scanAnswer(rows)
+		if err != nil {
+			return nil, err
+		}
+		answers[answer.QuestionID] = append(answers[answer.QuestionID], answer)
+	}
+
+	return answers, rows.Err()
+}
+
+func (r *MySQLQuestionRepository) setStatus(ctx context.Context, table qaTable, id int, status string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE `+table.items+` SET status = ? WHERE id = ?`, status, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		return nil
+	}
+
+	// Setting the current status again changes no rows either
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM `+table.items+` WHERE id = ?`, id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *MySQLQuestionRepository) vote(ctx context.Context, table qaTable, id, userID, value int) (models.VoteTally, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.VoteTally{}, err
+	}
+	defer tx.Rollback()
+
+	tally := models.VoteTally{ID: id, Vote: value}
+	query := `SELECT upvotes, downvotes FROM ` + table.items + ` WHERE id = ? FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&tally.Upvotes, &tally.Downvotes)
+	if err == sql.ErrNoRows {
+		return models.VoteTally{}, ErrNotFound
+	}
+	if err != nil {
+		return models.VoteTally{}, err
+	}
+
+	var previous int
+	query = `SELECT value FROM ` + table.votes + ` WHERE ` + table.key + ` = ? AND user_id = ?`
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return models.VoteTally{}, err
+	}
+	if previous == value {
+		tally.Score = tally.Upvotes - tally.Downvotes
+		return tally, tx.Commit()
+	}
+
+	if value == 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+table.votes+` WHERE `+table.key+` = ? AND user_id = ?`, id, userID)
+	} else {
+		_, err = tx.ExecContext(ctx, `INSERT INTO `+table.votes+` (`+table.key+`, user_id, value) VALUES (?, ?, ?)
+                                      ON DUPLICATE KEY UPDATE value = VALUES(value)`, id, userID, value)
+	}
+	if err != nil {
+		return models.VoteTally{}, err
+	}
+
+	countVote(&tally, previous, -1)
+	countVote(&tally, value, 1)
+	_, err = tx.ExecContext(ctx, `UPDATE `+table.items+` SET upvotes = ?, downvotes = ? WHERE id = ?`,
+		tally.Upvotes, tally.Downvotes, id)
+	if err != nil {
+		return models.VoteTally{}, err
+	}
+
+	return tally, tx.Commit()
+}
+
+// countVote - Add (delta 1) or take back (delta -1) a vote in the tally
+func countVote(tally *models.VoteTally, value, delta int) {
+	switch value {
+	case 1:
+		tally.Upvotes += delta
+	case -1:
+		tally.Downvotes += delta
+	}
+	tally.Score = tally.Upvotes - tally.Downvotes
+}
+
+func scanQuestion(row scanner) (models.Question, error) {
+	question := models.Question{Answers: []models.Answer{}}
+	err := row.Scan(&question.ID, &question.ProductID, &question.UserID, &question.UserName, &question.Body, &question.Status,
+		&question.Upvotes, &question.Downvotes, &question.CreatedAt)
+	question.Score = question.Upvotes - question.Downvotes
+	return question, err
+}
+
+func scanAnswer(row scanner) (models.Answer, error) {
+	var answer models.Answer
+	err := row.Scan(&answer.ID, &answer.QuestionID, &answer.ProductID, &answer.UserID, &answer.UserName, &answer.Body,
+		&answer.Status, &answer.IsStaff, &answer.IsVerifiedBuyer, &answer.Upvotes, &answer.Downvotes, &answer.CreatedAt)
+	answer.Score = answer.Upvotes - answer.Downvotes
+	return answer, err
+}
@@ -0,0 +1,268 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLReviewRepository - ReviewRepository backed by the product_reviews and
+// review_votes tables
+type MySQLReviewRepository struct {
+	db *sql.DB
+}
+
+// reviewSortClauses - ORDER BY for each whitelisted review sort
+var reviewSortClauses = map[string]string{
+	ReviewSortNewest:  "r.created_at DESC, r.id DESC",
+	ReviewSortHelpful: "r.helpful_count DESC, r.created_at DESC, r.id DESC",
+	ReviewSortHighest: "r.rating DESC, r.created_at DESC, r.id DESC",
+	ReviewSortLowest:  "r.rating ASC, r.created_at DESC, r.id DESC",
+}
+
+// storedReviewImage - A review image as kept in the images JSON column,
+// storage key included
+type storedReviewImage struct {
+	Key        string            `json:"key"`
+	URL        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails"`
+}
+
+const reviewColumns = `r.id, r.product_id, r.user_id, u.name, r.rating, r.body, r.images, r.helpful_count, r.created_at`
+
+func (r *MySQLReviewRepository) List(ctx context.Context, filter ReviewFilter) ([]models.Review, int, error) {
+	conditions := []string{"r.product_id = ?"}
+	args := []interface{}{filter.ProductID}
+	if filter.Stars > 0 {
+		conditions = append(conditions, "r.rating = ?")
+		args = append(args, filter.Stars)
+	}
+	if filter.WithImages {
+		conditions = append(conditions, "JSON_LENGTH(r.images) > 0")
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_reviews r`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orderBy, ok := reviewSortClauses[filter.Sort]
+	if !ok {
+		orderBy = reviewSortClauses[ReviewSortNewest]
+	}
+	query := `SELECT ` + reviewColumns + ` FROM product_reviews r JOIN users u ON u.id = r.user_id` + where +
+		` ORDER BY ` + orderBy
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, total, rows.Err()
+}
+
+func (r *MySQLReviewRepository) Summary(ctx context.Context, productID string) (models.RatingSummary, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT rating, COUNT(*) FROM product_reviews WHERE product_id = ? GROUP BY rating`, productID)
+	if err != nil {
+		return models.RatingSummary{}, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var stars, count int
+		if err := rows.Scan(&stars, &count); err != nil {
+			return models.RatingSummary{}, err
+		}
+		counts[stars] = count
+	}
+	if err := rows.Err(); err != nil {
+		return models.RatingSummary{}, err
+	}
+
+	return models.NewRatingSummary(counts), nil
+}
+
+func (r *MySQLReviewRepository) GetByID(ctx context.Context, productID string, id int) (models.Review, error) {
+	return getReview(ctx, r.db, productID, id)
+}
+
+func (r *MySQLReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	images, err := encodeReviewImages(review.Images)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the product serializes the rating recomputation
+	if err := lockProduct(ctx, tx, review.ProductID); err != nil {
+		return err
+	}
+
+	review.CreatedAt = time.Now()
+	query := `INSERT INTO product_reviews (product_id, user_id, rating, body, images, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, review.ProductID, review.UserID, review.Rating, review.Body, images, review.CreatedAt)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	review.ID = int(id)
+
+	if err := updateProductRating(ctx, tx, review.ProductID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *MySQLReviewRepository) Delete(ctx context.Context, productID string, id int) (models.Review, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Review{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return models.Review{}, err
+	}
+	review, err := getReview(ctx, tx, productID, id)
+	if err != nil {
+		return review, err
+	}
+
+	// Votes go with the review through ON DELETE CASCADE
+	_, err = tx.ExecContext(ctx, `DELETE FROM product_reviews WHERE id = ?`, id)
+	if err != nil {
+		return review, err
+	}
+	if err := updateProductRating(ctx, tx, productID); err != nil {
+		return review, err
+	}
+
+	return review, tx.Commit()
+}
+
+func (r *MySQLReviewRepository) SetHelpful(ctx context.Context, reviewID, userID int, helpful bool) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT helpful_count FROM product_reviews WHERE id = ? FOR UPDATE`, reviewID).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var result sql.Result
+	if helpful {
+		result, err = tx.ExecContext(ctx, `INSERT IGNORE INTO review_votes (review_id, user_id) VALUES (?, ?)`, reviewID, userID)
+	} else {
+		result, err = tx.ExecContext(ctx, `DELETE FROM review_votes WHERE review_id = ? AND user_id = ?`, reviewID, userID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Only a vote that was actually added or removed changes the count
+	if changed, _ := result.RowsAffected(); changed > 0 {
+		if helpful {
+			count++
+		} else {
+			count--
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE product_reviews SET helpful_count = ? WHERE id = ?`, count, reviewID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return count, tx.Commit()
+}
+
+// rowQueryer - Common interface of *sql.DB and *sql.Tx for single rows
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getReview(ctx context.Context, db rowQueryer, productID string, id int) (models.Review, error) {
+	query := `SELECT ` + reviewColumns + ` FROM product_reviews r JOIN users u ON u.id = r.user_id
+              WHERE r.id = ? AND r.product_id = ?`
+	review, err := scanReview(db.QueryRowContext(ctx, query, id, productID))
+	if err == sql.ErrNoRows {
+		return review, ErrNotFound
+	}
+	return review, err
+}
+
+// updateProductRating - Recompute the product's rating and review count
+// from its reviews
+func updateProductRating(ctx context.Context, tx *sql.Tx, productID string) error {
+	query := `UPDATE products p
+              SET p.rating = (SELECT COALESCE(ROUND(AVG(r.rating), 2), 0) FROM product_reviews r WHERE r.product_id = p.id),
+                  p.review_count = (SELECT COUNT(*) FROM product_reviews r WHERE r.product_id = p.id)
+              WHERE p.id = ?`
+	_, err := tx.ExecContext(ctx, query, productID)
+	return err
+}
+
+func scanReview(row scanner) (models.Review, error) {
+	var review models.Review
+	var images []byte
+	err := row.Scan(&review.ID, &review.ProductID, &review.UserID, &review.UserName, &review.Rating, &review.Body,
+		&images, &review.HelpfulCount, &review.CreatedAt)
+	if err != nil {
+		return review, err
+	}
+
+	var stored []storedReviewImage
+	if err := decodeJSON(images, &stored); err != nil {
+		return review, err
+	}
+	review.Images = []models.ReviewImage{}
+	for _, image := range stored {
+		review.Images = append(review.Images, models.ReviewImage(image))
+	}
+	return review, nil
+}
+
+func encodeReviewImages(images []models.ReviewImage) (string, error) {
+	stored := []storedReviewImage{}
+	for _, image := range images {
+		stored = append(stored, storedReviewImage(image))
+	}
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLTokenRepository - TokenRepository backed by the refresh_tokens table
+type MySQLTokenRepository struct {
+	db *sql.DB
+}
+
+func (r *MySQLTokenRepository) Create(ctx context.Context, token models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES (?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query, token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt)
+	return err
+}
+
+func (r *MySQLTokenRepository) Rotate(ctx context.Context, oldHash string, next models.RefreshToken) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var tokenID int
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	query := `SELECT id, user_id, family_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ? FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, oldHash).Scan(&tokenID, &next.UserID, &next.FamilyID, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if revokedAt.Valid {
+		_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = ? AND revoked_at IS NULL`, next.FamilyID)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, ErrTokenRevoked
+	}
+
+	if time.Now().After(expiresAt) {
+		return 0, ErrTokenExpired
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = ?`, tokenID)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES (?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, next.UserID, next.TokenHash, next.FamilyID, next.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return next.UserID, tx.Commit()
+}
+
+func (r *MySQLTokenRepository) RevokeFamily(ctx context.Context, hash string) error {
+	// Revoke the whole session, not just the presented token
+	query := `UPDATE refresh_tokens t
+              JOIN refresh_tokens s ON s.family_id = t.family_id
+              SET t.revoked_at = NOW()
+              WHERE s.token_hash = ? AND t.revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, hash)
+	return err
+}
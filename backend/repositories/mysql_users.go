@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQLUserRepository - UserRepository backed by the users table
+type MySQLUserRepository struct {
+	db *sql.DB
+}
+
+func (r *MySQLUserRepository) List(ctx context.Context) ([]models.User, error) {
+	query := `SELECT id, name, email, balance, is_member, role, created_at FROM users ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Balance, &user.IsMember, &user.Role, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *MySQLUserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	query := `SELECT id, name, email, balance, is_member, role, created_at FROM users WHERE id = ?`
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Name, &user.Email, &user.Balance, &user.IsMember, &user.Role, &user.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *MySQLUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	query := `SELECT id, name, email, COALESCE(password_hash, ''), balance, is_member, role, created_at FROM users WHERE email = ?`
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Balance, &user.IsMember, &user.Role, &user.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *MySQLUserRepository) Create(ctx context.Context, user *models.User) error {
+	var passwordHash interface{}
+	if user.PasswordHash != "" {
+		passwordHash = user.PasswordHash
+	}
+
+	query := `INSERT INTO users (name, email, password_hash, balance, is_member, role) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, user.Name, user.Email, passwordHash, user.Balance, user.IsMember, user.Role)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	user.ID = int(id)
+	user.CreatedAt = time.Now()
+	return nil
+}
+
+func (r *MySQLUserRepository) UpdateName(ctx context.Context, id int, name string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE users SET name = ? WHERE id = ?`, name, id)
+	if err != nil {
+		return err
+	}
+	return r.checkUpdated(ctx, result, id)
+}
+
+func (r *MySQLUserRepository) AdminUpdate(ctx context.Context, id int, req models.AdminUserUpdateRequest) error {
+	// NULL keeps the current value of fields left out
+	query := `UPDATE users
+              SET name = COALESCE(?, name), balance = COALESCE(?, balance), is_member = COALESCE(?, is_member),
+                  role = COALESCE(?, role)
+              WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, req.Name, req.Balance, req.IsMember, req.Role, id)
+	if err != nil {
+		return err
+	}
+	return r.checkUpdated(ctx, result, id)
+}
+
+func (r *MySQLUserRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// checkUpdated - MySQL reports 0 affected rows when an UPDATE changes nothing,
+// so double check the row before answering ErrNotFound
+func (r *MySQLUserRepository) checkUpdated(ctx context.Context, result sql.Result, id int) error {
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var exists int
+	err := r.db.QueryRowContext(ctx, `SELECT 1 FROM users WHERE id = ?`, id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isDuplicateKey - Check for a MySQL unique constraint violation
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// isForeignKeyViolation - Check for an insert referencing a missing parent row
+func isForeignKeyViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1452
+}
+
+// isReferencedRow - Check for a delete of a row other rows still reference
+func isReferencedRow(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1451
+}
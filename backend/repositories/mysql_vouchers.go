@@ -0,0 +1,191 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLVoucherRepository - VoucherRepository backed by the vouchers,
+// voucher_claims and voucher_redemptions tables
+type MySQLVoucherRepository struct {
+	db *sql.DB
+}
+
+// voucherColumns - Columns of vouchers v read by scanVoucher. Both
+// placeholders take the user the voucher is loaded for.
+const voucherColumns = `v.id, v.code, v.name, v.type, v.value, v.max_discount, v.min_purchase, v.starts_at, v.expires_at,
+                        v.usage_limit, v.per_user_limit, v.used_count, COALESCE(v.terms, ''), v.is_public, v.is_active, v.created_at,
+                        EXISTS (SELECT 1 FROM voucher_claims vc WHERE vc.voucher_id = v.id AND vc.user_id = ?),
+                        (SELECT COUNT(*) FROM voucher_redemptions vr WHERE vr.voucher_id = v.id AND vr.user_id = ?)`
+
+func (r *MySQLVoucherRepository) List(ctx context.Context, filter VoucherFilter) ([]models.Voucher, error) {
+	args := []interface{}{filter.UserID, filter.UserID}
+	var conditions []string
+
+	if filter.Claimed {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM voucher_claims vc WHERE vc.voucher_id = v.id AND vc.user_id = ?)`)
+		args = append(args, filter.UserID)
+	}
+	if filter.Public {
+		conditions = append(conditions, `v.is_public`)
+	}
+	if filter.Current {
+		conditions = append(conditions, `v.is_active AND v.expires_at > ?`)
+		args = append(args, time.Now())
+	}
+	if filter.Query != "" {
+		searchPattern := containsPattern(filter.Query)
+		conditions = append(conditions, `(v.code LIKE ? ESCAPE '\\' OR v.name LIKE ? ESCAPE '\\')`)
+		args = append(args, searchPattern, searchPattern)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+voucherColumns+` FROM vouchers v`+where+` ORDER BY v.expires_at, v.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vouchers := []models.Voucher{}
+	for rows.Next() {
+		voucher, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		vouchers = append(vouchers, voucher)
+	}
+
+	return vouchers, rows.Err()
+}
+
+func (r *MySQLVoucherRepository) GetByID(ctx context.Context, id, userID int) (models.Voucher, error) {
+	return r.get(ctx, `v.id = ?`, id, userID)
+}
+
+func (r *MySQLVoucherRepository) GetByCode(ctx context.Context, code string, userID int) (models.Voucher, error) {
+	return r.get(ctx, `v.code = ?`, code, userID)
+}
+
+func (r *MySQLVoucherRepository) get(ctx context.Context, where string, arg interface{}, userID int) (models.Voucher, error) {
+	query := `SELECT ` + voucherColumns + ` FROM vouchers v WHERE ` + where
+	voucher, err := scanVoucher(r.db.QueryRowContext(ctx, query, userID, userID, arg))
+	if err == sql.ErrNoRows {
+		return voucher, ErrNotFound
+	}
+	return voucher, err
+}
+
+func (r *MySQLVoucherRepository) Create(ctx context.Context, voucher *models.Voucher) error {
+	query := `INSERT INTO vouchers (code, name, type, value, max_discount, min_purchase, starts_at, expires_at,
+                                    usage_limit, per_user_limit, terms, is_public, is_active)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, voucher.Code, voucher.Name, voucher.Type, voucher.Value,
+		voucher.MaxDiscount, voucher.MinPurchase, voucher.StartsAt, voucher.ExpiresAt, voucher.UsageLimit,
+		voucher.PerUserLimit, nullString(voucher.Terms), voucher.IsPublic, voucher.IsActive)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	voucher.ID = int(id)
+	voucher.UsedCount = 0
+	voucher.CreatedAt = time.Now()
+	return nil
+}
+
+func (r *MySQLVoucherRepository) Update(ctx context.Context, voucher models.Voucher) error {
+	query := `UPDATE vouchers
+              SET code = ?, name = ?, type = ?, value = ?, max_discount = ?, min_purchase = ?, starts_at = ?,
+                  expires_at = ?, usage_limit = ?, per_user_limit = ?, terms = ?, is_public = ?, is_active = ?
+              WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, voucher.Code, voucher.Name, voucher.Type, voucher.Value,
+		voucher.MaxDiscount, voucher.MinPurchase, voucher.StartsAt, voucher.ExpiresAt, voucher.UsageLimit,
+		voucher.PerUserLimit, nullString(voucher.Terms), voucher.IsPublic, voucher.IsActive, voucher.ID)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing changed or nothing there
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM vouchers WHERE id = ?`, voucher.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *MySQLVoucherRepository) Delete(ctx context.Context, id int) error {
+	// Redemptions reference the row, so the foreign key refuses the delete
+	// once the voucher has been used
+	result, err := r.db.ExecContext(ctx, `DELETE FROM vouchers WHERE id = ?`, id)
+	if isReferencedRow(err) {
+		return ErrInUse
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MySQLVoucherRepository) Claim(ctx context.Context, id, userID int) error {
+	_, err := r.db.ExecContext(ctx, `INSERT IGNORE INTO voucher_claims (voucher_id, user_id) VALUES (?, ?)`, id, userID)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// lockVoucher - Lock the voucher with the code, loaded for the user, until
+// the transaction ends. Returns *VoucherError when there is none; checking
+// it is left to the pricing engine.
+func lockVoucher(ctx context.Context, tx *sql.Tx, code string, userID int) (models.Voucher, error) {
+	query := `SELECT ` + voucherColumns + ` FROM vouchers v WHERE v.code = ? FOR UPDATE`
+	voucher, err := scanVoucher(tx.QueryRowContext(ctx, query, userID, userID, code))
+	if err == sql.ErrNoRows {
+		return voucher, &VoucherError{Reason: models.VoucherReasonNotFound}
+	}
+	return voucher, err
+}
+
+// redeemVoucher - Record the use of the locked voucher by the order
+func redeemVoucher(ctx context.Context, tx *sql.Tx, voucherID int, order models.Order) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO voucher_redemptions (voucher_id, user_id, order_id, discount) VALUES (?, ?, ?, ?)`,
+		voucherID, order.CustomerID, order.ID, order.VoucherDiscount+order.ShippingDiscount)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE vouchers SET used_count = used_count + 1 WHERE id = ?`, voucherID)
+	return err
+}
+
+func scanVoucher(row scanner) (models.Voucher, error) {
+	var v models.Voucher
+	err := row.Scan(&v.ID, &v.Code, &v.Name, &v.Type, &v.Value, &v.MaxDiscount, &v.MinPurchase, &v.StartsAt, &v.ExpiresAt,
+		&v.UsageLimit, &v.PerUserLimit, &v.UsedCount, &v.Terms, &v.IsPublic, &v.IsActive, &v.CreatedAt,
+		&v.Claimed, &v.UserUses)
+	return v, err
+}
@@ -0,0 +1,245 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+)
+
+// MySQLWishlistRepository - WishlistRepository backed by the wishlist_items
+// table
+type MySQLWishlistRepository struct {
+	db *sql.DB
+}
+
+// wishlistItemColumns - Columns of wishlist_items w, products p and
+// product_variants v read by scanWishlistItem
+const wishlistItemColumns = `w.id, w.product_id, p.name, ` + productCover + `, COALESCE(w.variant_id, 0), v.options,
+                             w.saved_price, w.created_at, COALESCE(v.price, p.price),
+                             IF(w.variant_id IS NULL, p.stock, v.stock),
+                             w.variant_id IS NULL AND EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id)`
+
+func (r *MySQLWishlistRepository) Items(ctx context.Context, userID int) ([]models.WishlistItem, error) {
+	return loadWishlistItems(ctx, r.db, `w.user_id = ?`, userID)
+}
+
+// loadWishlistItems - Lines of wishlist_items w matching the WHERE clause,
+// newest first
+func loadWishlistItems(ctx context.Context, db queryer, where string, args ...interface{}) ([]models.WishlistItem, error) {
+	query := `SELECT ` + wishlistItemColumns + `
+              FROM wishlist_items w
+              JOIN products p ON p.id = w.product_id
+              LEFT JOIN product_variants v ON v.id = w.variant_id
+              WHERE ` + where + `
+              ORDER BY w.created_at DESC, w.id DESC`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.WishlistItem{}
+	for rows.Next() {
+		var item models.WishlistItem
+		var options []byte
+		err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Image, &item.VariantID, &options,
+			&item.SavedPrice, &item.AddedAt, &item.Price, &item.Stock, &item.NeedsVariant)
+		if err != nil {
+			return nil, err
+		}
+
+		var variant models.ProductVariant
+		if err := decodeJSON(options, &variant.Options); err != nil {
+			return nil, err
+		}
+		item.VariantLabel = variant.Label()
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *MySQLWishlistRepository) AddItem(ctx context.Context, userID int, item models.WishlistItem) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockWishlist(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+	id, err := addWishlistLine(ctx, tx, userID, item)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *MySQLWishlistRepository) DeleteItems(ctx context.Context, userID int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `DELETE FROM wishlist_items WHERE user_id = ? AND id IN (` + placeholders(len(ids)) + `)`
+	_, err := r.db.ExecContext(ctx, query, append([]interface{}{userID}, intArgs(ids)...)...)
+	return err
+}
+
+func (r *MySQLWishlistRepository) DeleteProduct(ctx context.Context, userID int, productID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM wishlist_items WHERE user_id = ? AND product_id = ?`, userID, productID)
+	return err
+}
+
+func (r *MySQLWishlistRepository) MoveFromCart(ctx context.Context, userID int, cartItemIDs []int) (int, error) {
+	if len(cartItemIDs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cartID, err := lockCart(ctx, tx, CartOwner{UserID: userID})
+	if err != nil {
+		return 0, err
+	}
+	if err := lockWishlist(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+
+	where := `c.id = ? AND ci.id IN (` + placeholders(len(cartItemIDs)) + `)`
+	lines, err := loadCartItems(ctx, tx, where, append([]interface{}{cartID}, intArgs(cartItemIDs)...)...)
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, len(lines))
+	for i, line := range lines {
+		_, err := addWishlistLine(ctx, tx, userID, models.WishlistItem{
+			ProductID:  line.ProductID,
+			VariantID:  line.VariantID,
+			SavedPrice: line.Price,
+		})
+		if err != nil {
+			return 0, err
+		}
+		ids[i] = line.ID
+	}
+
+	query := `DELETE FROM cart_items WHERE cart_id = ? AND id IN (` + placeholders(len(ids)) + `)`
+	if _, err := tx.ExecContext(ctx, query, append([]interface{}{cartID}, intArgs(ids)...)...); err != nil {
+		return 0, err
+	}
+	return len(ids), tx.Commit()
+}
+
+func (r *MySQLWishlistRepository) MoveToCart(ctx context.Context, userID int, ids []int, maxQuantity int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cartID, err := lockCart(ctx, tx, CartOwner{UserID: userID})
+	if err != nil {
+		return 0, err
+	}
+	if err := lockWishlist(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+
+	where := `w.user_id = ? AND w.id IN (` + placeholders(len(ids)) + `)`
+	lines, err := loadWishlistItems(ctx, tx, where, append([]interface{}{userID}, intArgs(ids)...)...)
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	saved, err := loadCartItems(ctx, tx, `c.id = ?`, cartID)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := make([]int, len(lines))
+	for i, line := range lines {
+		match := findCartLine(saved, line.ProductID, line.VariantID)
+		merged := mergeCartLine(match, wishlistCartLine(line), maxQuantity)
+		if match.ID == 0 {
+			_, err = addCartLine(ctx, tx, cartID, merged)
+		} else {
+			query := `UPDATE cart_items SET quantity = ?, selected = TRUE, price = ? WHERE id = ?`
+			_, err = tx.ExecContext(ctx, query, merged.Quantity, merged.PreviousPrice, match.ID)
+		}
+		if err != nil {
+			return 0, err
+		}
+		moved[i] = line.ID
+	}
+
+	query := `DELETE FROM wishlist_items WHERE user_id = ? AND id IN (` + placeholders(len(moved)) + `)`
+	if _, err := tx.ExecContext(ctx, query, append([]interface{}{userID}, intArgs(moved)...)...); err != nil {
+		return 0, err
+	}
+	return len(moved), tx.Commit()
+}
+
+// wishlistCartLine - One unit of the wishlist line as a cart line at its
+// current price, ready for mergeCartLine. Shared with the memory
+// implementation.
+func wishlistCartLine(line models.WishlistItem) models.CartItem {
+	return models.CartItem{
+		ProductID:     line.ProductID,
+		VariantID:     line.VariantID,
+		Quantity:      1,
+		PreviousPrice: line.Price,
+		Price:         line.Price,
+		Stock:         line.Stock,
+	}
+}
+
+// lockWishlist - Lock the user's row until the transaction ends, which keeps
+// one wishlist line per product and variant
+func lockWishlist(ctx context.Context, tx *sql.Tx, userID int) error {
+	var id int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = ? FOR UPDATE`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// addWishlistLine - Save the item in the locked wishlist as AddItem
+// describes
+func addWishlistLine(ctx context.Context, tx *sql.Tx, userID int, item models.WishlistItem) (int, error) {
+	var id int
+	query := `SELECT id FROM wishlist_items WHERE user_id = ? AND product_id = ? AND variant_id <=> ?`
+	err := tx.QueryRowContext(ctx, query, userID, item.ProductID, nullInt(item.VariantID)).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	query = `INSERT INTO wishlist_items (user_id, product_id, variant_id, saved_price, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, userID, item.ProductID, nullInt(item.VariantID), item.SavedPrice, time.Now())
+	if isForeignKeyViolation(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	lastID, _ := result.LastInsertId()
+	return int(lastID), nil
+}
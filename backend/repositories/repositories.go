@@ -0,0 +1,637 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+)
+
+// Errors shared by every implementation so controllers can map them onto
+// HTTP statuses without knowing which storage is behind the interface
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrDuplicate    = errors.New("already exists")
+	ErrInUse        = errors.New("still in use")
+	ErrTokenRevoked = errors.New("refresh token has been revoked")
+	ErrTokenExpired = errors.New("refresh token has expired")
+	// ErrCheckoutClosed - The checkout session has already become an order
+	ErrCheckoutClosed = errors.New("checkout is no longer open")
+	// ErrInsufficientBalance - The customer's balance does not cover the order
+	ErrInsufficientBalance = errors.New("balance does not cover the order")
+	// ErrRepriced - An item's price is no longer the one the customer
+	// accepted
+	ErrRepriced = errors.New("item prices have changed")
+)
+
+// StockError - Order items that reference unknown products or variants,
+// leave out the variant of a product that has variants, or exceed the stock
+type StockError struct {
+	Missing         []string
+	MissingVariants []int
+	NeedsVariant    []string
+	Shortages       []models.StockShortage
+}
+
+func (e *StockError) Error() string {
+	return fmt.Sprintf("%d unknown products, %d unknown variants, %d items without a variant, %d items short on stock",
+		len(e.Missing), len(e.MissingVariants), len(e.NeedsVariant), len(e.Shortages))
+}
+
+// TransitionError - Status change rejected by the order state machine
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Cannot change order status from %s to %s", e.From, e.To)
+}
+
+// VoucherError - Voucher that cannot be used for an order. Reason is one of
+// the models.VoucherReason values; Voucher is empty when none has the code.
+type VoucherError struct {
+	Reason   string
+	Voucher  models.Voucher
+	Subtotal int
+}
+
+func (e *VoucherError) Error() string {
+	return "voucher cannot be used: " + e.Reason
+}
+
+// OrderFilter - Criteria for listing orders. Zero values mean "no filter".
+type OrderFilter struct {
+	CustomerID int
+	Statuses   []string
+	Since      time.Time
+	Query      string
+}
+
+// Product sort orders accepted by ProductFilter.Sort
+const (
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortPopular   = "popular"
+	SortRating    = "rating"
+)
+
+// ProductSorts - Whitelist of sort orders, anything else is rejected
+var ProductSorts = []string{SortNewest, SortPriceAsc, SortPriceDesc, SortPopular, SortRating}
+
+// ProductFilter - Criteria for the product listing. Zero values mean "no
+// filter". CategoryIDs usually holds a category and its descendants.
+type ProductFilter struct {
+	CategoryIDs []int
+	Brands      []string
+	MinPrice    int
+	MaxPrice    int
+	MinRating   float64
+	InStock     bool
+	Sort        string
+	Limit       int
+	Offset      int
+}
+
+// Review sort orders accepted by ReviewFilter.Sort
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortHelpful = "helpful"
+	ReviewSortHighest = "highest"
+	ReviewSortLowest  = "lowest"
+)
+
+// ReviewSorts - Whitelist of review sort orders
+var ReviewSorts = []string{ReviewSortNewest, ReviewSortHelpful, ReviewSortHighest, ReviewSortLowest}
+
+// ReviewFilter - Criteria for listing a product's reviews. Zero values
+// mean "no filter".
+type ReviewFilter struct {
+	ProductID  string
+	Stars      int
+	WithImages bool
+	Sort       string
+	Limit      int
+	Offset     int
+}
+
+// Question sort orders accepted by QuestionFilter.Sort
+const (
+	QuestionSortVotes  = "votes"
+	QuestionSortNewest = "newest"
+)
+
+// QuestionSorts - Whitelist of question sort orders
+var QuestionSorts = []string{QuestionSortVotes, QuestionSortNewest}
+
+// QuestionFilter - Criteria for listing questions. An empty ProductID lists
+// every product's questions (the moderation queue); an empty Status or
+// AnswerStatus matches every status.
+type QuestionFilter struct {
+	ProductID    string
+	Status       string
+	AnswerStatus string
+	Sort         string
+	Limit        int
+	Offset       int
+}
+
+// AnswerFilter - Criteria for the answer moderation queue, newest first
+type AnswerFilter struct {
+	Status string
+	Limit  int
+	Offset int
+}
+
+// Voucher sort orders for the customer's voucher lists
+const (
+	VoucherSortExpiry   = "expiry"
+	VoucherSortDiscount = "discount"
+)
+
+// VoucherSorts - Whitelist of voucher sort orders
+var VoucherSorts = []string{VoucherSortExpiry, VoucherSortDiscount}
+
+// VoucherFilter - Criteria for listing vouchers. UserID fills in Claimed
+// and UserUses; zero values mean "no filter".
+type VoucherFilter struct {
+	UserID  int
+	Claimed bool   // claimed by UserID
+	Public  bool   // shown in the Available list
+	Current bool   // active and not expired
+	Query   string // part of the code or name
+}
+
+type UserRepository interface {
+	List(ctx context.Context) ([]models.User, error)
+	GetByID(ctx context.Context, id int) (models.User, error)
+	// GetByEmail - Also loads the password hash
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	// Create - Sets ID and CreatedAt, returns ErrDuplicate when the email is taken
+	Create(ctx context.Context, user *models.User) error
+	UpdateName(ctx context.Context, id int, name string) error
+	// AdminUpdate - Change the fields that are set, keeping the others
+	AdminUpdate(ctx context.Context, id int, req models.AdminUserUpdateRequest) error
+	Delete(ctx context.Context, id int) error
+}
+
+type ProductRepository interface {
+	// List - One page of matching products and the total number of matches.
+	// A zero Limit returns every match.
+	List(ctx context.Context, filter ProductFilter) ([]models.Product, int, error)
+	// GetByID - Includes the category breadcrumbs, image gallery, variants
+	// and option matrix
+	GetByID(ctx context.Context, id string) (models.Product, error)
+	// GetMany - Products with the given IDs, in no particular order; unknown
+	// IDs are skipped
+	GetMany(ctx context.Context, ids []string) ([]models.Product, error)
+	// Facets - Brands of the products matching the filter, ignoring its
+	// Brands so the other brands stay selectable, most products first
+	Facets(ctx context.Context, filter ProductFilter) (models.ProductFacets, error)
+	// Create - Returns ErrDuplicate when the ID is taken and ErrNotFound when
+	// the category does not exist
+	Create(ctx context.Context, product *models.Product) error
+	// Update - Returns ErrNotFound when the product or its category does not
+	// exist
+	Update(ctx context.Context, id string, req models.ProductUpdateRequest) error
+	// Delete - Returns ErrInUse once the product has been ordered
+	Delete(ctx context.Context, id string) error
+	// CreateVariant - Sets ID. Returns ErrNotFound when the product does not
+	// exist and ErrDuplicate when the SKU is taken.
+	CreateVariant(ctx context.Context, variant *models.ProductVariant) error
+	// UpdateVariant - Replace the variant identified by ID and ProductID
+	UpdateVariant(ctx context.Context, variant models.ProductVariant) error
+	DeleteVariant(ctx context.Context, productID string, variantID int) error
+}
+
+type CategoryRepository interface {
+	// List - Every category, flat, in display order
+	List(ctx context.Context) ([]models.Category, error)
+	GetByID(ctx context.Context, id int) (models.Category, error)
+	GetBySlug(ctx context.Context, slug string) (models.Category, error)
+	// Create - Sets ID and CreatedAt. Returns ErrDuplicate when the slug is
+	// taken and ErrNotFound when the parent does not exist.
+	Create(ctx context.Context, category *models.Category) error
+	// Update - Replace the category identified by ID, same errors as Create
+	Update(ctx context.Context, category models.Category) error
+	// Delete - Returns ErrInUse while the category has subcategories or
+	// products
+	Delete(ctx context.Context, id int) error
+}
+
+type ReviewRepository interface {
+	// List - One page of matching reviews and the total number of matches
+	List(ctx context.Context, filter ReviewFilter) ([]models.Review, int, error)
+	// Summary - Average rating and per-star counts of the product's reviews
+	Summary(ctx context.Context, productID string) (models.RatingSummary, error)
+	GetByID(ctx context.Context, productID string, id int) (models.Review, error)
+	// Create - Sets ID and CreatedAt and recomputes the product's rating and
+	// review count. Returns ErrDuplicate when the user already reviewed the
+	// product and ErrNotFound when the product does not exist.
+	Create(ctx context.Context, review *models.Review) error
+	// Delete - Remove the review and recompute the product's rating. Returns
+	// the deleted review so its image files can be removed.
+	Delete(ctx context.Context, productID string, id int) (models.Review, error)
+	// SetHelpful - Add or remove the user's helpful vote, returning the new
+	// count. Voting twice counts once.
+	SetHelpful(ctx context.Context, reviewID, userID int, helpful bool) (int, error)
+}
+
+type QuestionRepository interface {
+	// ListQuestions - One page of matching questions and the total number of
+	// matches. Each question carries its answers with filter.AnswerStatus,
+	// staff answers first, then by score.
+	ListQuestions(ctx context.Context, filter QuestionFilter) ([]models.Question, int, error)
+	// GetQuestion - The question without its answers
+	GetQuestion(ctx context.Context, productID string, id int) (models.Question, error)
+	// CreateQuestion - Sets ID and CreatedAt, returns ErrNotFound when the
+	// product does not exist
+	CreateQuestion(ctx context.Context, question *models.Question) error
+	SetQuestionStatus(ctx context.Context, id int, status string) error
+	// VoteQuestion - Set the user's vote (1, -1, or 0 to take it back) and
+	// return the new tally. Voting the same way twice counts once.
+	VoteQuestion(ctx context.Context, id, userID, value int) (models.VoteTally, error)
+
+	// ListAnswers - One page of matching answers across products
+	ListAnswers(ctx context.Context, filter AnswerFilter) ([]models.Answer, int, error)
+	GetAnswer(ctx context.Context, questionID, id int) (models.Answer, error)
+	// CreateAnswer - Sets ID and CreatedAt, returns ErrNotFound when the
+	// question does not exist
+	CreateAnswer(ctx context.Context, answer *models.Answer) error
+	SetAnswerStatus(ctx context.Context, id int, status string) error
+	// VoteAnswer - Same as VoteQuestion, for an answer
+	VoteAnswer(ctx context.Context, id, userID, value int) (models.VoteTally, error)
+}
+
+type ProductImageRepository interface {
+	// List - The product's gallery in display order
+	List(ctx context.Context, productID string) ([]models.ProductImage, error)
+	// Add - Append the image to the gallery, setting ID, Position and
+	// CreatedAt. The first image of a product becomes its primary image.
+	// Returns ErrNotFound when the product does not exist.
+	Add(ctx context.Context, image *models.ProductImage) error
+	// Delete - Remove the image and return it so its files can be deleted.
+	// When it was the primary image the next one takes over.
+	Delete(ctx context.Context, productID string, imageID int) (models.ProductImage, error)
+	// Reorder - ids must hold every image of the product exactly once
+	Reorder(ctx context.Context, productID string, ids []int) error
+	SetPrimary(ctx context.Context, productID string, imageID int) error
+}
+
+type OrderRepository interface {
+	// Create - Atomically checks stock, snapshots prices into the items,
+	// prices the order with the rules, decrements stock and stores the
+	// order with its first event. The order must carry its ID, customer and
+	// items (product, variant and quantity, one line per product and
+	// variant), and may carry a VoucherCode and the Shipping fee. The
+	// voucher is locked, checked for the customer and redeemed in the same
+	// transaction, so concurrent checkouts cannot spend it past its limits.
+	// An order with a CheckoutID also locks that open session of the
+	// customer, marks it placed with the order and TermsAcceptedAt and
+	// removes the cart lines it came from, so a session becomes one order
+	// at most. An order with PaymentMethod balance debits its Total from the
+	// customer's balance, records it as BalancePaid and is placed as paid.
+	// Returns *StockError when items cannot be fulfilled, *VoucherError when
+	// the voucher cannot be used, ErrCheckoutClosed when the session was
+	// already placed, ErrRepriced when an item with an AcceptedPrice now
+	// costs something else and ErrInsufficientBalance when the balance falls
+	// short.
+	Create(ctx context.Context, order *models.Order, rules pricing.Rules, actor string) error
+	// GetByID - Loads the items with product names
+	GetByID(ctx context.Context, id string) (models.Order, error)
+	// List - Matching orders, newest first, and the number of orders per
+	// status for the same filter without Statuses (for the tab badges)
+	List(ctx context.Context, filter OrderFilter) ([]models.Order, map[string]int, error)
+	Events(ctx context.Context, orderID string) ([]models.OrderEvent, error)
+	// Transition - Validates the change against the state machine, returns
+	// *TransitionError when it is not allowed. A change to cancelled or
+	// refunded has the effects of Cancel or Refund.
+	Transition(ctx context.Context, orderID, to, actor, note string) error
+	// Cancel - Transition to cancelled, restore stock, refund the balance
+	// paid and give back the voucher use, in one transaction. Returns the
+	// refunded amount.
+	Cancel(ctx context.Context, orderID, actor, note string) (int, error)
+	// Refund - Transition to refunded and refund the balance paid, in one
+	// transaction. Stock and the voucher use stay spent. Returns the
+	// refunded amount.
+	Refund(ctx context.Context, orderID, actor, note string) (int, error)
+	// ReorderLines - Items of the order priced at today's prices
+	ReorderLines(ctx context.Context, orderID string) ([]models.ReorderLine, error)
+	// Purchased - Whether the customer has a completed order containing the
+	// product
+	Purchased(ctx context.Context, customerID int, productID string) (bool, error)
+}
+
+// CartOwner - Whose cart to use: a signed in user, or a guest known by the
+// hash of their cart token. Guests without a token have an empty cart.
+type CartOwner struct {
+	UserID    int
+	TokenHash string
+}
+
+type CartRepository interface {
+	// Items - The owner's cart lines, oldest first, with the product's
+	// current name, image, price and stock. Subtotals and flags are left to
+	// models.NewCart.
+	Items(ctx context.Context, owner CartOwner) ([]models.CartItem, error)
+	// AddItem - Add the quantity to the line for the same product and
+	// variant, or start a new line; either way the line ends up selected with
+	// PreviousPrice as its price. The cart is created on first use. Returns
+	// the line ID, or ErrNotFound when the product or variant does not exist.
+	AddItem(ctx context.Context, owner CartOwner, item models.CartItem) (int, error)
+	// UpdateItem - Store the quantity, selected flag and PreviousPrice of the
+	// line identified by ID. Returns ErrNotFound when it is not in the
+	// owner's cart.
+	UpdateItem(ctx context.Context, owner CartOwner, item models.CartItem) error
+	// DeleteItems - Remove the lines, or every line when ids is empty.
+	// Lines that are not in the owner's cart are ignored.
+	DeleteItems(ctx context.Context, owner CartOwner, ids []int) error
+	// SelectItems - Set the selected flag of the lines, or of every line when
+	// ids is empty
+	SelectItems(ctx context.Context, owner CartOwner, ids []int, selected bool) error
+	// Merge - Move the guest cart into the user's cart and delete it, in one
+	// transaction. Lines for the same product and variant are combined and
+	// selected. Quantities are summed and capped at the stock and
+	// maxQuantity; an out of stock line keeps one unit and stays flagged.
+	// The line keeps whichever stored price differs from the current one,
+	// so a price change seen by either cart still shows as repriced. A
+	// missing guest cart is not an error.
+	Merge(ctx context.Context, tokenHash string, userID, maxQuantity int) error
+	// DeleteGuestCarts - Remove guest carts last changed before the time.
+	// Returns how many were removed.
+	DeleteGuestCarts(ctx context.Context, before time.Time) (int, error)
+	// VoucherID - The voucher applied to the owner's cart, 0 for none
+	VoucherID(ctx context.Context, owner CartOwner) (int, error)
+	// SetVoucher - Apply the voucher to the owner's cart, or remove it when
+	// voucherID is 0. The cart is created on first use.
+	SetVoucher(ctx context.Context, owner CartOwner, voucherID int) error
+}
+
+type VoucherRepository interface {
+	// List - Matching vouchers, soonest expiry first
+	List(ctx context.Context, filter VoucherFilter) ([]models.Voucher, error)
+	// GetByID - userID fills in Claimed and UserUses, 0 leaves them empty
+	GetByID(ctx context.Context, id, userID int) (models.Voucher, error)
+	// GetByCode - Same as GetByID, for a normalized code
+	GetByCode(ctx context.Context, code string, userID int) (models.Voucher, error)
+	// Create - Sets ID, UsedCount and CreatedAt, returns ErrDuplicate when
+	// the code is taken
+	Create(ctx context.Context, voucher *models.Voucher) error
+	// Update - Replace the voucher identified by ID, keeping its UsedCount.
+	// Returns ErrNotFound or ErrDuplicate.
+	Update(ctx context.Context, voucher models.Voucher) error
+	// Delete - Returns ErrInUse once the voucher has been redeemed;
+	// deactivate it instead
+	Delete(ctx context.Context, id int) error
+	// Claim - Save the voucher to the user's vouchers. Claiming twice is not
+	// an error. Returns ErrNotFound when the voucher does not exist.
+	Claim(ctx context.Context, id, userID int) error
+}
+
+type CheckoutRepository interface {
+	// Create - Store a new open session with its lines (the cart line in ID,
+	// product, variant, quantity and PreviousPrice as the price shown) and
+	// delete the user's other open sessions. Sets CreatedAt and the line IDs.
+	Create(ctx context.Context, checkout *models.Checkout) error
+	// Get - The user's session with its lines and the product's current
+	// name, image, price and stock. Returns ErrNotFound when the user has no
+	// such session. Step, flags and prices are left to the caller.
+	Get(ctx context.Context, id string, userID int) (models.Checkout, error)
+	// Update - Store the address, shipping and payment methods, voucher code
+	// and the PreviousPrice of each line of an open session. Returns
+	// ErrNotFound, or ErrCheckoutClosed once it was placed.
+	Update(ctx context.Context, checkout models.Checkout) error
+}
+
+type WishlistRepository interface {
+	// Items - The user's wishlist, newest first, with the product's current
+	// name, image, price and stock. Flags are left to models.NewWishlist.
+	Items(ctx context.Context, userID int) ([]models.WishlistItem, error)
+	// AddItem - Save the product and variant at SavedPrice. Saving it again
+	// keeps the first line and its price. Returns the line ID, or ErrNotFound
+	// when the product or variant does not exist.
+	AddItem(ctx context.Context, userID int, item models.WishlistItem) (int, error)
+	// DeleteItems - Remove the lines; lines that are not in the user's
+	// wishlist are ignored
+	DeleteItems(ctx context.Context, userID int, ids []int) error
+	// DeleteProduct - Remove every line of the product
+	DeleteProduct(ctx context.Context, userID int, productID string) error
+	// MoveFromCart - Save the cart lines in the wishlist at their current
+	// price and take them out of the cart, in one transaction. Lines that
+	// are not in the user's cart are ignored. Returns how many moved.
+	MoveFromCart(ctx context.Context, userID int, cartItemIDs []int) (int, error)
+	// MoveToCart - Add one unit of each line to the user's cart at its
+	// current price and take it off the wishlist, in one transaction. As in
+	// CartRepository.Merge, a line's quantity never passes maxQuantity or
+	// the stock. Lines that are not in the wishlist are ignored. Returns how
+	// many moved.
+	MoveToCart(ctx context.Context, userID int, ids []int, maxQuantity int) (int, error)
+}
+
+type AddressRepository interface {
+	// List - The user's addresses, the default first, then newest first
+	List(ctx context.Context, userID int) ([]models.Address, error)
+	// Get - Returns ErrNotFound when the user has no such address
+	Get(ctx context.Context, id, userID int) (models.Address, error)
+	// Create - Store a new address. The user's first address, or one with
+	// IsDefault, becomes the default in place of the previous one. Sets ID,
+	// IsDefault and the times.
+	Create(ctx context.Context, address *models.Address) error
+	// Update - Replace the address. IsDefault makes it the default; clearing
+	// it on the default is ignored, as another address must be made the
+	// default instead. Sets IsDefault and UpdatedAt. Returns ErrNotFound.
+	Update(ctx context.Context, address *models.Address) error
+	// Delete - Remove the address. Deleting the default hands it to the
+	// newest address left. Returns ErrNotFound.
+	Delete(ctx context.Context, id, userID int) error
+	// SetDefault - Make the address the user's only default. Returns
+	// ErrNotFound.
+	SetDefault(ctx context.Context, id, userID int) error
+}
+
+type TokenRepository interface {
+	Create(ctx context.Context, token models.RefreshToken) error
+	// Rotate - Revoke the token with oldHash and store next in the same family
+	// for the same user. Presenting an already revoked token revokes the
+	// whole family and returns ErrTokenRevoked.
+	Rotate(ctx context.Context, oldHash string, next models.RefreshToken) (int, error)
+	// RevokeFamily - Revoke every token of the session the token belongs to
+	RevokeFamily(ctx context.Context, hash string) error
+}
+
+// Repositories - Storage dependencies handed to the controllers
+type Repositories struct {
+	Users      UserRepository
+	Products   ProductRepository
+	Categories CategoryRepository
+	Images     ProductImageRepository
+	Reviews    ReviewRepository
+	Questions  QuestionRepository
+	Orders     OrderRepository
+	Carts      CartRepository
+	Wishlists  WishlistRepository
+	Vouchers   VoucherRepository
+	Checkouts  CheckoutRepository
+	Addresses  AddressRepository
+	Tokens     TokenRepository
+}
+
+// NewMySQL - Repositories backed by MySQL
+func NewMySQL(db *sql.DB) *Repositories {
+	return &Repositories{
+		Users:      &MySQLUserRepository{db: db},
+		Products:   &MySQLProductRepository{db: db},
+		Categories: &MySQLCategoryRepository{db: db},
+		Images:     &MySQLProductImageRepository{db: db},
+		Reviews:    &MySQLReviewRepository{db: db},
+		Questions:  &MySQLQuestionRepository{db: db},
+		Orders:     &MySQLOrderRepository{db: db},
+		Carts:      &MySQLCartRepository{db: db},
+		Wishlists:  &MySQLWishlistRepository{db: db},
+		Vouchers:   &MySQLVoucherRepository{db: db},
+		Checkouts:  &MySQLCheckoutRepository{db: db},
+		Addresses:  &MySQLAddressRepository{db: db},
+		Tokens:     &MySQLTokenRepository{db: db},
+	}
+}
+
+// NewMemory - Repositories kept in process memory, for running and testing
+// the API without MySQL. Data is lost when the process exits.
+func NewMemory() *Repositories {
+	store := newMemoryStore()
+	return &Repositories{
+		Users:      &MemoryUserRepository{store: store},
+		Products:   &MemoryProductRepository{store: store},
+		Categories: &MemoryCategoryRepository{store: store},
+		Images:     &MemoryProductImageRepository{store: store},
+		Reviews:    &MemoryReviewRepository{store: store},
+		Questions:  &MemoryQuestionRepository{store: store},
+		Orders:     &MemoryOrderRepository{store: store},
+		Carts:      &MemoryCartRepository{store: store},
+		Wishlists:  &MemoryWishlistRepository{store: store},
+		Vouchers:   &MemoryVoucherRepository{store: store},
+		Checkouts:  &MemoryCheckoutRepository{store: store},
+		Addresses:  &MemoryAddressRepository{store: store},
+		Tokens:     &MemoryTokenRepository{store: store},
+	}
+}
+
+// priceItems - Check the requested items against the products and their
+// variants, then fill in names, variant labels and prices. Items must be one
+// line per product and variant. Returns ErrRepriced when an item's price is
+// not its AcceptedPrice.
+func priceItems(items []models.OrderItem, products map[string]models.Product, variants map[string][]models.ProductVariant) error {
+	var stockErr StockError
+	for i := range items {
+		item := &items[i]
+		p, ok := products[item.ProductID]
+		if !ok {
+			stockErr.Missing = append(stockErr.Missing, item.ProductID)
+			continue
+		}
+
+		price, stock := p.Price, p.Stock
+		if item.VariantID == 0 && len(variants[p.ID]) > 0 {
+			stockErr.NeedsVariant = append(stockErr.NeedsVariant, p.ID)
+			continue
+		}
+		if item.VariantID != 0 {
+			v, ok := findVariant(variants[p.ID], item.VariantID)
+			if !ok {
+				stockErr.MissingVariants = append(stockErr.MissingVariants, item.VariantID)
+				continue
+			}
+			if v.PriceOverride != nil {
+				price = *v.PriceOverride
+			}
+			stock = v.Stock
+			item.VariantLabel = v.Label()
+		}
+
+		if stock < item.Quantity {
+			stockErr.Shortages = append(stockErr.Shortages, models.StockShortage{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Requested: item.Quantity,
+				Available: stock,
+			})
+		}
+		item.ProductName = p.Name
+		item.Price = price
+	}
+
+	if len(stockErr.Missing) > 0 || len(stockErr.MissingVariants) > 0 ||
+		len(stockErr.NeedsVariant) > 0 || len(stockErr.Shortages) > 0 {
+		return &stockErr
+	}
+	for _, item := range items {
+		if item.AcceptedPrice != 0 && item.Price != item.AcceptedPrice {
+			return ErrRepriced
+		}
+	}
+	return nil
+}
+
+// priceOrder - Price the priced items of the order for the customer, with
+// the voucher if any, and take the breakdown onto the order. Returns
+// *VoucherError when the voucher cannot be used.
+func priceOrder(order *models.Order, rules pricing.Rules, member bool, voucher *models.Voucher) error {
+	breakdown, applied := rules.Quote(pricing.Input{
+		Lines:    pricing.OrderLines(order.Items),
+		Member:   member,
+		Voucher:  voucher,
+		Shipping: order.Shipping,
+		Now:      time.Now(),
+	})
+	if applied != nil && !applied.Valid {
+		return &VoucherError{Reason: applied.Reason, Voucher: *voucher, Subtotal: breakdown.Subtotal}
+	}
+	order.Price(breakdown)
+	return nil
+}
+
+func findVariant(variants []models.ProductVariant, id int) (models.ProductVariant, bool) {
+	for _, v := range variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return models.ProductVariant{}, false
+}
+
+func findImage(images []models.ProductImage, id int) (models.ProductImage, bool) {
+	for _, image := range images {
+		if image.ID == id {
+			return image, true
+		}
+	}
+	return models.ProductImage{}, false
+}
+
+// sameImages - Whether ids lists every image exactly once
+func sameImages(images []models.ProductImage, ids []int) bool {
+	if len(images) != len(ids) {
+		return false
+	}
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if _, ok := findImage(images, id); !ok || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// flagReorderLine - Mark stock and price changes since the original order
+func flagReorderLine(line models.ReorderLine) models.ReorderLine {
+	line.OutOfStock = line.Stock <= 0
+	line.LowStock = !line.OutOfStock && line.Stock < line.Quantity
+	line.Repriced = line.Price != line.PreviousPrice
+	return line
+}
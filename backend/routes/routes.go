@@ -2,42 +2,217 @@ package routes
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/controllers"
 	"github.com/HHHAAAANNNNN/go-commerce-backend/middlewares"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/pricing"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/search"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/storage"
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes() *mux.Router {
+func SetupRoutes(cfg *config.Config, repos *repositories.Repositories, index *search.Index) *mux.Router {
     router := mux.NewRouter()
 
-    // Apply global middlewares
-    router.Use(middlewares.Logger)
-    router.Use(middlewares.CORS)
+    // Controllers
+    authController := controllers.NewAuthController(repos.Users, repos.Tokens, repos.Carts, cfg.Cart)
+    userController := controllers.NewUserController(repos.Users)
+    files := storage.NewLocal(cfg.Uploads.Dir, cfg.Uploads.BaseURL)
+    productController := controllers.NewProductController(repos.Products, repos.Categories, repos.Reviews, index, files)
+    reviewController := controllers.NewReviewController(repos.Products, repos.Reviews, repos.Orders, index, files,
+        cfg.Uploads.MaxFileSize)
+    questionController := controllers.NewQuestionController(repos.Products, repos.Questions, repos.Orders)
+    categoryController := controllers.NewCategoryController(repos.Categories, repos.Products, index)
+    imageController := controllers.NewProductImageController(repos.Products, repos.Images, files,
+        cfg.Uploads.MaxFileSize, cfg.Uploads.MaxFiles)
+    rules := pricing.Rules{
+        TaxRate:        cfg.Pricing.TaxRate,
+        TaxInclusive:   cfg.Pricing.TaxInclusive,
+        MemberDiscount: cfg.Pricing.MemberDiscount,
+    }
+    orderController := controllers.NewOrderController(repos.Orders, repos.Carts, rules)
+    cartController := controllers.NewCartController(repos.Products, repos.Carts, repos.Wishlists, repos.Vouchers, repos.Users,
+        rules, cfg.Cart)
+    wishlistController := controllers.NewWishlistController(repos.Products, repos.Carts, repos.Wishlists)
+    voucherController := controllers.NewVoucherController(repos.Vouchers, repos.Carts, repos.Users, rules)
+    checkoutController := controllers.NewCheckoutController(repos.Checkouts, repos.Carts, repos.Vouchers, repos.Orders,
+        repos.Users, repos.Addresses, rules, cfg.Cart)
+    addressController := controllers.NewAddressController(repos.Addresses)
+    regionController := controllers.NewRegionController()
+
+    // Apply global middlewares (request logs are info level)
+    if cfg.LogLevel == "debug" || cfg.LogLevel == "info" {
+        router.Use(middlewares.Logger)
+    }
+    router.Use(middlewares.CORS(cfg.CORS.AllowedOrigins))
 
     // API routes
     api := router.PathPrefix("/api").Subrouter()
 
+    // auth - Wrap a handler so it requires a valid access token
+    auth := func(handler http.HandlerFunc) http.Handler {
+        return middlewares.Auth(handler)
+    }
+
+    // guest - Wrap a handler so it takes an access token when one is sent,
+    // and serves guests otherwise
+    guest := func(handler http.HandlerFunc) http.Handler {
+        return middlewares.OptionalAuth(handler)
+    }
+
+    // can - Wrap a handler so it requires a permission of the caller's role
+    can := func(permission string, handler http.HandlerFunc) http.Handler {
+        return middlewares.RequirePermission(permission)(handler)
+    }
+
     // Health check
     api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
         w.Write([]byte(`{"status":"OK","message":"Server is running"}`))
     }).Methods("GET")
 
-    // User routes
-    api.HandleFunc("/users", controllers.GetAllUsers).Methods("GET")
-    api.HandleFunc("/users/{id}", controllers.GetUserByID).Methods("GET")
-    api.HandleFunc("/users", controllers.CreateUser).Methods("POST")
-    api.HandleFunc("/users/{id}", controllers.UpdateUser).Methods("PUT")
-    api.HandleFunc("/users/{id}", controllers.DeleteUser).Methods("DELETE")
+    // Auth routes
+    api.HandleFunc("/auth/register", authController.Register).Methods("POST")
+    api.HandleFunc("/auth/login", authController.Login).Methods("POST")
+    api.HandleFunc("/auth/refresh", authController.RefreshToken).Methods("POST")
+    api.HandleFunc("/auth/logout", authController.Logout).Methods("POST")
+
+    // User routes (own record only, admins use /api/admin/users)
+    api.Handle("/users/{id}", auth(userController.GetUserByID)).Methods("GET")
+    api.Handle("/users/{id}", auth(userController.UpdateUser)).Methods("PUT")
+    api.Handle("/users/{id}/orders", auth(orderController.GetUserOrders)).Methods("GET")
 
     // Product routes
-    api.HandleFunc("/products", controllers.GetAllProducts).Methods("GET")
-    api.HandleFunc("/products/search", controllers.SearchProducts).Methods("GET")
-    api.HandleFunc("/products/{id}", controllers.GetProductByID).Methods("GET")
-    api.HandleFunc("/products", controllers.CreateProduct).Methods("POST")
-    api.HandleFunc("/products/{id}", controllers.UpdateProduct).Methods("PUT")
-    api.HandleFunc("/products/{id}", controllers.DeleteProduct).Methods("DELETE")
+    api.HandleFunc("/products", productController.GetAllProducts).Methods("GET")
+    api.HandleFunc("/products/search", productController.SearchProducts).Methods("GET")
+    api.HandleFunc("/products/autocomplete", productController.AutocompleteProducts).Methods("GET")
+    api.HandleFunc("/products/facets", productController.GetProductFacets).Methods("GET")
+    api.HandleFunc("/products/{id}", productController.GetProductByID).Methods("GET")
+
+    // Category routes
+    api.HandleFunc("/categories", categoryController.GetCategories).Methods("GET")
+    api.HandleFunc("/categories/tree", categoryController.GetCategoryTree).Methods("GET")
+    api.HandleFunc("/categories/{slug}", categoryController.GetCategory).Methods("GET")
+
+    // Product images (public gallery, uploads and changes need products:manage)
+    manageProducts := func(handler http.HandlerFunc) http.Handler {
+        return middlewares.Auth(can(models.PermManageProducts, handler))
+    }
+    api.HandleFunc("/products/{id}/images", imageController.GetImages).Methods("GET")
+    api.Handle("/products/{id}/images", manageProducts(imageController.UploadImages)).Methods("POST")
+    api.Handle("/products/{id}/images/order", manageProducts(imageController.ReorderImages)).Methods("PUT")
+    api.Handle("/products/{id}/images/{imageId}/primary", manageProducts(imageController.SetPrimaryImage)).Methods("PUT")
+    api.Handle("/products/{id}/images/{imageId}", manageProducts(imageController.DeleteImage)).Methods("DELETE")
+
+    // Reviews (public reading, writing needs a completed order for the product)
+    api.HandleFunc("/products/{id}/reviews", reviewController.GetReviews).Methods("GET")
+    api.HandleFunc("/products/{id}/reviews/summary", reviewController.GetReviewSummary).Methods("GET")
+    api.Handle("/products/{id}/reviews", auth(reviewController.CreateReview)).Methods("POST")
+    api.Handle("/products/{id}/reviews/{reviewId}", auth(reviewController.DeleteReview)).Methods("DELETE")
+    api.Handle("/products/{id}/reviews/{reviewId}/helpful", auth(reviewController.MarkHelpful)).Methods("POST")
+    api.Handle("/products/{id}/reviews/{reviewId}/helpful", auth(reviewController.UnmarkHelpful)).Methods("DELETE")
+
+    // Questions and answers (public reading shows approved posts only)
+    api.HandleFunc("/products/{id}/questions", questionController.GetQuestions).Methods("GET")
+    api.Handle("/products/{id}/questions", auth(questionController.AskQuestion)).Methods("POST")
+    api.Handle("/products/{id}/questions/{questionId}/vote", auth(questionController.VoteQuestion)).Methods("PUT")
+    api.Handle("/products/{id}/questions/{questionId}/answers", auth(questionController.AnswerQuestion)).Methods("POST")
+    api.Handle("/products/{id}/questions/{questionId}/answers/{answerId}/vote", auth(questionController.VoteAnswer)).Methods("PUT")
+
+    // Cart routes (own cart, or the guest cart of the cart_token cookie)
+    api.Handle("/cart", guest(cartController.GetCart)).Methods("GET")
+    api.Handle("/cart/items", guest(cartController.AddCartItem)).Methods("POST")
+    api.Handle("/cart/items", guest(cartController.SelectCartItems)).Methods("PATCH")
+    api.Handle("/cart/items", guest(cartController.DeleteCartItems)).Methods("DELETE")
+    api.Handle("/cart/items/{itemId}", guest(cartController.UpdateCartItem)).Methods("PATCH")
+    api.Handle("/cart/items/{itemId}", guest(cartController.DeleteCartItem)).Methods("DELETE")
+    api.Handle("/cart/move-to-wishlist", auth(cartController.MoveToWishlist)).Methods("POST")
+    api.Handle("/cart/voucher", auth(cartController.ApplyVoucher)).Methods("POST")
+    api.Handle("/cart/voucher", auth(cartController.RemoveVoucher)).Methods("DELETE")
+
+    // Voucher routes (Available and My vouchers lists)
+    api.Handle("/vouchers", auth(voucherController.GetVouchers)).Methods("GET")
+    api.Handle("/vouchers/{id}/claim", auth(voucherController.ClaimVoucher)).Methods("POST")
+
+    // Wishlist routes (own wishlist only)
+    api.Handle("/wishlist", auth(wishlistController.GetWishlist)).Methods("GET")
+    api.Handle("/wishlist/items", auth(wishlistController.AddWishlistItem)).Methods("POST")
+    api.Handle("/wishlist/items/{itemId}", auth(wishlistController.DeleteWishlistItem)).Methods("DELETE")
+    api.Handle("/wishlist/products/{id}", auth(wishlistController.DeleteWishlistProduct)).Methods("DELETE")
+    api.Handle("/wishlist/move-to-cart", auth(wishlistController.MoveToCart)).Methods("POST")
+
+    // Address book routes (own addresses only)
+    api.Handle("/addresses", auth(addressController.GetAddresses)).Methods("GET")
+    api.Handle("/addresses", auth(addressController.CreateAddress)).Methods("POST")
+    api.Handle("/addresses/{id}", auth(addressController.GetAddress)).Methods("GET")
+    api.Handle("/addresses/{id}", auth(addressController.UpdateAddress)).Methods("PUT")
+    api.Handle("/addresses/{id}", auth(addressController.DeleteAddress)).Methods("DELETE")
+    api.Handle("/addresses/{id}/default", auth(addressController.SetDefaultAddress)).Methods("PUT")
+
+    // Region routes (public, bundled data)
+    api.HandleFunc("/regions/provinces", regionController.GetProvinces).Methods("GET")
+
+    // Checkout routes (own checkout sessions only)
+    api.Handle("/checkout/options", auth(checkoutController.GetCheckoutOptions)).Methods("GET")
+    api.Handle("/checkout", auth(checkoutController.StartCheckout)).Methods("POST")
+    api.Handle("/checkout/{id}", auth(checkoutController.GetCheckout)).Methods("GET")
+    api.Handle("/checkout/{id}/shipping", auth(checkoutController.UpdateCheckoutShipping)).Methods("PUT")
+    api.Handle("/checkout/{id}/payment", auth(checkoutController.UpdateCheckoutPayment)).Methods("PUT")
+    api.Handle("/checkout/{id}/summary", auth(checkoutController.GetCheckoutSummary)).Methods("GET")
+    api.Handle("/checkout/{id}/place", auth(checkoutController.PlaceCheckoutOrder)).Methods("POST")
+
+    // Order routes (own orders only)
+    api.Handle("/orders", auth(orderController.GetMyOrders)).Methods("GET")
+    api.Handle("/orders/{id}", auth(orderController.GetOrderByID)).Methods("GET")
+    api.Handle("/orders/{id}/timeline", auth(orderController.GetOrderTimeline)).Methods("GET")
+    api.Handle("/orders", auth(orderController.CreateOrder)).Methods("POST")
+    api.Handle("/orders/{id}/cancel", auth(orderController.CancelOrder)).Methods("POST")
+    api.Handle("/orders/{id}/confirm", auth(orderController.ConfirmOrderReceived)).Methods("POST")
+    api.Handle("/orders/{id}/reorder", auth(orderController.ReorderOrder)).Methods("POST")
+
+    // Admin routes
+    admin := api.PathPrefix("/admin").Subrouter()
+    admin.Use(middlewares.Auth)
+
+    admin.Handle("/users", can(models.PermManageUsers, userController.GetAllUsers)).Methods("GET")
+    admin.Handle("/users", can(models.PermManageUsers, userController.CreateUser)).Methods("POST")
+    admin.Handle("/users/{id}", can(models.PermManageUsers, userController.AdminUpdateUser)).Methods("PUT")
+    admin.Handle("/users/{id}", can(models.PermManageUsers, userController.DeleteUser)).Methods("DELETE")
+
+    admin.Handle("/products", can(models.PermManageProducts, productController.CreateProduct)).Methods("POST")
+    admin.Handle("/products/{id}", can(models.PermManageProducts, productController.UpdateProduct)).Methods("PUT")
+    admin.Handle("/products/{id}", can(models.PermManageProducts, productController.DeleteProduct)).Methods("DELETE")
+    admin.Handle("/products/{id}/variants", can(models.PermManageProducts, productController.CreateVariant)).Methods("POST")
+    admin.Handle("/products/{id}/variants/{variantId}", can(models.PermManageProducts, productController.UpdateVariant)).Methods("PUT")
+    admin.Handle("/products/{id}/variants/{variantId}", can(models.PermManageProducts, productController.DeleteVariant)).Methods("DELETE")
+
+    admin.Handle("/categories", can(models.PermManageProducts, categoryController.CreateCategory)).Methods("POST")
+    admin.Handle("/categories/{id}", can(models.PermManageProducts, categoryController.UpdateCategory)).Methods("PUT")
+    admin.Handle("/categories/{id}", can(models.PermManageProducts, categoryController.DeleteCategory)).Methods("DELETE")
+
+    admin.Handle("/questions", can(models.PermModerate, questionController.GetModerationQuestions)).Methods("GET")
+    admin.Handle("/questions/{id}/status", can(models.PermModerate, questionController.ModerateQuestion)).Methods("PUT")
+    admin.Handle("/answers", can(models.PermModerate, questionController.GetModerationAnswers)).Methods("GET")
+    admin.Handle("/answers/{id}/status", can(models.PermModerate, questionController.ModerateAnswer)).Methods("PUT")
+
+    admin.Handle("/vouchers", can(models.PermManageVouchers, voucherController.GetAllVouchers)).Methods("GET")
+    admin.Handle("/vouchers", can(models.PermManageVouchers, voucherController.CreateVoucher)).Methods("POST")
+    admin.Handle("/vouchers/{id}", can(models.PermManageVouchers, voucherController.GetVoucher)).Methods("GET")
+    admin.Handle("/vouchers/{id}", can(models.PermManageVouchers, voucherController.UpdateVoucher)).Methods("PUT")
+    admin.Handle("/vouchers/{id}", can(models.PermManageVouchers, voucherController.DeleteVoucher)).Methods("DELETE")
+
+    admin.Handle("/orders", can(models.PermManageOrders, orderController.GetAllOrders)).Methods("GET")
+    admin.Handle("/orders/{id}/status", can(models.PermManageOrders, orderController.UpdateOrderStatus)).Methods("PUT")
+
+    // Uploaded files, when served by this server rather than a CDN
+    if strings.HasPrefix(cfg.Uploads.BaseURL, "/") {
+        prefix := cfg.Uploads.BaseURL + "/"
+        router.PathPrefix(prefix).Handler(http.StripPrefix(prefix, files.Handler())).Methods("GET", "HEAD")
+    }
 
     return router
 }
\ No newline at end of file
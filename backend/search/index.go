@@ -0,0 +1,378 @@
+// Package search - In-process inverted index over product names, brands
+// and categories.
+//
+// The index lives in memory next to the storage and is kept in sync by the
+// product handlers, so it works the same with MySQL and in-memory storage.
+// Queries match exact terms, prefixes of terms and terms within a small edit
+// distance (typos, plurals), scored with BM25-style term weights.
+package search
+
+import (
+	"context"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/models"
+	"github.com/HHHAAAANNNNN/go-commerce-backend/repositories"
+)
+
+// Weights of a term occurring in each field
+const (
+	nameWeight     = 3.0
+	brandWeight    = 2.0
+	categoryWeight = 1.5
+)
+
+// Match quality multipliers
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.6
+	fuzzyMatch  = 0.5
+)
+
+// Hit - A matching product with its relevance and the name with matched
+// words wrapped in <mark> tags (HTML escaped)
+type Hit struct {
+	ProductID string  `json:"product_id"`
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight"`
+}
+
+// Suggestion - Autocomplete entry for the search box
+type Suggestion struct {
+	Text      string `json:"text"`
+	Type      string `json:"type"`
+	ProductID string `json:"product_id,omitempty"`
+	Highlight string `json:"highlight"`
+}
+
+type document struct {
+	id       string
+	name     string
+	category string
+	brand    string
+	rating   float64
+}
+
+// posting - Term frequencies of one term in one document
+type posting struct {
+	name     int
+	brand    int
+	category int
+}
+
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]document
+	postings map[string]map[string]*posting
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]document),
+		postings: make(map[string]map[string]*posting),
+	}
+}
+
+// Build - Index every product in the repository
+func Build(ctx context.Context, products repositories.ProductRepository) (*Index, error) {
+	all, _, err := products.List(ctx, repositories.ProductFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	index := NewIndex()
+	for _, p := range all {
+		index.Add(p)
+	}
+	return index, nil
+}
+
+// Add - Index a product, replacing any previous version of it
+func (i *Index) Add(p models.Product) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(p.ID)
+	i.docs[p.ID] = document{id: p.ID, name: p.Name, category: p.Category, brand: p.Brand, rating: p.Rating}
+
+	for _, term := range Tokenize(p.Name) {
+		i.posting(term, p.ID).name++
+	}
+	for _, term := range Tokenize(p.Brand) {
+		i.posting(term, p.ID).brand++
+	}
+	for _, term := range Tokenize(p.Category) {
+		i.posting(term, p.ID).category++
+	}
+}
+
+// Remove - Drop a product from the index
+func (i *Index) Remove(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+}
+
+// Search - Products matching the query, most relevant first, and the total
+// number of matches
+func (i *Index) Search(query string, offset, limit int) ([]Hit, int) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return []Hit{}, 0
+	}
+
+	scores, matched := i.score(terms, false)
+	phrase := strings.Join(words(query), " ")
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		doc := i.docs[id]
+		// Reward the whole query appearing as typed
+		if strings.Contains(strings.Join(words(doc.name), " "), phrase) {
+			score *= 1.5
+		}
+		hits = append(hits, Hit{
+			ProductID: id,
+			Score:     math.Round(score*1000) / 1000,
+			Highlight: highlight(doc.name, matched),
+		})
+	}
+	i.sortHits(hits)
+
+	total := len(hits)
+	if offset >= total {
+		return []Hit{}, total
+	}
+	hits = hits[offset:]
+	if limit > 0 && limit < len(hits) {
+		hits = hits[:limit]
+	}
+	return hits, total
+}
+
+// Suggest - Autocomplete for a partially typed query. The last word is
+// treated as a prefix. Matching categories and brands come first, then
+// product names.
+func (i *Index) Suggest(query string, limit int) []Suggestion {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	suggestions := []Suggestion{}
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return suggestions
+	}
+
+	scores, matched := i.score(terms, true)
+
+	// Categories and brands whose name starts with what was typed
+	typed := strings.Join(words(query), " ")
+	for _, field := range []struct {
+		kind  string
+		value func(document) string
+	}{
+		{"category", func(d document) string { return d.category }},
+		{"brand", func(d document) string { return d.brand }},
+	} {
+		seen := make(map[string]bool)
+		var names []string
+		for _, doc := range i.docs {
+			name := field.value(doc)
+			key := strings.ToLower(name)
+			if name != "" && !seen[key] && strings.HasPrefix(key, typed) {
+				seen[key] = true
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if len(suggestions) >= limit {
+				return suggestions
+			}
+			suggestions = append(suggestions, Suggestion{
+				Text:      name,
+				Type:      field.kind,
+				Highlight: highlight(name, matched),
+			})
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ProductID: id, Score: score})
+	}
+	i.sortHits(hits)
+
+	for _, hit := range hits {
+		if len(suggestions) >= limit {
+			break
+		}
+		doc := i.docs[hit.ProductID]
+		suggestions = append(suggestions, Suggestion{
+			Text:      doc.name,
+			Type:      "product",
+			ProductID: doc.id,
+			Highlight: highlight(doc.name, matched),
+		})
+	}
+	return suggestions
+}
+
+// score - Relevance of each matching document. Each query term contributes
+// its best match (exact, prefix or fuzzy) and documents matching more of the
+// query rank higher. With lastIsPrefix (autocomplete), the last term must
+// match as a prefix and documents must match every term. Also returns the index terms that matched, for highlighting.
+func (i *Index) score(terms []string, lastIsPrefix bool) (map[string]float64, map[string]bool) {
+	scores := make(map[string]float64)
+	coverage := make(map[string]int)
+	matched := make(map[string]bool)
+	n := float64(len(i.docs))
+
+	for t, term := range terms {
+		prefixOnly := lastIsPrefix && t == len(terms)-1
+		best := make(map[string]float64)
+
+		for indexTerm, docs := range i.postings {
+			quality := matchQuality(term, indexTerm, prefixOnly)
+			if quality == 0 {
+				continue
+			}
+			matched[indexTerm] = true
+
+			df := float64(len(docs))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for id, p := range docs {
+				tf := nameWeight*float64(p.name) + brandWeight*float64(p.brand) + categoryWeight*float64(p.category)
+				// BM25 saturation so repeated words do not dominate
+				s := quality * idf * (tf * 2.2) / (tf + 1.2)
+				if s > best[id] {
+					best[id] = s
+				}
+			}
+		}
+
+		for id, s := range best {
+			scores[id] += s
+			coverage[id]++
+		}
+	}
+
+	for id := range scores {
+		if lastIsPrefix && coverage[id] < len(terms) {
+			delete(scores, id)
+			continue
+		}
+		ratio := float64(coverage[id]) / float64(len(terms))
+		scores[id] *= ratio * ratio
+	}
+	return scores, matched
+}
+
+// matchQuality - How well an index term matches a query term, 0 for no match
+func matchQuality(query, term string, prefixOnly bool) float64 {
+	if query == term {
+		return exactMatch
+	}
+	if strings.HasPrefix(term, query) && (prefixOnly || len([]rune(query)) >= 3) {
+		return prefixMatch
+	}
+	if prefixOnly {
+		return 0
+	}
+
+	// Allow one typo from 4 letters, two from 8
+	length := len([]rune(query))
+	maxEdits := 0
+	switch {
+	case length >= 8:
+		maxEdits = 2
+	case length >= 4:
+		maxEdits = 1
+	}
+	if maxEdits > 0 && editDistance(query, term, maxEdits) <= maxEdits {
+		return fuzzyMatch
+	}
+	return 0
+}
+
+// sortHits - Highest score first, then best rated, then by ID for stable pages
+func (i *Index) sortHits(hits []Hit) {
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		ra, rb := i.docs[hits[a].ProductID].rating, i.docs[hits[b].ProductID].rating
+		if ra != rb {
+			return ra > rb
+		}
+		return hits[a].ProductID < hits[b].ProductID
+	})
+}
+
+// posting - Posting for term and document, created if missing; the caller
+// holds the write lock
+func (i *Index) posting(term, id string) *posting {
+	docs, ok := i.postings[term]
+	if !ok {
+		docs = make(map[string]*posting)
+		i.postings[term] = docs
+	}
+	p, ok := docs[id]
+	if !ok {
+		p = &posting{}
+		docs[id] = p
+	}
+	return p
+}
+
+// remove - The caller holds the write lock
+func (i *Index) remove(id string) {
+	if _, ok := i.docs[id]; !ok {
+		return
+	}
+	delete(i.docs, id)
+	for term, docs := range i.postings {
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(i.postings, term)
+		}
+	}
+}
+
+// highlight - Text with every word whose term matched wrapped in <mark>
+func highlight(text string, matched map[string]bool) string {
+	var b strings.Builder
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		w := word.String()
+		if term := normalize(strings.ToLower(w)); term != "" && matched[term] {
+			b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(w))
+		}
+		word.Reset()
+	}
+
+	for _, r := range text {
+		if isWordRune(r) {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return b.String()
+}
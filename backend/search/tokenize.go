@@ -0,0 +1,117 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords - Common Indonesian and English words that carry no meaning for
+// product search
+var stopWords = map[string]bool{
+	// Indonesian
+	"dan": true, "atau": true, "yang": true, "di": true, "ke": true, "dari": true,
+	"untuk": true, "dengan": true, "ini": true, "itu": true, "pada": true,
+	"dalam": true, "buat": true, "sama": true, "juga": true, "ada": true,
+	// English
+	"the": true, "and": true, "or": true, "a": true, "an": true, "of": true,
+	"for": true, "with": true, "in": true, "on": true, "to": true, "by": true,
+}
+
+// Tokenize - Split text into normalized search terms: lowercased, split on
+// anything that is not a letter or digit, stop words dropped and words
+// reduced to a simple stem
+func Tokenize(text string) []string {
+	var terms []string
+	for _, word := range words(text) {
+		if term := normalize(word); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// words - Raw words of the text, lowercased
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// normalize - Term for a lowercased word, empty for stop words
+func normalize(word string) string {
+	if stopWords[word] {
+		return ""
+	}
+	return stem(word)
+}
+
+// stem - Only the Indonesian possessive "-nya" is dropped (bukunya -> buku).
+// Stripping more (particles, English plurals) breaks too many Indonesian
+// words such as "sekolah" or "kipas"; plurals and typos are matched by edit
+// distance at query time instead.
+func stem(word string) string {
+	if hasDigit(word) {
+		return word
+	}
+	if strings.HasSuffix(word, "nya") && len([]rune(word))-3 >= 4 {
+		return strings.TrimSuffix(word, "nya")
+	}
+	return word
+}
+
+func hasDigit(s string) bool {
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance - Levenshtein distance with adjacent transpositions, giving
+// up early once it exceeds max
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptCost - Work factor for password hashes
+const bcryptCost = 12
+
+// Password policy limits. bcrypt ignores everything after 72 bytes, so longer
+// passwords are rejected instead of being silently truncated.
+const (
+	PasswordMinLength = 8
+	PasswordMaxBytes  = 72
+)
+
+// dummyHash - Compared against when the user does not exist so that a login
+// for an unknown email takes as long as one with a wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("go-commerce-dummy-password"), bcryptCost)
+
+// NormalizeEmail - Trim and lowercase an email, returning an error when it is not valid
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", errors.New("Invalid email address")
+	}
+
+	return email, nil
+}
+
+// ValidatePassword - Enforce the password policy
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < PasswordMinLength {
+		return errors.New("Password must be at least 8 characters")
+	}
+	if len(password) > PasswordMaxBytes {
+		return errors.New("Password must be at most 72 bytes")
+	}
+
+	var hasLetter, hasDigit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("Password must contain at least one letter and one number")
+	}
+
+	return nil
+}
+
+// HashPassword - Hash a password with bcrypt
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword - Compare a password with its hash. An empty hash never matches
+// but still costs one bcrypt comparison.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
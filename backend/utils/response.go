@@ -9,9 +9,28 @@ type Response struct {
     Success bool        `json:"success"`
     Message string      `json:"message,omitempty"`
     Data    interface{} `json:"data,omitempty"`
+    Meta    *Pagination `json:"meta,omitempty"`
     Error   string      `json:"error,omitempty"`
 }
 
+// Pagination - Position of a page within the full result set
+type Pagination struct {
+    Page       int `json:"page"`
+    Limit      int `json:"limit"`
+    Total      int `json:"total"`
+    TotalPages int `json:"total_pages"`
+}
+
+// NewPagination - Fill in the page count for total results
+func NewPagination(page, limit, total int) Pagination {
+    return Pagination{
+        Page:       page,
+        Limit:      limit,
+        Total:      total,
+        TotalPages: (total + limit - 1) / limit,
+    }
+}
+
 // JSONResponse - Send JSON response
 func JSONResponse(w http.ResponseWriter, statusCode int, response Response) {
     w.Header().Set("Content-Type", "application/json")
@@ -28,6 +47,16 @@ func SuccessResponse(w http.ResponseWriter, message string, data interface{}) {
     })
 }
 
+// PaginatedResponse - Send success response for one page of a list
+func PaginatedResponse(w http.ResponseWriter, message string, data interface{}, meta Pagination) {
+    JSONResponse(w, http.StatusOK, Response{
+        Success: true,
+        Message: message,
+        Data:    data,
+        Meta:    &meta,
+    })
+}
+
 // ErrorResponse - Send error response
 func ErrorResponse(w http.ResponseWriter, statusCode int, message string) {
     JSONResponse(w, statusCode, Response{
@@ -43,4 +72,13 @@ func CreatedResponse(w http.ResponseWriter, message string, data interface{}) {
         Message: message,
         Data:    data,
     })
-}
\ No newline at end of file
+}
+
+// ErrorResponseWithData - Send error response with extra details
+func ErrorResponseWithData(w http.ResponseWriter, statusCode int, message string, data interface{}) {
+    JSONResponse(w, statusCode, Response{
+        Success: false,
+        Error:   message,
+        Data:    data,
+    })
+}
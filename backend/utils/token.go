@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/HHHAAAANNNNN/go-commerce-backend/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AccessClaims - Claims carried by an access token
+type AccessClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// GenerateAccessToken - Sign a short-lived access token for a user
+func GenerateAccessToken(userID int, role string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(config.AccessTokenTTL)
+
+	claims := AccessClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    config.JWTIssuer,
+			Audience:  jwt.ClaimStrings{config.JWTAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(config.JWTSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ParseAccessToken - Verify signature, expiry, issuer and audience of an access
+// token and return the user ID and role it was issued for
+func ParseAccessToken(tokenString string) (int, string, error) {
+	var claims AccessClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return config.JWTSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(config.JWTIssuer),
+		jwt.WithAudience(config.JWTAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return 0, "", err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return 0, "", errors.New("invalid token subject")
+	}
+
+	return userID, claims.Role, nil
+}
+
+// GenerateRefreshToken - Create an opaque refresh token and the hash stored for it.
+// Only the hash is kept server-side so a database leak does not leak sessions.
+func GenerateRefreshToken() (string, string, error) {
+	return GenerateOpaqueToken()
+}
+
+// GenerateOpaqueToken - Random URL-safe token and its HashToken digest
+func GenerateOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken - SHA-256 hex digest of an opaque token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}